@@ -0,0 +1,90 @@
+package rrd
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// BatchError represents the failure of a single command in a batch.
+type BatchError struct {
+	// Index is the index of Cmd in the batch.
+	Index int
+	Cmd   *Cmd
+	Msg   string
+}
+
+func (e *BatchError) Error() string {
+	return fmt.Sprintf("%v (%v)", e.Msg, e.Index+1)
+}
+
+// BatchResult represents the result of a batch of commands.
+type BatchResult struct {
+	Cmds   []*Cmd
+	Errors []*BatchError
+
+	// Invalid contains the error lines which couldn't be attributed to a command.
+	Invalid []*InvalidResponseError
+}
+
+// newBatchResult returns a new BatchResult for cmds from the error lines returned by rrdcached.
+// Invalid lines are recorded in Invalid without affecting the other results.
+func newBatchResult(cmds []*Cmd, lines []string) *BatchResult {
+	r := &BatchResult{Cmds: cmds}
+	for _, l := range lines {
+		matches := respRe.FindStringSubmatch(l)
+		if len(matches) != 3 {
+			r.Invalid = append(r.Invalid, NewInvalidResponseError("batch: invalid error", l))
+			continue
+		}
+
+		n, err := strconv.Atoi(matches[1])
+		if err != nil || n < 1 || n > len(cmds) {
+			r.Invalid = append(r.Invalid, NewInvalidResponseError("batch: invalid command number", l))
+			continue
+		}
+
+		r.Errors = append(r.Errors, &BatchError{Index: n - 1, Cmd: cmds[n-1], Msg: matches[2]})
+	}
+
+	return r
+}
+
+// Err returns an Error detailing all the failures, including invalid error
+// lines, or nil if there were none.
+func (r *BatchResult) Err() error {
+	if len(r.Errors) == 0 && len(r.Invalid) == 0 {
+		return nil
+	}
+
+	lines := make([]string, 0, len(r.Errors)+len(r.Invalid))
+	for _, e := range r.Errors {
+		lines = append(lines, fmt.Sprintf("%v %v", e.Index+1, e.Msg))
+	}
+	for _, e := range r.Invalid {
+		lines = append(lines, e.Error())
+	}
+
+	return NewError(0-len(lines), strings.Join(lines, "\n"))
+}
+
+// Failed returns the commands which failed, in batch order.
+func (r *BatchResult) Failed() []*Cmd {
+	if len(r.Errors) == 0 {
+		return nil
+	}
+
+	failed := make([]bool, len(r.Cmds))
+	for _, e := range r.Errors {
+		failed[e.Index] = true
+	}
+
+	cmds := make([]*Cmd, 0, len(r.Errors))
+	for i, c := range r.Cmds {
+		if failed[i] {
+			cmds = append(cmds, c)
+		}
+	}
+
+	return cmds
+}
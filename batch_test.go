@@ -0,0 +1,69 @@
+package rrd
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBatchResult(t *testing.T) {
+	cmds := []*Cmd{
+		NewCmd("update").WithArgs("a.rrd", "1499968801:1"),
+		NewCmd("update").WithArgs("b.rrd", "1499968801:2"),
+		NewCmd("update").WithArgs("c.rrd", "1499968801:3"),
+	}
+
+	r := newBatchResult(cmds, []string{
+		"3 No such file: c.rrd",
+		"1 illegal attempt to update using time 1499968801.000000 when last update time is 1499968801.000000 (minimum one second step)",
+	})
+	assert.Empty(t, r.Invalid)
+
+	expected := []*BatchError{
+		{Index: 2, Cmd: cmds[2], Msg: "No such file: c.rrd"},
+		{Index: 0, Cmd: cmds[0], Msg: "illegal attempt to update using time 1499968801.000000 when last update time is 1499968801.000000 (minimum one second step)"},
+	}
+	assert.Equal(t, expected, r.Errors)
+	assert.Equal(t, []*Cmd{cmds[0], cmds[2]}, r.Failed())
+	assert.Equal(t, "No such file: c.rrd (3)", r.Errors[0].Error())
+
+	err := r.Err()
+	if assert.Error(t, err) {
+		assert.Equal(t, -2, err.(*Error).Code)
+	}
+}
+
+func TestBatchResultNoErrors(t *testing.T) {
+	r := newBatchResult([]*Cmd{NewCmd("ping")}, nil)
+
+	assert.NoError(t, r.Err())
+	assert.Nil(t, r.Failed())
+}
+
+func TestBatchResultInvalid(t *testing.T) {
+	tests := []struct {
+		name string
+		line string
+	}{
+		{"format", "bad line"},
+		{"zero", "0 Can't use 'ping' here."},
+		{"range", "2 Can't use 'ping' here."},
+	}
+
+	cmds := []*Cmd{NewCmd("ping")}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			// The valid error is kept.
+			r := newBatchResult(cmds, []string{tc.line, "1 Can't use 'ping' here."})
+			assert.Equal(t, []*BatchError{{Index: 0, Cmd: cmds[0], Msg: "Can't use 'ping' here."}}, r.Errors)
+			if assert.Len(t, r.Invalid, 1) {
+				assert.Equal(t, []string{tc.line}, r.Invalid[0].Data)
+			}
+
+			err := r.Err()
+			if assert.Error(t, err) {
+				assert.Equal(t, -2, err.(*Error).Code)
+			}
+		})
+	}
+}
@@ -5,12 +5,14 @@ package rrd
 
 import (
 	"bufio"
+	"context"
 	"fmt"
 	"io"
 	"net"
 	"regexp"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
 )
 
@@ -24,15 +26,31 @@ var (
 
 	// DefaultTimeout is the default read / write / dial timeout for Clients.
 	DefaultTimeout = time.Second * 10
+
+	// aLongTimeAgo is a deadline in the past used to unblock pending I/O.
+	aLongTimeAgo = time.Unix(1, 0)
 )
 
 // Client is a rrdcached client.
+//
+// If a command fails due to an I/O error, or is aborted by its context, the
+// state of the connection is unknown so it's closed. Unless a ReconnectPolicy
+// is set all subsequent commands then return ErrConnAborted, and the Client
+// should be closed and replaced.
 type Client struct {
-	conn    net.Conn
-	addr    string
-	network string
-	timeout time.Duration
-	scanner *bufio.Scanner
+	conn      net.Conn
+	addr      string
+	network   string
+	timeout   time.Duration
+	scanner   *bufio.Scanner
+	broken    bool
+	reconnect *ReconnectPolicy
+	validate  bool
+
+	// interrupted is true once the context of the running command is done,
+	// so the deadline set to abort its I/O must be kept.
+	interrupted bool
+	deadlineMtx sync.Mutex
 }
 
 // Timeout sets read / write / dial timeout for a rrdcached Client.
@@ -49,10 +67,24 @@ func Unix(c *Client) error {
 	return nil
 }
 
+// ValidateCreate sets the client to Validate the definition passed to Create
+// before sending it to the server, returning a *ValidationError if it's invalid.
+func ValidateCreate(c *Client) error {
+	c.validate = true
+	return nil
+}
+
 // NewClient returns a new rrdcached client connected to addr.
 // By default addr is treated as a TCP address to use UNIX sockets pass Unix as an option.
 // If addr for a TCP address doesn't include a port the DefaultPort will be used.
 func NewClient(addr string, options ...func(c *Client) error) (*Client, error) {
+	return NewClientContext(context.Background(), addr, options...)
+}
+
+// NewClientContext returns a new rrdcached client connected to addr.
+// The provided ctx must be non-nil and is used to abort the dial, once
+// connected it has no further effect on the client.
+func NewClientContext(ctx context.Context, addr string, options ...func(c *Client) error) (*Client, error) {
 	c := &Client{timeout: DefaultTimeout, network: "tcp", addr: addr}
 	for _, f := range options {
 		if f == nil {
@@ -67,20 +99,145 @@ func NewClient(addr string, options ...func(c *Client) error) (*Client, error) {
 			c.addr = fmt.Sprintf("%v:%v", c.addr, DefaultPort)
 		}
 	}
-	var err error
-	if c.conn, err = net.DialTimeout(c.network, c.addr, c.timeout); err != nil {
+	if err := c.dial(ctx); err != nil {
 		return nil, err
 	}
 
+	return c, nil
+}
+
+// dial establishes a new connection to the server.
+func (c *Client) dial(ctx context.Context) error {
+	d := &net.Dialer{Timeout: c.timeout}
+	conn, err := d.DialContext(ctx, c.network, c.addr)
+	if err != nil {
+		return err
+	}
+
+	c.conn = conn
 	c.scanner = bufio.NewScanner(bufio.NewReader(c.conn))
 	c.scanner.Split(bufio.ScanLines)
+	c.broken = false
 
-	return c, nil
+	return nil
+}
+
+// setDeadline updates the deadline on the connection based on the clients configured
+// timeout, limited by the deadline of ctx if any. Once the running command has
+// been interrupted the past deadline which aborts its I/O is kept.
+func (c *Client) setDeadline(ctx context.Context) error {
+	c.deadlineMtx.Lock()
+	defer c.deadlineMtx.Unlock()
+
+	if c.interrupted {
+		return nil
+	}
+
+	t := time.Now().Add(c.timeout)
+	if d, ok := ctx.Deadline(); ok && d.Before(t) {
+		t = d
+	}
+	return c.conn.SetDeadline(t)
+}
+
+// do runs f which performs cmd on the connection.
+//
+// If the connection is broken and a ReconnectPolicy is set the connection is
+// re-established, with idempotent commands being transparently retried.
+func (c *Client) do(ctx context.Context, cmd string, f func() error) error {
+	for retried := false; ; retried = true {
+		if c.broken {
+			if c.reconnect == nil {
+				return ErrConnAborted
+			}
+			if err := c.redial(ctx); err != nil {
+				return err
+			}
+		}
+
+		err := c.run(ctx, f)
+		if !c.broken || c.reconnect == nil || ctx.Err() != nil || retried {
+			return err
+		} else if !idempotent[strings.ToLower(cmd)] {
+			return &UncertainError{Cmd: cmd, Err: err}
+		}
+	}
+}
+
+// run runs f, aborting any blocked reads or writes on the connection if ctx
+// is done before f returns.
+//
+// If f was interrupted or failed due to an I/O error the state of the connection
+// is unknown, so it's closed and marked as broken.
+func (c *Client) run(ctx context.Context, f func() error) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	if ctx.Done() == nil {
+		// ctx can never be done, so there's nothing to watch.
+		return c.result(ctx, f(), false)
+	}
+
+	done := make(chan struct{})
+	interrupted := make(chan bool, 1)
+	go func() {
+		select {
+		case <-ctx.Done():
+			c.deadlineMtx.Lock()
+			c.interrupted = true
+			c.conn.SetDeadline(aLongTimeAgo) // nolint: errcheck
+			c.deadlineMtx.Unlock()
+			interrupted <- true
+		case <-done:
+			interrupted <- false
+		}
+	}()
+
+	err := f()
+	close(done)
+	aborted := <-interrupted || (isTimeout(err) && expired(ctx))
+
+	c.deadlineMtx.Lock()
+	c.interrupted = false
+	c.deadlineMtx.Unlock()
+
+	return c.result(ctx, err, aborted)
+}
+
+// result returns the error of a command which returned err, marking the
+// connection as broken if its state is unknown.
+func (c *Client) result(ctx context.Context, err error, aborted bool) error {
+	switch err.(type) {
+	case nil, *Error:
+		// Completed, any interrupt took effect too late to matter.
+		return err
+	case *InvalidResponseError:
+		if !aborted {
+			return err
+		}
+	}
+
+	c.broken = true
+	c.conn.Close() // nolint: errcheck
+	if !aborted {
+		return err
+	} else if err := ctx.Err(); err != nil {
+		return err
+	}
+	return context.DeadlineExceeded
 }
 
-// setDeadline updates the deadline on the connection based on the clients configured timeout.
-func (c *Client) setDeadline() error {
-	return c.conn.SetDeadline(time.Now().Add(c.timeout))
+// isTimeout returns true if err is a network timeout, false otherwise.
+func isTimeout(err error) bool {
+	err2, ok := err.(net.Error)
+	return ok && err2.Timeout()
+}
+
+// expired returns true if ctx has a deadline which has passed, false otherwise.
+func expired(ctx context.Context) bool {
+	d, ok := ctx.Deadline()
+	return ok && !time.Now().Before(d)
 }
 
 // Exec executes cmd on the server and returns the response.
@@ -88,67 +245,132 @@ func (c *Client) Exec(cmd string) ([]string, error) {
 	return c.ExecCmd(NewCmd(cmd))
 }
 
+// ExecContext executes cmd on the server and returns the response.
+func (c *Client) ExecContext(ctx context.Context, cmd string) ([]string, error) {
+	return c.ExecCmdContext(ctx, NewCmd(cmd))
+}
+
 // ExecCmd executes cmd on the server and returns the response.
 func (c *Client) ExecCmd(cmd *Cmd) ([]string, error) {
-	if err := c.setDeadline(); err != nil {
+	return c.ExecCmdContext(context.Background(), cmd)
+}
+
+// ExecCmdContext executes cmd on the server and returns the response.
+// The read / write deadlines are limited by the deadline of ctx and if ctx is
+// done before the response has been read the connection is aborted, after which
+// the client returns ErrConnAborted for all commands, unless a ReconnectPolicy
+// is set, and should be closed.
+func (c *Client) ExecCmdContext(ctx context.Context, cmd *Cmd) ([]string, error) {
+	var lines []string
+	err := c.do(ctx, cmd.cmd, func() (err error) {
+		lines, err = c.execCmd(ctx, cmd)
+		return err
+	})
+	return lines, err
+}
+
+// execCmd executes cmd on the server and returns the response.
+func (c *Client) execCmd(ctx context.Context, cmd *Cmd) ([]string, error) {
+	var lines []string
+	msg, err := c.execCmdFunc(ctx, cmd, func(l string) error {
+		lines = append(lines, l)
+		return nil
+	})
+	if err != nil {
 		return nil, err
+	} else if lines == nil {
+		// message is the line e.g. first.
+		return []string{msg}, nil
 	}
 
-	if _, err := c.conn.Write([]byte(cmd.String())); err != nil {
+	return lines, nil
+}
+
+// execLines executes cmd on the server, retrying it if possible, and returns
+// the lines of the response. Unlike execCmd the message is ignored if there are
+// no lines, for commands whose message isn't one of their results.
+func (c *Client) execLines(ctx context.Context, cmd *Cmd) ([]string, error) {
+	var lines []string
+	err := c.do(ctx, cmd.cmd, func() error {
+		lines = nil
+		_, err := c.execCmdFunc(ctx, cmd, func(l string) error {
+			lines = append(lines, l)
+			return nil
+		})
+		return err
+	})
+	if err != nil {
 		return nil, err
 	}
 
-	if err := c.setDeadline(); err != nil {
-		return nil, err
+	return lines, nil
+}
+
+// execCmdFunc executes cmd on the server calling f for each line of the response,
+// returning the message from the response header.
+// If f returns an error the remaining lines are read and discarded, so the
+// connection remains usable, and the error is returned.
+func (c *Client) execCmdFunc(ctx context.Context, cmd *Cmd, f func(l string) error) (string, error) {
+	if err := c.setDeadline(ctx); err != nil {
+		return "", err
+	}
+
+	if _, err := c.conn.Write([]byte(cmd.String())); err != nil {
+		return "", err
+	}
+
+	if err := c.setDeadline(ctx); err != nil {
+		return "", err
 	}
 
 	if !c.scanner.Scan() {
-		return nil, c.scanErr()
+		return "", c.scanErr()
 	}
 
 	l := c.scanner.Text()
 	matches := respRe.FindStringSubmatch(l)
 	if len(matches) != 3 {
-		return nil, NewInvalidResponseError("bad header", l)
+		return "", NewInvalidResponseError("bad header", l)
 	}
 
 	cnt, err := strconv.Atoi(matches[1])
 	if err != nil {
 		// This should be impossible given the regexp matched.
-		return nil, NewInvalidResponseError("bad header count", l)
+		return "", NewInvalidResponseError("bad header count", l)
 	}
 
-	switch {
-	case cnt < 0:
+	if cnt < 0 {
 		// rrdcached reported an error.
-		return nil, NewError(cnt, matches[2])
-	case cnt == 0:
-		// message is the line e.g. first.
-		return []string{matches[2]}, nil
+		return "", NewError(cnt, matches[2])
 	}
 
-	if err := c.setDeadline(); err != nil {
-		return nil, err
-	}
-	lines := make([]string, 0, cnt)
-	for len(lines) < cnt && c.scanner.Scan() {
-		lines = append(lines, c.scanner.Text())
-		if err := c.setDeadline(); err != nil {
-			return nil, err
+	var ferr error
+	for i := 0; i < cnt; i++ {
+		if err := c.setDeadline(ctx); err != nil {
+			return "", err
+		}
+
+		if !c.scanner.Scan() {
+			// Short response.
+			return "", c.scanErr()
 		}
-	}
 
-	if len(lines) != cnt {
-		// Short response.
-		return nil, c.scanErr()
+		if ferr == nil {
+			ferr = f(c.scanner.Text())
+		}
 	}
 
-	return lines, nil
+	return matches[2], ferr
 }
 
 // Close closes the connection to the server.
+// If the connection was previously broken it returns nil.
 func (c *Client) Close() error {
-	errD := c.setDeadline()
+	if c.broken {
+		return nil
+	}
+
+	errD := c.setDeadline(context.Background())
 	_, errW := c.conn.Write([]byte("quit"))
 	err := c.conn.Close()
 	if err != nil {
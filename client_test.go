@@ -1,7 +1,10 @@
 package rrd
 
 import (
+	"bufio"
+	"context"
 	"errors"
+	"fmt"
 	"net"
 	"testing"
 	"time"
@@ -136,3 +139,116 @@ func TestClientUnix(t *testing.T) {
 	// Should never get here
 	assert.NoError(t, c.Close())
 }
+
+func TestClientContext(t *testing.T) {
+	s := newServer(t)
+	if s == nil {
+		return
+	}
+	defer func() {
+		assert.NoError(t, s.Close())
+	}()
+
+	c, err := NewClientContext(context.Background(), s.Addr, Timeout(time.Second*2))
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	defer func() {
+		assert.NoError(t, c.Close())
+	}()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	assert.Equal(t, context.Canceled, c.PingContext(ctx))
+
+	// Cancellation before the command was sent leaves the client usable.
+	assert.NoError(t, c.PingContext(context.Background()))
+
+	ctx, cancel = context.WithTimeout(context.Background(), time.Millisecond*50)
+	defer cancel()
+	_, err = c.ExecContext(ctx, cmdHang)
+	assert.Equal(t, context.DeadlineExceeded, err)
+	assert.Equal(t, ErrConnAborted, c.Ping())
+}
+
+func TestClientContextCancel(t *testing.T) {
+	s := newServer(t)
+	if s == nil {
+		return
+	}
+	defer func() {
+		assert.NoError(t, s.Close())
+	}()
+
+	c, err := NewClient(s.Addr, Timeout(time.Second*2))
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	defer func() {
+		assert.NoError(t, c.Close())
+	}()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(time.Millisecond*50, cancel)
+	start := time.Now()
+	_, err = c.ExecContext(ctx, cmdHang)
+	assert.Equal(t, context.Canceled, err)
+	assert.True(t, time.Since(start) < time.Second)
+	assert.Equal(t, ErrConnAborted, c.Ping())
+}
+
+func TestClientContextCancelMidResponse(t *testing.T) {
+	l, err := newLocalListener()
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer l.Close() // nolint: errcheck
+
+	stop := make(chan struct{})
+	defer close(stop)
+	go func() {
+		conn, err := l.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close() // nolint: errcheck
+
+		if _, err = bufio.NewReader(conn).ReadString('\n'); err != nil {
+			return
+		}
+		fmt.Fprint(conn, "8 Success\nFlushVersion: 1\nStart: 1499908800\nEnd: 1499909400\n"+ // nolint: errcheck
+			"Step: 300\nDSCount: 1\nDSName: watts\n1499909100: 1.0e+00\n")
+
+		// Stall before the last row.
+		select {
+		case <-time.After(time.Second * 2):
+			fmt.Fprint(conn, "1499909400: 2.0e+00\n") // nolint: errcheck
+		case <-stop:
+		}
+		<-stop
+	}()
+
+	c, err := NewClient(l.Addr().String(), Timeout(time.Second*3))
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer c.Close() // nolint: errcheck
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	var rows int
+	start := time.Now()
+	_, err = c.FetchStreamContext(ctx, "test.rrd", Average, func(f *Fetch, row *FetchRow) error {
+		rows++
+		cancel()
+		// Let the interrupt take effect before the next row is read.
+		time.Sleep(time.Millisecond * 50)
+		return nil
+	})
+	assert.Equal(t, context.Canceled, err)
+	assert.Equal(t, 1, rows)
+	assert.True(t, time.Since(start) < time.Second)
+}
@@ -0,0 +1,55 @@
+// Command rrdcached runs a native rrdcached compatible server, storing RRDs
+// as rrdtool compatible files in a base directory, or in memory.
+package main
+
+import (
+	"flag"
+	"log"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+
+	"github.com/multiplay/go-rrd/server"
+)
+
+func main() {
+	listen := flag.String("listen", "127.0.0.1:42217", "address to listen on, a path for a unix socket")
+	dir := flag.String("base-dir", ".", "directory the RRD files are stored in")
+	memory := flag.Bool("memory", false, "store RRDs in memory instead of files, all data is lost on exit")
+	interval := flag.Duration("write-interval", server.DefaultWriteInterval, "maximum duration updates are cached before being written")
+	flag.Parse()
+
+	var store server.Store = server.NewFileStore(*dir)
+	if *memory {
+		store = server.NewMemStore()
+	}
+
+	s, err := server.New(store, server.WriteInterval(*interval))
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	network := "tcp"
+	if strings.HasPrefix(*listen, "/") {
+		network = "unix"
+	}
+
+	sig := make(chan os.Signal, 1)
+	signal.Notify(sig, syscall.SIGINT, syscall.SIGTERM)
+	closed := make(chan error, 1)
+	go func() {
+		<-sig
+		// Close writes the cached updates.
+		closed <- s.Close()
+	}()
+
+	log.Printf("serving on %v", *listen)
+	if err := s.ListenAndServe(network, *listen); err != server.ErrServerClosed {
+		log.Fatal(err)
+	}
+
+	if err := <-closed; err != nil {
+		log.Fatal(err)
+	}
+}
@@ -0,0 +1,47 @@
+// Command rrdcached_exporter serves the statistics of an rrdcached daemon
+// as Prometheus metrics.
+package main
+
+import (
+	"flag"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/multiplay/go-rrd"
+	"github.com/multiplay/go-rrd/exporter"
+)
+
+func main() {
+	addr := flag.String("rrdcached", "127.0.0.1:42217", "address of rrdcached, a path for a unix socket")
+	listen := flag.String("listen", ":9529", "address to serve metrics on")
+	path := flag.String("path", "/metrics", "path to serve metrics on")
+	queue := flag.Bool("queue", false, "export the number of pending updates of each queued file")
+	timeout := flag.Duration("timeout", time.Second*5, "timeout of each collection")
+	flag.Parse()
+
+	var clientOptions []func(c *rrd.Client) error
+	if strings.HasPrefix(*addr, "/") {
+		clientOptions = append(clientOptions, rrd.Unix)
+	}
+
+	p, err := rrd.NewPool(*addr, rrd.ClientOptions(clientOptions...), rrd.MaxOpen(1))
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	options := []func(e *exporter.Exporter) error{exporter.Timeout(*timeout)}
+	if *queue {
+		options = append(options, exporter.Queue)
+	}
+
+	e, err := exporter.New(p, options...)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	http.Handle(*path, e)
+	log.Printf("serving metrics for %v on %v%v", *addr, *listen, *path)
+	log.Fatal(http.ListenAndServe(*listen, nil))
+}
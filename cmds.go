@@ -2,8 +2,10 @@ package rrd
 
 import (
 	"bytes"
+	"context"
 	"encoding/binary"
 	"fmt"
+	"math"
 	"reflect"
 	"regexp"
 	"strconv"
@@ -17,20 +19,92 @@ var (
 
 // Flush requests rrdcached flushed all values pending for filename to disk.
 func (c *Client) Flush(filename string) error {
-	_, err := c.ExecCmd(NewCmd("flush").WithArgs(filename))
+	return c.FlushContext(context.Background(), filename)
+}
+
+// FlushContext requests rrdcached flushed all values pending for filename to disk.
+func (c *Client) FlushContext(ctx context.Context, filename string) error {
+	_, err := c.ExecCmdContext(ctx, NewCmd("flush").WithArgs(filename))
 	return err
 }
 
 // FlushAll requests the rrdcached start to flush all pending values to disk.
 func (c *Client) FlushAll() error {
-	_, err := c.Exec("flushall")
+	return c.FlushAllContext(context.Background())
+}
+
+// FlushAllContext requests the rrdcached start to flush all pending values to disk.
+func (c *Client) FlushAllContext(ctx context.Context) error {
+	_, err := c.ExecContext(ctx, "flushall")
 	return err
 }
 
+// PendingUpdate represents an update which rrdcached hasn't yet written to disk.
+// Data contains the values as passed to update, with unknown values nil.
+type PendingUpdate struct {
+	Time time.Time
+	Data []*float64
+}
+
 // Pending returns any "pending" updates for a file, in order.
-func (c *Client) Pending(filename string) ([]string, error) {
-	// TODO(steve): parse if needed when we know what the data looks like.
-	return c.ExecCmd(NewCmd("pending").WithArgs(filename))
+func (c *Client) Pending(filename string) ([]*PendingUpdate, error) {
+	return c.PendingContext(context.Background(), filename)
+}
+
+// PendingContext returns any "pending" updates for a file, in order.
+func (c *Client) PendingContext(ctx context.Context, filename string) ([]*PendingUpdate, error) {
+	lines, err := c.execLines(ctx, NewCmd("pending").WithArgs(filename))
+	if err != nil {
+		return nil, err
+	}
+
+	if len(lines) == 0 {
+		return nil, nil
+	}
+
+	updates := make([]*PendingUpdate, len(lines))
+	for i, l := range lines {
+		u, err := parsePendingUpdate(l)
+		if err != nil {
+			return nil, err
+		}
+		updates[i] = u
+	}
+
+	return updates, nil
+}
+
+// parsePendingUpdate parses the pending update line of the form ts:val[:val...],
+// where ts may have fractional seconds.
+func parsePendingUpdate(line string) (*PendingUpdate, error) {
+	parts := strings.Split(line, ":")
+	if len(parts) < 2 {
+		return nil, NewInvalidResponseError("pending: invalid update", line)
+	}
+
+	ts, err := strconv.ParseFloat(parts[0], 64)
+	if err != nil {
+		return nil, NewInvalidResponseError("pending: invalid time", line)
+	}
+	sec, frac := math.Modf(ts)
+
+	u := &PendingUpdate{
+		Time: time.Unix(int64(sec), int64(math.Round(frac*1e6))*int64(time.Microsecond)),
+		Data: make([]*float64, len(parts)-1),
+	}
+	for i, val := range parts[1:] {
+		if val == "U" {
+			continue
+		}
+
+		v, err := strconv.ParseFloat(val, 64)
+		if err != nil {
+			return nil, NewInvalidResponseError("pending: invalid value", line)
+		}
+		u.Data[i] = &v
+	}
+
+	return u, nil
 }
 
 // FetchCommon represents the common fields between fetch and fetchbin
@@ -53,6 +127,10 @@ type Fetch struct {
 type FetchRow struct {
 	Time time.Time
 	Data []*float64
+
+	// Estimated is true if values of the row were derived from updates still
+	// pending in rrdcached, see rrdfile.FetchWithPending.
+	Estimated bool
 }
 
 // decodeField decodes val into the field.
@@ -107,79 +185,213 @@ func decodeTime(field, val, line string, fv reflect.Value) error {
 }
 
 // fetch performs the common action between fetch and fetchbin.
-func (c *Client) fetch(cmd, filename, cf string, r interface{}, options ...interface{}) ([]string, error) {
-	args := append([]interface{}{filename, cf}, options...)
-	lines, err := c.ExecCmd(NewCmd(cmd).WithArgs(args...))
+func (c *Client) fetch(ctx context.Context, cmd string, args []interface{}, r interface{}) ([]string, error) {
+	lines, err := c.execCmd(ctx, NewCmd(cmd).WithArgs(args...))
 	if err != nil {
 		return nil, err
 	}
 
-	v := reflect.Indirect(reflect.ValueOf(r))
 	for i, l := range lines {
-		if strings.HasPrefix(l, "DSName:") {
-			r, ok := r.(*Fetch)
-			if !ok {
-				return nil, NewInvalidResponseError(cmd+": unexpected ds name", l)
-			}
-			l = l[7:]
-			l = strings.TrimSpace(l)
-			r.Names = strings.Split(l, " ")
-			if len(r.Names) != r.Count {
-				return nil, NewInvalidResponseError(cmd+": invalid ds name count", l)
-			}
-			return lines[i+1:], nil
-		} else if strings.HasPrefix(l, "DSName-") {
+		if strings.HasPrefix(l, "DSName-") {
 			return lines[i:], nil
-		} else if matches := valueRe.FindStringSubmatch(l); len(matches) == 3 {
-			field := strings.TrimPrefix(matches[1], "DS")
-			fv := v.FieldByName(field)
-			if !fv.IsValid() {
-				return nil, NewInvalidResponseError("unknown field", l)
-			}
-			if err := decodeField(field, matches[2], l, fv); err != nil {
-				return nil, err
-			}
+		}
+
+		done, err := decodeFetchHeader(cmd, l, r)
+		if err != nil {
+			return nil, err
+		} else if done {
+			return lines[i+1:], nil
 		}
 	}
 
 	return nil, NewInvalidResponseError(cmd+": missing ds name", lines...)
 }
 
-// Fetch returns the free text results of a fetch command with the given options.
-func (c *Client) Fetch(filename, cf string, options ...interface{}) (*Fetch, error) {
-	r := &Fetch{}
-	lines, err := c.fetch("fetch", filename, cf, r, options...)
+// decodeFetchHeader decodes the header line l of the fetch command cmd into r,
+// returning true if it's the DSName line which ends the header.
+func decodeFetchHeader(cmd, l string, r interface{}) (bool, error) {
+	if strings.HasPrefix(l, "DSName:") {
+		r, ok := r.(*Fetch)
+		if !ok {
+			return false, NewInvalidResponseError(cmd+": unexpected ds name", l)
+		}
+		l = l[7:]
+		l = strings.TrimSpace(l)
+		r.Names = strings.Split(l, " ")
+		if len(r.Names) != r.Count {
+			return false, NewInvalidResponseError(cmd+": invalid ds name count", l)
+		}
+		return true, nil
+	} else if matches := valueRe.FindStringSubmatch(l); len(matches) == 3 {
+		field := strings.TrimPrefix(matches[1], "DS")
+		fv := reflect.Indirect(reflect.ValueOf(r)).FieldByName(field)
+		if !fv.IsValid() {
+			return false, NewInvalidResponseError("unknown field", l)
+		}
+		if err := decodeField(field, matches[2], l, fv); err != nil {
+			return false, err
+		}
+	}
+
+	return false, nil
+}
+
+// decodeFetchRow decodes the fetch data line l into row, whose Data must be
+// sized for the data sources, storing the known values in vals.
+func decodeFetchRow(l string, row *FetchRow, vals []float64) error {
+	parts := strings.SplitN(l, ":", 2)
+	if len(parts) != 2 {
+		return NewInvalidResponseError("fetch: unsupported value", l)
+	}
+
+	i, err := strconv.ParseInt(parts[0], 10, 64)
 	if err != nil {
-		return nil, err
+		return NewInvalidResponseError("fetch: invalid ds", l)
 	}
+	row.Time = time.Unix(i, 0)
 
-	for _, l := range lines {
-		parts := strings.SplitN(l, ":", 2)
-		if len(parts) != 2 {
-			return nil, NewInvalidResponseError("fetch: unsupported value", l)
+	fields := strings.Fields(parts[1])
+	if len(fields) != len(row.Data) {
+		return NewInvalidResponseError("fetch: invalid ds val count", l)
+	}
+
+	for i, val := range fields {
+		row.Data[i] = nil
+		if val == "nan" || val == "-nan" {
+			continue
 		}
 
-		i, err := strconv.ParseInt(parts[0], 10, 64)
+		v, err := strconv.ParseFloat(val, 64)
 		if err != nil {
-			return nil, NewInvalidResponseError("fetch: invalid ds", l)
+			return NewInvalidResponseError("fetch: invalid ds val", l)
 		}
+		vals[i] = v
+		row.Data[i] = &vals[i]
+	}
+
+	return nil
+}
+
+// Fetch returns the free text results of a fetch command with the given options,
+// which are either the positional fetch arguments or a single FetchOptions.
+func (c *Client) Fetch(filename, cf string, options ...interface{}) (*Fetch, error) {
+	return c.FetchContext(context.Background(), filename, cf, options...)
+}
+
+// FetchWithOptions returns the free text results of a fetch command with the given options.
+func (c *Client) FetchWithOptions(filename, cf string, opts FetchOptions) (*Fetch, error) {
+	return c.FetchContext(context.Background(), filename, cf, opts)
+}
 
-		fr := FetchRow{
-			Time: time.Unix(i, 0),
-			Data: make([]*float64, len(r.Names)),
+// FetchWithOptionsContext returns the free text results of a fetch command with the given options.
+func (c *Client) FetchWithOptionsContext(ctx context.Context, filename, cf string, opts FetchOptions) (*Fetch, error) {
+	return c.FetchContext(ctx, filename, cf, opts)
+}
+
+// FetchContext returns the free text results of a fetch command with the given options.
+func (c *Client) FetchContext(ctx context.Context, filename, cf string, options ...interface{}) (*Fetch, error) {
+	args, err := fetchArgs(filename, cf, options)
+	if err != nil {
+		return nil, err
+	}
+
+	r := &Fetch{}
+	var lines []string
+	err = c.do(ctx, "fetch", func() (err error) {
+		lines, err = c.fetch(ctx, "fetch", args, r)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if len(lines) > 0 {
+		r.Rows = make([]FetchRow, len(lines))
+	}
+	for i, l := range lines {
+		row := &r.Rows[i]
+		row.Data = make([]*float64, len(r.Names))
+		if err := decodeFetchRow(l, row, make([]float64, len(r.Names))); err != nil {
+			return nil, err
 		}
-		for i, val := range strings.Split(strings.TrimSpace(parts[1]), " ") {
-			if val == "nan" || val == "-nan" {
-				continue
+	}
+
+	return r, nil
+}
+
+// FetchRowFunc is the function called by FetchStream for each row, with f the
+// fetch header which has no Rows. The row is reused between calls so it must
+// be copied to be retained. If it returns ErrStopFetch the remaining rows are
+// skipped, any other error is returned by FetchStream.
+type FetchRowFunc func(f *Fetch, row *FetchRow) error
+
+// FetchStream performs a fetch command with the given options, calling fn for
+// each row as it's read instead of storing them, returning the fetch header.
+// If fn returns an error the remaining rows are discarded, so the client
+// remains usable.
+func (c *Client) FetchStream(filename, cf string, fn FetchRowFunc, options ...interface{}) (*Fetch, error) {
+	return c.FetchStreamContext(context.Background(), filename, cf, fn, options...)
+}
+
+// FetchStreamContext performs a fetch command with the given options, calling
+// fn for each row as it's read instead of storing them, returning the fetch header.
+// If fn returns an error the remaining rows are discarded, so the client
+// remains usable.
+func (c *Client) FetchStreamContext(ctx context.Context, filename, cf string, fn FetchRowFunc, options ...interface{}) (*Fetch, error) {
+	args, err := fetchArgs(filename, cf, options)
+	if err != nil {
+		return nil, err
+	}
+
+	r := &Fetch{}
+	var ferr error
+	var last time.Time
+	err = c.do(ctx, "fetch", func() error {
+		*r = Fetch{}
+		header := true
+		var row FetchRow
+		var vals []float64
+		_, err := c.execCmdFunc(ctx, NewCmd("fetch").WithArgs(args...), func(l string) error {
+			if header {
+				done, err := decodeFetchHeader("fetch", l, r)
+				if err != nil {
+					return err
+				} else if done {
+					header = false
+					row.Data = make([]*float64, len(r.Names))
+					vals = make([]float64, len(r.Names))
+				}
+				return nil
 			}
 
-			v, err := strconv.ParseFloat(val, 64)
-			if err != nil {
-				return nil, NewInvalidResponseError("fetch: invalid ds val", l)
+			if err := decodeFetchRow(l, &row, vals); err != nil {
+				return err
+			}
+
+			if !last.IsZero() && !row.Time.After(last) {
+				// Already passed to fn before a reconnect.
+				return nil
+			}
+			last = row.Time
+
+			if ferr = fn(r, &row); ferr != nil {
+				return errFetchStopped
 			}
-			fr.Data[i] = &v
+			return nil
+		})
+
+		switch {
+		case err == errFetchStopped:
+			return nil
+		case err == nil && header:
+			return NewInvalidResponseError("fetch: missing ds name")
 		}
-		r.Rows = append(r.Rows, fr)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	} else if ferr != nil && ferr != ErrStopFetch {
+		return nil, ferr
 	}
 
 	return r, nil
@@ -191,7 +403,9 @@ type FetchBinDS struct {
 	Records int
 	Size    int
 	Endian  binary.ByteOrder
-	Data    []interface{}
+
+	// Data contains the values of the records, unknown values are NaN.
+	Data []float64
 }
 
 // FetchBin represents the response from a fetchbin command.
@@ -200,6 +414,57 @@ type FetchBin struct {
 	DS []*FetchBinDS
 }
 
+// Time returns the time of the record i.
+func (f *FetchBin) Time(i int) time.Time {
+	return f.Start.Add(f.Step * time.Duration(i+1))
+}
+
+// Times returns the times of the records.
+func (f *FetchBin) Times() []time.Time {
+	times := make([]time.Time, f.rows())
+	for i := range times {
+		times[i] = f.Time(i)
+	}
+	return times
+}
+
+// rows returns the maximum number of records of the data sources.
+func (f *FetchBin) rows() int {
+	var n int
+	for _, ds := range f.DS {
+		if ds.Records > n {
+			n = ds.Records
+		}
+	}
+	return n
+}
+
+// Fetch returns f converted to the form returned by a fetch command, with
+// unknown and missing values nil.
+func (f *FetchBin) Fetch() *Fetch {
+	r := &Fetch{
+		FetchCommon: f.FetchCommon,
+		Names:       make([]string, len(f.DS)),
+		Rows:        make([]FetchRow, f.rows()),
+	}
+	for j, ds := range f.DS {
+		r.Names[j] = ds.Name
+	}
+
+	for i := range r.Rows {
+		row := FetchRow{Time: f.Time(i), Data: make([]*float64, len(f.DS))}
+		for j, ds := range f.DS {
+			if i < len(ds.Data) && !math.IsNaN(ds.Data[i]) {
+				v := ds.Data[i]
+				row.Data[j] = &v
+			}
+		}
+		r.Rows[i] = row
+	}
+
+	return r
+}
+
 // newFetchBinDS returns a new FetchBinDS created from the data in line.
 func newFetchBinDS(line string) (*FetchBinDS, error) {
 	r := &FetchBinDS{}
@@ -231,33 +496,66 @@ func newFetchBinDS(line string) (*FetchBinDS, error) {
 	return r, nil
 }
 
-// FetchBin returns the text/binary results of a fetch command with the given options.
+// FetchBin returns the text/binary results of a fetch command with the given options,
+// which are either the positional fetch arguments or a single FetchOptions.
 func (c *Client) FetchBin(filename, cf string, options ...interface{}) (*FetchBin, error) {
+	return c.FetchBinContext(context.Background(), filename, cf, options...)
+}
+
+// FetchBinWithOptions returns the text/binary results of a fetch command with the given options.
+func (c *Client) FetchBinWithOptions(filename, cf string, opts FetchOptions) (*FetchBin, error) {
+	return c.FetchBinContext(context.Background(), filename, cf, opts)
+}
+
+// FetchBinWithOptionsContext returns the text/binary results of a fetch command with the given options.
+func (c *Client) FetchBinWithOptionsContext(ctx context.Context, filename, cf string, opts FetchOptions) (*FetchBin, error) {
+	return c.FetchBinContext(ctx, filename, cf, opts)
+}
+
+// FetchBinContext returns the text/binary results of a fetch command with the given options.
+func (c *Client) FetchBinContext(ctx context.Context, filename, cf string, options ...interface{}) (*FetchBin, error) {
+	args, err := fetchArgs(filename, cf, options)
+	if err != nil {
+		return nil, err
+	}
+
 	r := &FetchBin{}
-	lines, err := c.fetch("fetchbin", filename, cf, r, options...)
+	err = c.do(ctx, "fetchbin", func() error {
+		return c.fetchBin(ctx, args, r)
+	})
 	if err != nil {
 		return nil, err
 	}
 
+	return r, nil
+}
+
+// fetchBin performs a fetchbin command storing the results in r.
+func (c *Client) fetchBin(ctx context.Context, args []interface{}, r *FetchBin) error {
+	lines, err := c.fetch(ctx, "fetchbin", args, r)
+	if err != nil {
+		return err
+	}
+
 	if len(lines) != r.Count {
-		return nil, NewInvalidResponseError("fetchbin: invalid ds count", lines...)
+		return NewInvalidResponseError("fetchbin: invalid ds count", lines...)
 	}
 
 	// The line count is actually wrong for fetchbin. We get at least 2 lines per DS,
 	// so we need to manually read more.
-	if err = c.ensureLines(&lines, r.Count*2); err != nil {
-		return nil, err
+	if err = c.ensureLines(ctx, &lines, r.Count*2); err != nil {
+		return err
 	}
 
 	var ds *FetchBinDS
 	r.DS = make([]*FetchBinDS, r.Count)
 	for i := 0; i < r.Count; i++ {
-		if err = c.ensureLines(&lines, 2); err != nil {
-			return nil, err
+		if err = c.ensureLines(ctx, &lines, 2); err != nil {
+			return err
 		}
 
 		if ds, err = newFetchBinDS(lines[0]); err != nil {
-			return nil, err
+			return err
 		}
 		r.DS[i] = ds
 
@@ -265,8 +563,8 @@ func (c *Client) FetchBin(filename, cf string, options ...interface{}) (*FetchBi
 		data := []byte(lines[1])
 		lines = lines[2:]
 		for wanted := ds.Records * ds.Size; len(data) < wanted; {
-			if err := c.ensureLines(&lines, 1); err != nil {
-				return nil, err
+			if err := c.ensureLines(ctx, &lines, 1); err != nil {
+				return err
 			}
 			data = append(data, '\n')
 			data = append(data, lines[0]...)
@@ -274,17 +572,17 @@ func (c *Client) FetchBin(filename, cf string, options ...interface{}) (*FetchBi
 		}
 
 		if err := c.readBin(ds, data); err != nil {
-			return nil, err
+			return err
 		}
 	}
 
-	return r, nil
+	return nil
 }
 
 // ensureLines ensures there's at least cnt in lines.
-func (c *Client) ensureLines(lines *[]string, cnt int) error {
+func (c *Client) ensureLines(ctx context.Context, lines *[]string, cnt int) error {
 	for len(*lines) < cnt {
-		if err := c.setDeadline(); err != nil {
+		if err := c.setDeadline(ctx); err != nil {
 			return err
 		}
 
@@ -301,23 +599,19 @@ func (c *Client) ensureLines(lines *[]string, cnt int) error {
 // readBin reads binary as specified in ds.
 func (c *Client) readBin(ds *FetchBinDS, data []byte) error {
 	r := bytes.NewReader(data)
-	ds.Data = make([]interface{}, ds.Records)
+	ds.Data = make([]float64, ds.Records)
 	switch ds.Size {
 	case 8:
-		var f float64
-		for i := range ds.Data {
-			if err := binary.Read(r, ds.Endian, &f); err != nil {
-				return err
-			}
-			ds.Data[i] = f
+		if err := binary.Read(r, ds.Endian, ds.Data); err != nil {
+			return err
 		}
 	case 4:
-		var f float32
-		for i := range ds.Data {
-			if err := binary.Read(r, ds.Endian, &f); err != nil {
-				return err
-			}
-			ds.Data[i] = f
+		f := make([]float32, ds.Records)
+		if err := binary.Read(r, ds.Endian, f); err != nil {
+			return err
+		}
+		for i, v := range f {
+			ds.Data[i] = float64(v)
 		}
 	default:
 		// We don't use l here as its binary data.
@@ -329,10 +623,94 @@ func (c *Client) readBin(ds *FetchBinDS, data []byte) error {
 // Forget requests rrdcached remove filename from the cache.
 // Any pending updates WILL BE LOST.
 func (c *Client) Forget(filename string) error {
-	_, err := c.ExecCmd(NewCmd("forget").WithArgs(filename))
+	return c.ForgetContext(context.Background(), filename)
+}
+
+// ForgetContext requests rrdcached remove filename from the cache.
+// Any pending updates WILL BE LOST.
+func (c *Client) ForgetContext(ctx context.Context, filename string) error {
+	_, err := c.ExecCmdContext(ctx, NewCmd("forget").WithArgs(filename))
 	return err
 }
 
+// Suspend requests rrdcached stop writing updates for filename to disk, for
+// example during a backup. Updates continue to be cached until it's resumed.
+func (c *Client) Suspend(filename string) error {
+	return c.SuspendContext(context.Background(), filename)
+}
+
+// SuspendContext requests rrdcached stop writing updates for filename to disk, for
+// example during a backup. Updates continue to be cached until it's resumed.
+func (c *Client) SuspendContext(ctx context.Context, filename string) error {
+	_, err := c.ExecCmdContext(ctx, NewCmd("suspend").WithArgs(filename))
+	return err
+}
+
+// Resume requests rrdcached resume writing updates for filename to disk.
+func (c *Client) Resume(filename string) error {
+	return c.ResumeContext(context.Background(), filename)
+}
+
+// ResumeContext requests rrdcached resume writing updates for filename to disk.
+func (c *Client) ResumeContext(ctx context.Context, filename string) error {
+	_, err := c.ExecCmdContext(ctx, NewCmd("resume").WithArgs(filename))
+	return err
+}
+
+// SuspendAll requests rrdcached stop writing updates for all files to disk.
+func (c *Client) SuspendAll() error {
+	return c.SuspendAllContext(context.Background())
+}
+
+// SuspendAllContext requests rrdcached stop writing updates for all files to disk.
+func (c *Client) SuspendAllContext(ctx context.Context) error {
+	_, err := c.ExecContext(ctx, "suspendall")
+	return err
+}
+
+// ResumeAll requests rrdcached resume writing updates for all files to disk.
+func (c *Client) ResumeAll() error {
+	return c.ResumeAllContext(context.Background())
+}
+
+// ResumeAllContext requests rrdcached resume writing updates for all files to disk.
+func (c *Client) ResumeAllContext(ctx context.Context) error {
+	_, err := c.ExecContext(ctx, "resumeall")
+	return err
+}
+
+// List returns the paths of the files in the cache under path, which is / for
+// all files, descending into sub-directories if recursive is true. The paths are
+// relative to path.
+func (c *Client) List(path string, recursive bool) ([]string, error) {
+	return c.ListContext(context.Background(), path, recursive)
+}
+
+// ListContext returns the paths of the files in the cache under path, which is / for
+// all files, descending into sub-directories if recursive is true. The paths are
+// relative to path.
+func (c *Client) ListContext(ctx context.Context, path string, recursive bool) ([]string, error) {
+	args := []interface{}{path}
+	if recursive {
+		args = []interface{}{"RECURSIVE", path}
+	}
+	cmd := NewCmd("list").WithArgs(args...)
+
+	lines, err := c.execLines(ctx, cmd)
+	if err != nil {
+		return nil, err
+	}
+
+	var paths []string
+	for _, l := range lines {
+		if l = strings.TrimSpace(l); l != "" {
+			paths = append(paths, l)
+		}
+	}
+
+	return paths, nil
+}
+
 // Queue represents a file queue.
 type Queue struct {
 	Size int64
@@ -341,7 +719,12 @@ type Queue struct {
 
 // Queue returns the files that are on the rrdcached output queue.
 func (c *Client) Queue(filename string) ([]*Queue, error) {
-	lines, err := c.ExecCmd(NewCmd("queue").WithArgs(filename))
+	return c.QueueContext(context.Background(), filename)
+}
+
+// QueueContext returns the files that are on the rrdcached output queue.
+func (c *Client) QueueContext(ctx context.Context, filename string) ([]*Queue, error) {
+	lines, err := c.execLines(ctx, NewCmd("queue").WithArgs(filename))
 	if err != nil {
 		return nil, err
 	}
@@ -369,11 +752,16 @@ func (c *Client) Queue(filename string) ([]*Queue, error) {
 
 // Help returns command help.
 func (c *Client) Help(cmd ...string) ([]string, error) {
+	return c.HelpContext(context.Background(), cmd...)
+}
+
+// HelpContext returns command help.
+func (c *Client) HelpContext(ctx context.Context, cmd ...string) ([]string, error) {
 	switch len(cmd) {
 	case 0:
-		return c.Exec("help")
+		return c.ExecContext(ctx, "help")
 	case 1:
-		return c.ExecCmd(NewCmd("help").WithArgs(cmd[0]))
+		return c.ExecCmdContext(ctx, NewCmd("help").WithArgs(cmd[0]))
 	default:
 		return nil, fmt.Errorf("more than one cmd specified")
 	}
@@ -394,7 +782,12 @@ type Stats struct {
 
 // Stats returns stats about rrdcached.
 func (c *Client) Stats() (*Stats, error) {
-	lines, err := c.Exec("stats")
+	return c.StatsContext(context.Background())
+}
+
+// StatsContext returns stats about rrdcached.
+func (c *Client) StatsContext(ctx context.Context) (*Stats, error) {
+	lines, err := c.ExecContext(ctx, "stats")
 	if err != nil {
 		return nil, err
 	}
@@ -420,31 +813,51 @@ func (c *Client) Stats() (*Stats, error) {
 
 // Ping sends a ping to the server.
 func (c *Client) Ping() error {
-	_, err := c.Exec("ping")
+	return c.PingContext(context.Background())
+}
+
+// PingContext sends a ping to the server.
+func (c *Client) PingContext(ctx context.Context) error {
+	_, err := c.ExecContext(ctx, "ping")
 	return err
 }
 
 // Update adds more data to filename.
 func (c *Client) Update(filename string, value Update, values ...Update) error {
+	return c.UpdateContext(context.Background(), filename, value, values...)
+}
+
+// UpdateContext adds more data to filename.
+func (c *Client) UpdateContext(ctx context.Context, filename string, value Update, values ...Update) error {
 	args := make([]interface{}, len(values)+2)
 	args[0] = filename
 	args[1] = value
 	for i, v := range values {
 		args[i+2] = v
 	}
-	_, err := c.ExecCmd(NewCmd("update").WithArgs(args...))
+	_, err := c.ExecCmdContext(ctx, NewCmd("update").WithArgs(args...))
 	return err
 }
 
 // Wrote sends a wrote command for filename to rrdcached.
 func (c *Client) Wrote(filename string) error {
-	_, err := c.ExecCmd(NewCmd("wrote").WithArgs(filename))
+	return c.WroteContext(context.Background(), filename)
+}
+
+// WroteContext sends a wrote command for filename to rrdcached.
+func (c *Client) WroteContext(ctx context.Context, filename string) error {
+	_, err := c.ExecCmdContext(ctx, NewCmd("wrote").WithArgs(filename))
 	return err
 }
 
 // First returns the timestamp of the first CDP for the given RRA.
 func (c *Client) First(filename string, rra int) (time.Time, error) {
-	return c.parseTime(c.ExecCmd(NewCmd("first").WithArgs(filename, rra)))
+	return c.FirstContext(context.Background(), filename, rra)
+}
+
+// FirstContext returns the timestamp of the first CDP for the given RRA.
+func (c *Client) FirstContext(ctx context.Context, filename string, rra int) (time.Time, error) {
+	return c.parseTime(c.ExecCmdContext(ctx, NewCmd("first").WithArgs(filename, rra)))
 }
 
 // partsTime parses the time stored in the first line and returns it
@@ -468,7 +881,12 @@ func (c *Client) parseTime(lines []string, err error) (time.Time, error) {
 
 // Last returns the timestamp of the last update to the specified RRD.
 func (c *Client) Last(filename string) (time.Time, error) {
-	return c.parseTime(c.ExecCmd(NewCmd("last").WithArgs(filename)))
+	return c.LastContext(context.Background(), filename)
+}
+
+// LastContext returns the timestamp of the last update to the specified RRD.
+func (c *Client) LastContext(ctx context.Context, filename string) (time.Time, error) {
+	return c.parseTime(c.ExecCmdContext(ctx, NewCmd("last").WithArgs(filename)))
 }
 
 // Info represents the configuration information of an RRD.
@@ -479,7 +897,12 @@ type Info struct {
 
 // Info returns the configuration information for the specified RRD.
 func (c *Client) Info(filename string) ([]*Info, error) {
-	lines, err := c.ExecCmd(NewCmd("info").WithArgs(filename))
+	return c.InfoContext(context.Background(), filename)
+}
+
+// InfoContext returns the configuration information for the specified RRD.
+func (c *Client) InfoContext(ctx context.Context, filename string) ([]*Info, error) {
+	lines, err := c.ExecCmdContext(ctx, NewCmd("info").WithArgs(filename))
 	if err != nil {
 		return nil, err
 	}
@@ -518,8 +941,36 @@ func (c *Client) Info(filename string) ([]*Info, error) {
 	return data, nil
 }
 
+// RRDInfo returns the structured configuration information for the specified RRD.
+func (c *Client) RRDInfo(filename string) (*RRDInfo, error) {
+	return c.RRDInfoContext(context.Background(), filename)
+}
+
+// RRDInfoContext returns the structured configuration information for the specified RRD.
+func (c *Client) RRDInfoContext(ctx context.Context, filename string) (*RRDInfo, error) {
+	info, err := c.InfoContext(ctx, filename)
+	if err != nil {
+		return nil, err
+	}
+
+	return NewRRDInfo(info)
+}
+
 // Create creates the RRD according to the supplied parameters.
+// If the client was created with ValidateCreate the definition is validated first.
 func (c *Client) Create(filename string, ds []DS, rra []RRA, options ...CreateOption) error {
+	return c.CreateContext(context.Background(), filename, ds, rra, options...)
+}
+
+// CreateContext creates the RRD according to the supplied parameters.
+// If the client was created with ValidateCreate the definition is validated first.
+func (c *Client) CreateContext(ctx context.Context, filename string, ds []DS, rra []RRA, options ...CreateOption) error {
+	if c.validate {
+		if err := Validate(ds, rra, options...); err != nil {
+			return err
+		}
+	}
+
 	args := []interface{}{filename}
 	for _, v := range options {
 		args = append(args, v)
@@ -530,70 +981,120 @@ func (c *Client) Create(filename string, ds []DS, rra []RRA, options ...CreateOp
 	for _, v := range rra {
 		args = append(args, v)
 	}
-	_, err := c.ExecCmd(NewCmd("create").WithArgs(args...))
+	_, err := c.ExecCmdContext(ctx, NewCmd("create").WithArgs(args...))
 	return err
 }
 
 // Batch initiates the bulk load of multiple commands.
+// If any of the commands fail an Error is returned which details all the failures,
+// use ExecBatch to obtain the individual failures.
 func (c *Client) Batch(cmds ...*Cmd) error {
-	_, err := c.Exec("batch")
+	return c.BatchContext(context.Background(), cmds...)
+}
+
+// BatchContext initiates the bulk load of multiple commands.
+// If any of the commands fail an Error is returned which details all the failures,
+// use ExecBatchContext to obtain the individual failures.
+func (c *Client) BatchContext(ctx context.Context, cmds ...*Cmd) error {
+	r, err := c.ExecBatchContext(ctx, cmds...)
 	if err != nil {
 		return err
 	}
 
+	return r.Err()
+}
+
+// ExecBatch performs the bulk load of multiple commands returning the result of each.
+func (c *Client) ExecBatch(cmds ...*Cmd) (*BatchResult, error) {
+	return c.ExecBatchContext(context.Background(), cmds...)
+}
+
+// ExecBatchContext performs the bulk load of multiple commands returning the result of each.
+func (c *Client) ExecBatchContext(ctx context.Context, cmds ...*Cmd) (*BatchResult, error) {
+	var r *BatchResult
+	err := c.do(ctx, "batch", func() (err error) {
+		r, err = c.batch(ctx, cmds...)
+		return err
+	})
+	return r, err
+}
+
+// RetryBatch performs the bulk load of the commands which failed in r.
+// If there were no failures it returns r.
+func (c *Client) RetryBatch(r *BatchResult) (*BatchResult, error) {
+	return c.RetryBatchContext(context.Background(), r)
+}
+
+// RetryBatchContext performs the bulk load of the commands which failed in r.
+// If there were no failures it returns r.
+func (c *Client) RetryBatchContext(ctx context.Context, r *BatchResult) (*BatchResult, error) {
+	if len(r.Errors) == 0 {
+		return r, nil
+	}
+
+	return c.ExecBatchContext(ctx, r.Failed()...)
+}
+
+// batch performs a batch of cmds.
+func (c *Client) batch(ctx context.Context, cmds ...*Cmd) (*BatchResult, error) {
+	_, err := c.execCmd(ctx, NewCmd("batch"))
+	if err != nil {
+		return nil, err
+	}
+
 	lines := make([]string, len(cmds)+1)
 	for i, c := range cmds {
 		lines[i] = c.String()
 	}
 	lines[len(cmds)] = ".\n"
 
-	if err = c.setDeadline(); err != nil {
-		return err
+	if err = c.setDeadline(ctx); err != nil {
+		return nil, err
 	}
 
 	if _, err = c.conn.Write([]byte(strings.Join(lines, ""))); err != nil {
-		return err
+		return nil, err
 	}
 
-	if err = c.setDeadline(); err != nil {
-		return err
+	if err = c.setDeadline(ctx); err != nil {
+		return nil, err
 	}
 
 	if !c.scanner.Scan() {
-		return c.scanErr()
+		return nil, c.scanErr()
 	}
 
 	l := c.scanner.Text()
 	matches := respRe.FindStringSubmatch(l)
 	if len(matches) != 3 {
-		return NewInvalidResponseError("batch: invalid matches", l)
+		return nil, NewInvalidResponseError("batch: invalid matches", l)
 	}
 
 	cnt, err := strconv.Atoi(matches[1])
 	if err != nil {
 		// This should be impossible given the regexp matched.
-		return NewInvalidResponseError("batch: invalid count", l)
+		return nil, NewInvalidResponseError("batch: invalid count", l)
 	}
 
 	if cnt == 0 {
-		return nil
+		return &BatchResult{Cmds: cmds}, nil
 	}
 
-	if err := c.setDeadline(); err != nil {
-		return err
+	if err := c.setDeadline(ctx); err != nil {
+		return nil, err
 	}
 	rlines := make([]string, 0, cnt)
-	for c.scanner.Scan() && len(rlines) < cnt {
+	for len(rlines) < cnt && c.scanner.Scan() {
 		rlines = append(rlines, c.scanner.Text())
-		if err := c.setDeadline(); err != nil {
-			return err
+		if err := c.setDeadline(ctx); err != nil {
+			return nil, err
 		}
 	}
 
 	if len(rlines) != cnt {
 		// Short response.
-		return c.scanErr()
+		return nil, c.scanErr()
 	}
 
-	return NewError(0-cnt, strings.Join(rlines, "\n"))
+	return newBatchResult(cmds, rlines), nil
 }
@@ -2,6 +2,8 @@ package rrd
 
 import (
 	"encoding/binary"
+	"errors"
+	"math"
 	"testing"
 	"time"
 
@@ -77,6 +79,63 @@ func TestCmds(t *testing.T) {
 		}
 
 		assert.Equal(t, expected, f)
+
+		f, err = c.Fetch("test.rrd", Average, FetchOptions{Start: "end-1d", Names: []string{"watts", "amps"}})
+		if assert.NoError(t, err) {
+			assert.Equal(t, expected, f)
+		}
+
+		f, err = c.FetchWithOptions("test.rrd", Average, FetchOptions{Start: "end-1d", Names: []string{"watts", "amps"}})
+		if assert.NoError(t, err) {
+			assert.Equal(t, expected, f)
+		}
+
+		_, err = c.Fetch("test.rrd", Average, FetchOptions{Names: []string{"bad name"}})
+		assert.Error(t, err)
+	}
+
+	fetchStream := func(t *testing.T) {
+		expected, err := c.Fetch("test.rrd", Average)
+		if !assert.NoError(t, err) {
+			return
+		}
+
+		var rows []FetchRow
+		f, err := c.FetchStream("test.rrd", Average, func(f *Fetch, row *FetchRow) error {
+			assert.Equal(t, expected.Names, f.Names)
+			r := FetchRow{Time: row.Time, Data: make([]*float64, len(row.Data))}
+			for i, v := range row.Data {
+				if v != nil {
+					v := *v
+					r.Data[i] = &v
+				}
+			}
+			rows = append(rows, r)
+			return nil
+		})
+		if !assert.NoError(t, err) {
+			return
+		}
+		assert.Equal(t, expected.Rows, rows)
+		expected.Rows = nil
+		assert.Equal(t, expected, f)
+
+		// Stopping early drains the response.
+		var n int
+		_, err = c.FetchStream("test.rrd", Average, func(f *Fetch, row *FetchRow) error {
+			n++
+			return ErrStopFetch
+		})
+		assert.NoError(t, err)
+		assert.Equal(t, 1, n)
+		assert.NoError(t, c.Ping())
+
+		errTest := errors.New("test")
+		_, err = c.FetchStream("test.rrd", Average, func(f *Fetch, row *FetchRow) error {
+			return errTest
+		})
+		assert.Equal(t, errTest, err)
+		assert.NoError(t, c.Ping())
 	}
 
 	fetchbin := func(t *testing.T) {
@@ -98,25 +157,48 @@ func TestCmds(t *testing.T) {
 					Records: 2,
 					Size:    8,
 					Endian:  binary.LittleEndian,
-					Data:    []interface{}{float64(5.432309224871e-311), float64(0)},
+					Data:    []float64{5.432309224871e-311, 0},
 				},
 				{
 					Name:    "amps",
 					Records: 1,
 					Size:    8,
 					Endian:  binary.LittleEndian,
-					Data:    []interface{}{float64(0)},
+					Data:    []float64{0},
 				},
 			},
 		}
 
 		assert.Equal(t, expected, f)
+
+		f, err = c.FetchBinWithOptions("test.rrd", Average, FetchOptions{})
+		if assert.NoError(t, err) {
+			assert.Equal(t, expected, f)
+		}
 	}
 
 	forget := func(t *testing.T) {
 		assert.NoError(t, c.Forget("test.rrd"))
 	}
 
+	suspend := func(t *testing.T) {
+		assert.NoError(t, c.Suspend("test.rrd"))
+		assert.NoError(t, c.SuspendAll())
+		assert.NoError(t, c.ResumeAll())
+
+		err := c.Resume("test.rrd")
+		if assert.Error(t, err) {
+			assert.Equal(t, &Error{Code: -1, Msg: "test.rrd not suspended"}, err)
+		}
+	}
+
+	list := func(t *testing.T) {
+		l, err := c.List("/", true)
+		if assert.NoError(t, err) {
+			assert.Equal(t, []string{"test.rrd", "sub/other.rrd"}, l)
+		}
+	}
+
 	queue := func(t *testing.T) {
 		q, err := c.Queue("test.rrd")
 		if !assert.NoError(t, err) {
@@ -203,6 +285,23 @@ func TestCmds(t *testing.T) {
 		assert.Equal(t, expected, i)
 	}
 
+	rrdinfo := func(t *testing.T) {
+		i, err := c.RRDInfo("test.rrd")
+		if !assert.NoError(t, err) {
+			return
+		}
+		assert.Equal(t, "test.rrd", i.Filename)
+		assert.Equal(t, time.Minute*5, i.Step)
+		assert.Equal(t, 1760, i.HeaderSize)
+		if assert.Len(t, i.DS, 1) {
+			assert.Equal(t, Gauge, i.DS[0].Type)
+			assert.Equal(t, time.Minute*5, i.DS[0].Heartbeat)
+			assert.Equal(t, float64(24000), i.DS[0].Max)
+			assert.Equal(t, 228, i.DS[0].UnknownSec)
+		}
+		assert.Empty(t, i.RRA)
+	}
+
 	create := func(t *testing.T) {
 		err := c.Create(
 			"test.rrd",
@@ -212,6 +311,25 @@ func TestCmds(t *testing.T) {
 		assert.NoError(t, err)
 	}
 
+	createValidate := func(t *testing.T) {
+		assert.NoError(t, ValidateCreate(c))
+		defer func() {
+			c.validate = false
+		}()
+
+		err := c.Create("test.rrd", []DS{NewDS("DS:watts:GAUGE:0:0:24000")}, nil)
+		if assert.IsType(t, &ValidationError{}, err) {
+			assert.Len(t, err.(*ValidationError).Errors, 2)
+		}
+
+		err = c.Create(
+			"test.rrd",
+			[]DS{NewGauge("watts", time.Minute*5, 0, 24000)},
+			[]RRA{NewAverage(0.5, 1, 864000)},
+		)
+		assert.NoError(t, err)
+	}
+
 	batch := func(t *testing.T) {
 		err := c.Batch(NewCmd("ping"), NewCmd("ping"))
 		if !assert.Error(t, err) {
@@ -220,6 +338,28 @@ func TestCmds(t *testing.T) {
 		assert.Equal(t, "1 Can't use 'ping' here.\n2 Can't use 'ping' here. (-2)", err.Error())
 	}
 
+	execBatch := func(t *testing.T) {
+		cmds := []*Cmd{NewCmd("ping"), NewCmd("ping")}
+		r, err := c.ExecBatch(cmds...)
+		if !assert.NoError(t, err) {
+			return
+		}
+		expected := &BatchResult{
+			Cmds: cmds,
+			Errors: []*BatchError{
+				{Index: 0, Cmd: cmds[0], Msg: "Can't use 'ping' here."},
+				{Index: 1, Cmd: cmds[1], Msg: "Can't use 'ping' here."},
+			},
+		}
+		assert.Equal(t, expected, r)
+
+		r, err = c.RetryBatch(r)
+		if !assert.NoError(t, err) {
+			return
+		}
+		assert.Len(t, r.Errors, 2)
+	}
+
 	tests := []struct {
 		name string
 		f    func(t *testing.T)
@@ -230,9 +370,12 @@ func TestCmds(t *testing.T) {
 		{"flushall", flushall},
 		{"pending", pending},
 		{"fetch", fetch},
+		{"fetch-stream", fetchStream},
 		{"fetchbin", fetchbin},
 		{"forget", forget},
 		{"queue", queue},
+		{"suspend", suspend},
+		{"list", list},
 		{"help", help},
 		{"stats", stats},
 		{"ping", ping},
@@ -241,11 +384,104 @@ func TestCmds(t *testing.T) {
 		{"first", first},
 		{"last", last},
 		{"info", info},
+		{"rrdinfo", rrdinfo},
 		{"create", create},
+		{"create-validate", createValidate},
 		{"batch", batch},
+		{"exec-batch", execBatch},
+		{"ping", ping},
 	}
 
 	for _, tc := range tests {
 		t.Run(tc.name, tc.f)
 	}
 }
+
+func TestParsePendingUpdate(t *testing.T) {
+	f := func(v float64) *float64 { return &v }
+	tests := []struct {
+		line   string
+		expect *PendingUpdate
+	}{
+		{"1499995020:10:0.3", &PendingUpdate{Time: time.Unix(1499995020, 0), Data: []*float64{f(10), f(0.3)}}},
+		{"1499995020.25:U:-1", &PendingUpdate{Time: time.Unix(1499995020, 250000000), Data: []*float64{nil, f(-1)}}},
+		{"1499995020.123456:1e3", &PendingUpdate{Time: time.Unix(1499995020, 123456000), Data: []*float64{f(1000)}}},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.line, func(t *testing.T) {
+			u, err := parsePendingUpdate(tc.line)
+			if assert.NoError(t, err) {
+				assert.Equal(t, tc.expect, u)
+			}
+		})
+	}
+
+	for _, l := range []string{"1499995020", "now:1", "1499995020:x"} {
+		_, err := parsePendingUpdate(l)
+		assert.IsType(t, &InvalidResponseError{}, err, l)
+	}
+}
+
+func TestFetchBinFetch(t *testing.T) {
+	start := time.Unix(1499908800, 0)
+	f := &FetchBin{
+		FetchCommon: FetchCommon{Start: start, End: start.Add(time.Minute * 15), Step: time.Minute * 5, Count: 2},
+		DS: []*FetchBinDS{
+			{Name: "watts", Records: 3, Size: 8, Data: []float64{1, math.NaN(), 3}},
+			{Name: "amps", Records: 2, Size: 4, Data: []float64{0.5, 1.5}},
+		},
+	}
+
+	times := []time.Time{start.Add(time.Minute * 5), start.Add(time.Minute * 10), start.Add(time.Minute * 15)}
+	assert.Equal(t, times, f.Times())
+
+	v := func(v float64) *float64 { return &v }
+	expected := &Fetch{
+		FetchCommon: f.FetchCommon,
+		Names:       []string{"watts", "amps"},
+		Rows: []FetchRow{
+			{Time: times[0], Data: []*float64{v(1), v(0.5)}},
+			{Time: times[1], Data: []*float64{nil, v(1.5)}},
+			{Time: times[2], Data: []*float64{v(3), nil}},
+		},
+	}
+	assert.Equal(t, expected, f.Fetch())
+}
+
+func TestReadBin(t *testing.T) {
+	c := &Client{}
+	data := make([]byte, 8)
+	binary.BigEndian.PutUint32(data, math.Float32bits(1.5))
+	binary.BigEndian.PutUint32(data[4:], math.Float32bits(float32(math.NaN())))
+
+	ds := &FetchBinDS{Records: 2, Size: 4, Endian: binary.BigEndian}
+	if assert.NoError(t, c.readBin(ds, data)) && assert.Len(t, ds.Data, 2) {
+		assert.Equal(t, 1.5, ds.Data[0])
+		assert.True(t, math.IsNaN(ds.Data[1]))
+	}
+
+	ds = &FetchBinDS{Records: 1, Size: 2, Endian: binary.BigEndian}
+	assert.Error(t, c.readBin(ds, data))
+}
+
+func TestDecodeFetchRow(t *testing.T) {
+	vals := make([]float64, 2)
+	row := &FetchRow{Data: make([]*float64, 2)}
+	if assert.NoError(t, decodeFetchRow("1499909100: 8.0e+00 nan", row, vals)) {
+		assert.Equal(t, time.Unix(1499909100, 0), row.Time)
+		assert.Equal(t, &vals[0], row.Data[0])
+		assert.Equal(t, float64(8), vals[0])
+		assert.Nil(t, row.Data[1])
+	}
+
+	// The row is reused.
+	if assert.NoError(t, decodeFetchRow("1499909400: -nan 1", row, vals)) {
+		assert.Nil(t, row.Data[0])
+		assert.Equal(t, float64(1), *row.Data[1])
+	}
+
+	for _, l := range []string{"1499909100 1 2", "x: 1 2", "1499909100: 1", "1499909100: 1 2 3", "1499909100: 1 x"} {
+		assert.IsType(t, &InvalidResponseError{}, decodeFetchRow(l, row, vals), l)
+	}
+}
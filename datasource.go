@@ -2,10 +2,21 @@ package rrd
 
 import (
 	"fmt"
+	"math"
+	"regexp"
+	"strconv"
 	"strings"
 	"time"
 )
 
+var (
+	// dsNameRe matches valid data source names.
+	dsNameRe = regexp.MustCompile(`^[a-zA-Z0-9_]{1,19}$`)
+
+	// dsMappingRe matches a data source name with an optional source mapping.
+	dsMappingRe = regexp.MustCompile(`^([^=\[\]]+)(?:=([^=\[\]]+)(?:\[(\d+)\])?)?$`)
+)
+
 // Data Source Types
 const (
 	Gauge    = "GAUGE"
@@ -25,6 +36,11 @@ func Mapping(name string, idx int) func(d *ds) {
 	}
 }
 
+// ValidDSName returns true if name is a valid data source name, false otherwise.
+func ValidDSName(name string) bool {
+	return dsNameRe.MatchString(name)
+}
+
 // DS represents a RRD data source.
 type DS string
 
@@ -111,7 +127,159 @@ func NewAbsolute(name string, heartbeat time.Duration, min, max int, options ...
 	return newHeatbeatDS(Absolute, name, heartbeat, options, min, max)
 }
 
+// Limit represents the minimum or maximum of a data source, which may be unbounded.
+type Limit struct {
+	v       float64
+	bounded bool
+}
+
+// Unbounded is the Limit of a data source with no minimum or maximum, U in rrdtool.
+var Unbounded = Limit{}
+
+// Bound returns the Limit v, NaN is treated as Unbounded.
+func Bound(v float64) Limit {
+	if math.IsNaN(v) {
+		return Unbounded
+	}
+	return Limit{v: v, bounded: true}
+}
+
+// Value returns the value of l and true, or NaN and false if l is Unbounded.
+func (l Limit) Value() (float64, bool) {
+	if !l.bounded {
+		return math.NaN(), false
+	}
+	return l.v, true
+}
+
+func (l Limit) String() string {
+	v, _ := l.Value()
+	return formatLimit(v)
+}
+
+// NewBoundedDS returns a new DS of type dst, which must be one which has a
+// heartbeat, with the limits min and max, either of which may be Unbounded.
+// It returns an error if min isn't less than max.
+func NewBoundedDS(dst, name string, heartbeat time.Duration, min, max Limit, options ...func(d *ds)) (DS, error) {
+	switch dst {
+	case Gauge, Counter, DCounter, Derive, DDerive, Absolute:
+	default:
+		return "", fmt.Errorf("invalid DS type %v for a bounded DS", dst)
+	}
+
+	if heartbeat < time.Second {
+		return "", fmt.Errorf("invalid DS heartbeat %v", heartbeat)
+	}
+
+	minv, ok1 := min.Value()
+	maxv, ok2 := max.Value()
+	if ok1 && ok2 && minv >= maxv {
+		return "", fmt.Errorf("DS min (%v) should be less than max (%v)", min, max)
+	}
+
+	return newHeatbeatDS(dst, name, heartbeat, options, min, max), nil
+}
+
 // NewCompute returns a new COMPUTE DS.
 func NewCompute(name, cdef string, options ...func(d *ds)) DS {
 	return newDS(Compute, name, options, cdef)
 }
+
+// DSDef represents a parsed data source definition.
+type DSDef struct {
+	Name string
+
+	// MappedName and SourceIndex identify the data source in a Source RRD
+	// which the data is copied from, if set.
+	MappedName  string
+	SourceIndex int
+
+	Type      string
+	Heartbeat time.Duration
+
+	// Min and Max are NaN if unbounded.
+	Min float64
+	Max float64
+
+	// CDEF is the RPN expression of a COMPUTE data source.
+	CDEF string
+}
+
+// ParseDS parses the data source definition d, in the form returned by the
+// DS builders, DS:name[=mapped-name[[source-index]]]:type:heartbeat:min:max
+// or DS:name:COMPUTE:rpn-expression.
+func ParseDS(d DS) (*DSDef, error) {
+	parts := strings.Split(string(d), ":")
+	if len(parts) < 4 || parts[0] != "DS" {
+		return nil, fmt.Errorf("invalid DS format: %v", d)
+	}
+
+	m := dsMappingRe.FindStringSubmatch(parts[1])
+	if m == nil {
+		return nil, fmt.Errorf("invalid DS name: %v", d)
+	}
+
+	def := &DSDef{Name: m[1], MappedName: m[2], Type: parts[2], Min: math.NaN(), Max: math.NaN()}
+	if m[3] != "" {
+		def.SourceIndex, _ = strconv.Atoi(m[3])
+	}
+
+	switch def.Type {
+	case Compute:
+		def.CDEF = strings.Join(parts[3:], ":")
+		return def, nil
+	case Gauge, Counter, DCounter, Derive, DDerive, Absolute:
+	default:
+		return nil, fmt.Errorf("invalid DS type %v: %v", def.Type, d)
+	}
+
+	if len(parts) != 6 {
+		return nil, fmt.Errorf("invalid DS format: %v", d)
+	}
+
+	hb, err := strconv.ParseInt(parts[3], 10, 64)
+	if err != nil {
+		return nil, fmt.Errorf("invalid DS heartbeat: %v", d)
+	}
+	def.Heartbeat = time.Duration(hb) * time.Second
+
+	if def.Min, err = parseLimit(parts[4]); err != nil {
+		return nil, fmt.Errorf("invalid DS min: %v", d)
+	}
+
+	if def.Max, err = parseLimit(parts[5]); err != nil {
+		return nil, fmt.Errorf("invalid DS max: %v", d)
+	}
+
+	return def, nil
+}
+
+// DS returns the data source definition of d.
+func (d *DSDef) DS() DS {
+	var options []func(d *ds)
+	if d.MappedName != "" {
+		options = append(options, Mapping(d.MappedName, d.SourceIndex))
+	}
+
+	if d.Type == Compute {
+		return newDS(d.Type, d.Name, options, d.CDEF)
+	}
+
+	return newHeatbeatDS(d.Type, d.Name, d.Heartbeat, options, Bound(d.Min), Bound(d.Max))
+}
+
+// parseLimit parses a data source min or max, where U means unbounded.
+func parseLimit(s string) (float64, error) {
+	if s == "U" {
+		return math.NaN(), nil
+	}
+	return strconv.ParseFloat(s, 64)
+}
+
+// formatLimit formats a data source min or max, where NaN means unbounded.
+func formatLimit(v float64) string {
+	if math.IsNaN(v) {
+		return "U"
+	}
+	return formatFloat(v)
+}
@@ -1,6 +1,8 @@
 package rrd
 
 import (
+	"math"
+	"strings"
 	"testing"
 	"time"
 
@@ -34,3 +36,130 @@ func TestDS(t *testing.T) {
 		})
 	}
 }
+
+func TestNewBoundedDS(t *testing.T) {
+	heartbeat := time.Minute * 2
+	tests := []struct {
+		name     string
+		dst      string
+		min, max Limit
+		options  []func(d *ds)
+		expect   string
+	}{
+		{"gauge", Gauge, Bound(0), Bound(100), nil, "DS:a:GAUGE:120:0:100"},
+		{"fractional", Gauge, Bound(-0.5), Bound(0.5), nil, "DS:a:GAUGE:120:-0.5:0.5"},
+		{"unbounded", Counter, Unbounded, Unbounded, nil, "DS:a:COUNTER:120:U:U"},
+		{"unbounded-min", Derive, Unbounded, Bound(1.5), nil, "DS:a:DERIVE:120:U:1.5"},
+		{"unbounded-max", DDerive, Bound(0), Unbounded, nil, "DS:a:DDERIVE:120:0:U"},
+		{"nan", DCounter, Bound(math.NaN()), Bound(10), nil, "DS:a:DCOUNTER:120:U:10"},
+		{"mapped", Absolute, Bound(0), Bound(1), []func(d *ds){Mapping("b", 1)}, "DS:a=b[1]:ABSOLUTE:120:0:1"},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			d, err := NewBoundedDS(tc.dst, testDS, heartbeat, tc.min, tc.max, tc.options...)
+			if assert.NoError(t, err) {
+				assert.Equal(t, tc.expect, string(d))
+			}
+		})
+	}
+
+	errs := []struct {
+		name      string
+		dst       string
+		heartbeat time.Duration
+		min, max  Limit
+	}{
+		{"min-max", Gauge, heartbeat, Bound(10), Bound(1)},
+		{"min-equal-max", Gauge, heartbeat, Bound(0.5), Bound(0.5)},
+		{"compute", Compute, heartbeat, Bound(0), Bound(1)},
+		{"type", "BOGUS", heartbeat, Bound(0), Bound(1)},
+		{"heartbeat", Gauge, 0, Bound(0), Bound(1)},
+	}
+
+	for _, tc := range errs {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := NewBoundedDS(tc.dst, testDS, tc.heartbeat, tc.min, tc.max)
+			assert.Error(t, err)
+		})
+	}
+}
+
+func TestLimit(t *testing.T) {
+	v, ok := Bound(0.25).Value()
+	assert.True(t, ok)
+	assert.Equal(t, 0.25, v)
+	assert.Equal(t, "0.25", Bound(0.25).String())
+
+	v, ok = Unbounded.Value()
+	assert.False(t, ok)
+	assert.True(t, math.IsNaN(v))
+	assert.Equal(t, "U", Unbounded.String())
+}
+
+func TestParseDS(t *testing.T) {
+	heartbeat := time.Minute * 2
+	for _, d := range []DS{
+		NewGauge(testDS, heartbeat, 0, 100),
+		NewCounter(testDS, heartbeat, 0, 100),
+		NewDCounter(testDS, heartbeat, -10, 100),
+		NewDerive(testDS, heartbeat, 0, 100),
+		NewDDerive(testDS, heartbeat, 0, 100),
+		NewAbsolute(testDS, heartbeat, 0, 100),
+		NewCompute(testDS, "result=value,UN,0,value,IF"),
+		NewGauge(testDS, heartbeat, 0, 100, Mapping("b", 1)),
+		NewDS("DS:a=b:GAUGE:120:U:0.5"),
+	} {
+		t.Run(string(d), func(t *testing.T) {
+			def, err := ParseDS(d)
+			if assert.NoError(t, err) {
+				assert.Equal(t, d, def.DS())
+			}
+		})
+	}
+
+	def, err := ParseDS(NewGauge(testDS, heartbeat, 0, 100, Mapping("b", 1)))
+	if assert.NoError(t, err) {
+		assert.Equal(t, testDS, def.Name)
+		assert.Equal(t, "b", def.MappedName)
+		assert.Equal(t, 1, def.SourceIndex)
+		assert.Equal(t, Gauge, def.Type)
+		assert.Equal(t, heartbeat, def.Heartbeat)
+		assert.Equal(t, float64(0), def.Min)
+		assert.Equal(t, float64(100), def.Max)
+	}
+
+	def, err = ParseDS(NewDS("DS:a:COUNTER:600:U:U"))
+	if assert.NoError(t, err) {
+		assert.True(t, math.IsNaN(def.Min))
+		assert.True(t, math.IsNaN(def.Max))
+	}
+
+	def, err = ParseDS(NewCompute(testDS, "x,y,+"))
+	if assert.NoError(t, err) {
+		assert.Equal(t, "x,y,+", def.CDEF)
+	}
+
+	for _, d := range []string{
+		"a:GAUGE:120:0:100",
+		"DS:a:GAUGE",
+		"DS:a=:GAUGE:120:0:100",
+		"DS:a=b[x]:GAUGE:120:0:100",
+		"DS:a:BOGUS:120:0:100",
+		"DS:a:GAUGE:120:0",
+		"DS:a:GAUGE:x:0:100",
+		"DS:a:GAUGE:120:x:100",
+		"DS:a:GAUGE:120:0:x",
+	} {
+		_, err := ParseDS(NewDS(d))
+		assert.Error(t, err, d)
+	}
+}
+
+func TestValidDSName(t *testing.T) {
+	assert.True(t, ValidDSName("watts_1"))
+	assert.True(t, ValidDSName(strings.Repeat("a", 19)))
+	assert.False(t, ValidDSName(strings.Repeat("a", 20)))
+	assert.False(t, ValidDSName(""))
+	assert.False(t, ValidDSName("bad-name"))
+}
@@ -9,6 +9,28 @@ import (
 var (
 	// ErrNilOption is returned by NewClient if an option is nil.
 	ErrNilOption = errors.New("nil option")
+
+	// ErrConnAborted is returned by Client commands after a previous command
+	// was aborted due to its context being done or the connection failing.
+	ErrConnAborted = errors.New("connection aborted")
+
+	// ErrPoolClosed is returned by Pool commands after the Pool has been closed.
+	ErrPoolClosed = errors.New("pool closed")
+
+	// ErrWriterClosed is returned by Writer methods after the Writer has been closed.
+	ErrWriterClosed = errors.New("writer closed")
+
+	// ErrStopFetch can be returned by a FetchRowFunc to stop a FetchStream without error.
+	ErrStopFetch = errors.New("stop fetch")
+
+	// errFetchStopped is used to abort reading rows once a FetchRowFunc returns an error.
+	errFetchStopped = errors.New("fetch stopped")
+
+	// ErrNoDS is reported by Validate if no data sources are defined.
+	ErrNoDS = errors.New("no data sources")
+
+	// ErrNoRRA is reported by Validate if no round robin archives are defined.
+	ErrNoRRA = errors.New("no round robin archives")
 )
 
 // Error represents a error returned from the rrdcached server.
@@ -44,6 +66,25 @@ func IsIllegalUpdate(err error) bool {
 	return ok && err2.Code == -1 && strings.HasPrefix(err2.Msg, "illegal attempt to update using time")
 }
 
+// IsUncertain returns true if err represents a failure of a non-idempotent command
+// due to a broken connection, which may or may not have been processed, false otherwise.
+func IsUncertain(err error) bool {
+	_, ok := err.(*UncertainError)
+	return ok
+}
+
+// UncertainError is the error returned by a Client with a ReconnectPolicy when
+// a non-idempotent command failed due to a broken connection, so it's unknown if
+// it was processed by the server.
+type UncertainError struct {
+	Cmd string
+	Err error
+}
+
+func (e *UncertainError) Error() string {
+	return fmt.Sprintf("%v: delivery uncertain: %v", e.Cmd, e.Err)
+}
+
 // InvalidResponseError is the error returned when the response data was invalid.
 type InvalidResponseError struct {
 	Reason string
@@ -0,0 +1,271 @@
+// Package exporter exports rrdcached statistics in the Prometheus text
+// exposition format, without any dependencies on the Prometheus libraries.
+package exporter
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/multiplay/go-rrd"
+)
+
+const (
+	// DefaultNamespace is the default prefix of the metric names.
+	DefaultNamespace = "rrdcached"
+
+	// ContentType is the content type of the text exposition format.
+	ContentType = "text/plain; version=0.0.4; charset=utf-8"
+)
+
+var (
+	// DefaultTimeout is the default maximum duration of a collection.
+	DefaultTimeout = time.Second * 10
+
+	// ErrNilOption is returned by New if an option is nil.
+	ErrNilOption = errors.New("nil option")
+)
+
+// Metric types.
+const (
+	Counter = "counter"
+	Gauge   = "gauge"
+)
+
+// Source is the interface implemented by rrd.Client and rrd.Pool which
+// provides the commands used by the Exporter.
+type Source interface {
+	StatsContext(ctx context.Context) (*rrd.Stats, error)
+	QueueContext(ctx context.Context, filename string) ([]*rrd.Queue, error)
+}
+
+// Label is a metric label.
+type Label struct {
+	Name  string
+	Value string
+}
+
+// Metric represents a sample of a metric.
+type Metric struct {
+	Name   string
+	Help   string
+	Type   string
+	Labels []Label
+	Value  float64
+}
+
+// statsMetric describes the metric exported for a field of rrd.Stats.
+type statsMetric struct {
+	name  string
+	help  string
+	typ   string
+	value func(s *rrd.Stats) int64
+}
+
+var statsMetrics = []statsMetric{
+	{"queue_length", "Number of files waiting to be written to disk.", Gauge,
+		func(s *rrd.Stats) int64 { return s.QueueLength }},
+	{"updates_received_total", "Number of update commands received.", Counter,
+		func(s *rrd.Stats) int64 { return s.UpdatesReceived }},
+	{"flushes_received_total", "Number of flush commands received.", Counter,
+		func(s *rrd.Stats) int64 { return s.FlushesReceived }},
+	{"updates_written_total", "Number of updates written to disk.", Counter,
+		func(s *rrd.Stats) int64 { return s.UpdatesWritten }},
+	{"data_sets_written_total", "Number of data sets written to disk.", Counter,
+		func(s *rrd.Stats) int64 { return s.DataSetsWritten }},
+	{"tree_nodes", "Number of nodes in the cache.", Gauge,
+		func(s *rrd.Stats) int64 { return s.TreeNodesNumber }},
+	{"tree_depth", "Depth of the cache tree.", Gauge,
+		func(s *rrd.Stats) int64 { return s.TreeDepth }},
+	{"journal_bytes_total", "Number of bytes written to the journal.", Counter,
+		func(s *rrd.Stats) int64 { return s.JournalBytes }},
+	{"journal_rotations_total", "Number of journal rotations.", Counter,
+		func(s *rrd.Stats) int64 { return s.JournalRotate }},
+}
+
+// Exporter collects rrdcached statistics and serves them in the Prometheus
+// text exposition format.
+type Exporter struct {
+	src       Source
+	namespace string
+	queue     bool
+	timeout   time.Duration
+	onError   func(err error)
+}
+
+// Namespace sets the prefix of the metric names, defaulting to DefaultNamespace.
+func Namespace(ns string) func(*Exporter) error {
+	return func(e *Exporter) error {
+		e.namespace = ns
+		return nil
+	}
+}
+
+// Queue sets the Exporter to also export the number of pending updates of each
+// file in the write queue.
+func Queue(e *Exporter) error {
+	e.queue = true
+	return nil
+}
+
+// Timeout sets the maximum duration of a collection, defaulting to DefaultTimeout.
+func Timeout(timeout time.Duration) func(*Exporter) error {
+	return func(e *Exporter) error {
+		if timeout <= 0 {
+			return fmt.Errorf("invalid timeout %v", timeout)
+		}
+		e.timeout = timeout
+		return nil
+	}
+}
+
+// OnError sets the handler ServeHTTP calls with the error of each failed
+// collection, by default the error is logged using the standard logger.
+func OnError(f func(err error)) func(*Exporter) error {
+	return func(e *Exporter) error {
+		e.onError = f
+		return nil
+	}
+}
+
+// New returns a new Exporter which collects statistics from src.
+func New(src Source, options ...func(e *Exporter) error) (*Exporter, error) {
+	e := &Exporter{src: src, namespace: DefaultNamespace, timeout: DefaultTimeout}
+	for _, f := range options {
+		if f == nil {
+			return nil, ErrNilOption
+		}
+		if err := f(e); err != nil {
+			return nil, err
+		}
+	}
+
+	return e, nil
+}
+
+// name returns the full name of the metric name.
+func (e *Exporter) name(name string) string {
+	if e.namespace == "" {
+		return name
+	}
+	return e.namespace + "_" + name
+}
+
+// Collect returns the current metrics.
+//
+// If rrdcached can't be queried only the up metric is returned with a value
+// of zero, along with the error.
+func (e *Exporter) Collect(ctx context.Context) ([]*Metric, error) {
+	ctx, cancel := context.WithTimeout(ctx, e.timeout)
+	defer cancel()
+
+	up := &Metric{Name: e.name("up"), Help: "Whether rrdcached could be queried.", Type: Gauge}
+	metrics := []*Metric{up}
+
+	s, err := e.src.StatsContext(ctx)
+	if err != nil {
+		return metrics, err
+	}
+
+	for _, m := range statsMetrics {
+		metrics = append(metrics, &Metric{
+			Name:  e.name(m.name),
+			Help:  m.help,
+			Type:  m.typ,
+			Value: float64(m.value(s)),
+		})
+	}
+
+	if e.queue {
+		q, err := e.src.QueueContext(ctx, "")
+		if err != nil {
+			return metrics[:1], err
+		}
+
+		for _, v := range q {
+			metrics = append(metrics, &Metric{
+				Name:   e.name("file_queue_length"),
+				Help:   "Number of updates pending for a file in the write queue.",
+				Type:   Gauge,
+				Labels: []Label{{Name: "file", Value: v.File}},
+				Value:  float64(v.Size),
+			})
+		}
+	}
+
+	up.Value = 1
+
+	return metrics, nil
+}
+
+// Write writes metrics to w in the text exposition format.
+// Samples of the same metric must be adjacent.
+func Write(w io.Writer, metrics []*Metric) error {
+	var buf bytes.Buffer
+	var last string
+	for _, m := range metrics {
+		if m.Name != last {
+			fmt.Fprintf(&buf, "# HELP %v %v\n", m.Name, escapeHelp(m.Help))
+			fmt.Fprintf(&buf, "# TYPE %v %v\n", m.Name, m.Type)
+			last = m.Name
+		}
+
+		buf.WriteString(m.Name)
+		if len(m.Labels) > 0 {
+			labels := make([]string, len(m.Labels))
+			for i, l := range m.Labels {
+				labels[i] = l.Name + `="` + escapeLabel(l.Value) + `"`
+			}
+			sort.Strings(labels)
+			buf.WriteString("{" + strings.Join(labels, ",") + "}")
+		}
+		buf.WriteString(" " + formatValue(m.Value) + "\n")
+	}
+
+	_, err := buf.WriteTo(w)
+	return err
+}
+
+// ServeHTTP implements http.Handler, serving the current metrics.
+func (e *Exporter) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	// Failures are also reported to clients by the up metric.
+	metrics, err := e.Collect(r.Context())
+	if err != nil {
+		if e.onError != nil {
+			e.onError(err)
+		} else {
+			log.Printf("rrdcached exporter: collect: %v", err)
+		}
+	}
+
+	w.Header().Set("Content-Type", ContentType)
+	Write(w, metrics) // nolint: errcheck
+}
+
+var (
+	helpEscaper  = strings.NewReplacer(`\`, `\\`, "\n", `\n`)
+	labelEscaper = strings.NewReplacer(`\`, `\\`, "\n", `\n`, `"`, `\"`)
+)
+
+// escapeHelp escapes s for use as help text.
+func escapeHelp(s string) string {
+	return helpEscaper.Replace(s)
+}
+
+// escapeLabel escapes s for use as a label value.
+func escapeLabel(s string) string {
+	return labelEscaper.Replace(s)
+}
+
+// formatValue formats v as a sample value.
+func formatValue(v float64) string {
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
@@ -0,0 +1,188 @@
+package exporter
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/multiplay/go-rrd"
+	"github.com/multiplay/go-rrd/server"
+	"github.com/stretchr/testify/assert"
+)
+
+// errSource is a Source which always fails.
+type errSource struct{}
+
+func (errSource) StatsContext(ctx context.Context) (*rrd.Stats, error) {
+	return nil, errors.New("stats failed")
+}
+
+func (errSource) QueueContext(ctx context.Context, filename string) ([]*rrd.Queue, error) {
+	return nil, errors.New("queue failed")
+}
+
+// staticSource is a Source returning fixed values.
+type staticSource struct {
+	stats *rrd.Stats
+	queue []*rrd.Queue
+}
+
+func (s *staticSource) StatsContext(ctx context.Context) (*rrd.Stats, error) {
+	return s.stats, nil
+}
+
+func (s *staticSource) QueueContext(ctx context.Context, filename string) ([]*rrd.Queue, error) {
+	return s.queue, nil
+}
+
+func TestNew(t *testing.T) {
+	_, err := New(errSource{}, nil)
+	assert.Equal(t, ErrNilOption, err)
+
+	_, err = New(errSource{}, Timeout(0))
+	assert.Error(t, err)
+
+	e, err := New(errSource{}, Namespace("test"), Queue, Timeout(time.Second))
+	if assert.NoError(t, err) {
+		assert.Equal(t, "test", e.namespace)
+		assert.True(t, e.queue)
+		assert.Equal(t, time.Second, e.timeout)
+	}
+}
+
+func TestWrite(t *testing.T) {
+	src := &staticSource{
+		stats: &rrd.Stats{QueueLength: 2, UpdatesReceived: 10, TreeDepth: 1},
+		queue: []*rrd.Queue{
+			{Size: 3, File: "a.rrd"},
+			{Size: 1, File: "b \"x\"\\\n.rrd"},
+		},
+	}
+
+	e, err := New(src, Queue)
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	metrics, err := e.Collect(context.Background())
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	var buf bytes.Buffer
+	if !assert.NoError(t, Write(&buf, metrics)) {
+		return
+	}
+
+	expected := []string{
+		"# HELP rrdcached_up Whether rrdcached could be queried.",
+		"# TYPE rrdcached_up gauge",
+		"rrdcached_up 1",
+		"# HELP rrdcached_queue_length Number of files waiting to be written to disk.",
+		"# TYPE rrdcached_queue_length gauge",
+		"rrdcached_queue_length 2",
+		"# HELP rrdcached_updates_received_total Number of update commands received.",
+		"# TYPE rrdcached_updates_received_total counter",
+		"rrdcached_updates_received_total 10",
+		"# TYPE rrdcached_tree_depth gauge",
+		"rrdcached_tree_depth 1",
+		"# TYPE rrdcached_journal_rotations_total counter",
+		"# HELP rrdcached_file_queue_length Number of updates pending for a file in the write queue.",
+		"# TYPE rrdcached_file_queue_length gauge",
+		`rrdcached_file_queue_length{file="a.rrd"} 3`,
+		`rrdcached_file_queue_length{file="b \"x\"\\\n.rrd"} 1`,
+	}
+	lines := strings.Split(buf.String(), "\n")
+	for _, l := range expected {
+		assert.Contains(t, lines, l)
+	}
+	assert.Equal(t, 1, strings.Count(buf.String(), "# TYPE rrdcached_file_queue_length "))
+}
+
+func TestCollectError(t *testing.T) {
+	e, err := New(errSource{}, Namespace(""))
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	metrics, err := e.Collect(context.Background())
+	assert.Error(t, err)
+	if assert.Len(t, metrics, 1) {
+		assert.Equal(t, "up", metrics[0].Name)
+		assert.Equal(t, 0.0, metrics[0].Value)
+	}
+}
+
+func TestServeHTTPError(t *testing.T) {
+	var errs []error
+	e, err := New(errSource{}, OnError(func(err error) {
+		errs = append(errs, err)
+	}))
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	w := httptest.NewRecorder()
+	e.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	assert.Contains(t, w.Body.String(), "rrdcached_up 0\n")
+	if assert.Len(t, errs, 1) {
+		assert.EqualError(t, errs[0], "stats failed")
+	}
+}
+
+func TestServeHTTP(t *testing.T) {
+	s, err := server.New(server.NewMemStore())
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if !assert.NoError(t, err) {
+		return
+	}
+	go s.Serve(l) // nolint: errcheck
+	defer func() {
+		assert.NoError(t, s.Close())
+	}()
+
+	c, err := rrd.NewClient(l.Addr().String(), rrd.Timeout(time.Second*2))
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer func() {
+		assert.NoError(t, c.Close())
+	}()
+
+	e, err := New(c, Queue)
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	srv := httptest.NewServer(e)
+	defer srv.Close()
+
+	resp, err := srv.Client().Get(srv.URL + "/metrics")
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer resp.Body.Close() // nolint: errcheck
+
+	assert.Equal(t, ContentType, resp.Header.Get("Content-Type"))
+	b, err := ioutil.ReadAll(resp.Body)
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	body := string(b)
+	assert.Contains(t, body, "rrdcached_up 1\n")
+	assert.Contains(t, body, "# TYPE rrdcached_updates_received_total counter\n")
+	assert.Contains(t, body, "rrdcached_queue_length 0\n")
+	assert.NotContains(t, body, "rrdcached_file_queue_length")
+}
@@ -0,0 +1,150 @@
+package rrd
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// defaultFetchStart and defaultFetchEnd are the rrdtool fetch defaults,
+	// used when a later positional argument is required.
+	defaultFetchStart = "end-1d"
+	defaultFetchEnd   = "now"
+)
+
+// TimeSpec represents a fetch time, either absolute as seconds since the epoch
+// or a relative rrdtool AT-style specification such as "now", "end-1h" or "start+30min".
+type TimeSpec string
+
+// At returns the absolute TimeSpec for t.
+func At(t time.Time) TimeSpec {
+	return TimeSpec(strconv.FormatInt(t.Unix(), 10))
+}
+
+// unix returns the seconds since the epoch of an absolute TimeSpec and true,
+// or false if it's relative.
+func (t TimeSpec) unix() (int64, bool) {
+	v, err := strconv.ParseInt(string(t), 10, 64)
+	return v, err == nil
+}
+
+// FetchOptions are the typed options for the fetch and fetchbin commands, as
+// taken by FetchWithOptions and FetchBinWithOptions. A FetchOptions or
+// *FetchOptions can also be passed as the only option to Fetch and FetchBin in
+// place of the positional arguments.
+type FetchOptions struct {
+	// Start is the start of the time range, defaulting to end-1d.
+	Start TimeSpec
+
+	// End is the end of the time range, defaulting to now.
+	End TimeSpec
+
+	// Resolution is the requested interval between rows.
+	// The fetch command has no resolution argument so, as recommended by
+	// rrdtool, Start and End are aligned to it instead, which causes the RRA
+	// with that resolution to be selected if it covers them. Relative times
+	// can't be aligned, so if set both Start and End must be absolute.
+	Resolution time.Duration
+
+	// Names restricts the data sources returned, all are returned if empty.
+	Names []string
+}
+
+// Validate returns an error if o isn't valid.
+func (o *FetchOptions) Validate() error {
+	for _, t := range []TimeSpec{o.Start, o.End} {
+		if strings.ContainsAny(string(t), " \t\r\n") {
+			return fmt.Errorf("fetch: invalid time %q", t)
+		}
+	}
+
+	if o.Resolution < 0 || o.Resolution%time.Second != 0 {
+		return fmt.Errorf("fetch: invalid resolution %v", o.Resolution)
+	}
+
+	start, ok1 := o.Start.unix()
+	end, ok2 := o.End.unix()
+	if o.Resolution > 0 && (!ok1 || !ok2) {
+		return fmt.Errorf("fetch: resolution requires an absolute start and end")
+	}
+
+	if ok1 && ok2 && start >= end {
+		return fmt.Errorf("fetch: start (%v) should be less than end (%v)", start, end)
+	}
+
+	for _, n := range o.Names {
+		if !dsNameRe.MatchString(n) {
+			return fmt.Errorf("fetch: invalid ds name %q", n)
+		}
+	}
+
+	return nil
+}
+
+// args returns the positional fetch arguments for o, after the filename and CF.
+func (o *FetchOptions) args() ([]interface{}, error) {
+	if err := o.Validate(); err != nil {
+		return nil, err
+	}
+
+	start, end := o.Start, o.End
+	if res := int64(o.Resolution / time.Second); res > 0 {
+		if v, ok := start.unix(); ok {
+			start = TimeSpec(strconv.FormatInt(v-v%res, 10))
+		}
+		if v, ok := end.unix(); ok {
+			end = TimeSpec(strconv.FormatInt(v-v%res, 10))
+		}
+	}
+
+	var args []interface{}
+	switch {
+	case len(o.Names) > 0 || end != "":
+		if start == "" {
+			start = defaultFetchStart
+		}
+		if end == "" {
+			end = defaultFetchEnd
+		}
+		args = append(args, start, end)
+	case start != "":
+		args = append(args, start)
+	}
+
+	for _, n := range o.Names {
+		args = append(args, n)
+	}
+
+	return args, nil
+}
+
+// fetchArgs returns the arguments of a fetch command for options, rendering
+// FetchOptions if given.
+func fetchArgs(filename, cf string, options []interface{}) ([]interface{}, error) {
+	args := []interface{}{filename, cf}
+	for _, v := range options {
+		var o *FetchOptions
+		switch v := v.(type) {
+		case FetchOptions:
+			o = &v
+		case *FetchOptions:
+			o = v
+		default:
+			continue
+		}
+
+		if len(options) != 1 {
+			return nil, fmt.Errorf("fetch: FetchOptions must be the only option")
+		}
+
+		oargs, err := o.args()
+		if err != nil {
+			return nil, err
+		}
+		return append(args, oargs...), nil
+	}
+
+	return append(args, options...), nil
+}
@@ -0,0 +1,67 @@
+package rrd
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFetchOptions(t *testing.T) {
+	start := time.Unix(1499908810, 0)
+	end := time.Unix(1499995510, 0)
+	tests := []struct {
+		name     string
+		options  []interface{}
+		expected []interface{}
+	}{
+		{"none", nil, nil},
+		{"positional", []interface{}{int64(1), int64(2)}, []interface{}{int64(1), int64(2)}},
+		{"empty", []interface{}{FetchOptions{}}, nil},
+		{"start", []interface{}{&FetchOptions{Start: At(start)}}, []interface{}{TimeSpec("1499908810")}},
+		{"end", []interface{}{FetchOptions{End: "now-1h"}}, []interface{}{TimeSpec("end-1d"), TimeSpec("now-1h")}},
+		{"range", []interface{}{FetchOptions{Start: "end-2h", End: At(end)}}, []interface{}{TimeSpec("end-2h"), TimeSpec("1499995510")}},
+		{
+			"resolution",
+			[]interface{}{FetchOptions{Start: At(start), End: At(end), Resolution: time.Minute * 5}},
+			[]interface{}{TimeSpec("1499908800"), TimeSpec("1499995500")},
+		},
+		{
+			"names",
+			[]interface{}{FetchOptions{Names: []string{"watts", "amps"}}},
+			[]interface{}{TimeSpec("end-1d"), TimeSpec("now"), "watts", "amps"},
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			args, err := fetchArgs("test.rrd", Average, tc.options)
+			if assert.NoError(t, err) {
+				assert.Equal(t, append([]interface{}{"test.rrd", Average}, tc.expected...), args)
+			}
+		})
+	}
+}
+
+func TestFetchOptionsInvalid(t *testing.T) {
+	tests := []struct {
+		name    string
+		options []interface{}
+	}{
+		{"time", []interface{}{FetchOptions{Start: "noon yesterday"}}},
+		{"range", []interface{}{FetchOptions{Start: At(time.Unix(2, 0)), End: At(time.Unix(1, 0))}}},
+		{"resolution", []interface{}{FetchOptions{Resolution: time.Millisecond}}},
+		{"negative-resolution", []interface{}{FetchOptions{Resolution: -time.Second}}},
+		{"relative-resolution", []interface{}{FetchOptions{Start: "end-1d", End: At(time.Unix(1, 0)), Resolution: time.Minute}}},
+		{"default-resolution", []interface{}{FetchOptions{Resolution: time.Minute}}},
+		{"name", []interface{}{FetchOptions{Names: []string{"not valid"}}}},
+		{"mixed", []interface{}{FetchOptions{}, "watts"}},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := fetchArgs("test.rrd", Average, tc.options)
+			assert.Error(t, err)
+		})
+	}
+}
@@ -0,0 +1,453 @@
+// Package graphite provides a bridge which accepts metrics using the Graphite
+// plaintext protocol and writes them to rrdcached.
+//
+// Each metric is written to its own RRD, with a single data source, which is
+// created on demand the first time the metric is seen.
+package graphite
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"net"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/multiplay/go-rrd"
+	"github.com/multiplay/go-rrd/internal/ingest"
+)
+
+var (
+	// DefaultTimeout is the default maximum duration of the create command
+	// issued for a new metric.
+	DefaultTimeout = time.Second * 10
+
+	// ErrNilOption is returned by New if an option is nil.
+	ErrNilOption = errors.New("nil option")
+
+	// ErrBridgeClosed is returned by Serve, WriteLine and Close after Close has been called.
+	ErrBridgeClosed = errors.New("bridge closed")
+)
+
+// DefaultSchema returns the schema used to create the RRDs of metrics which
+// don't match a Rule with its own Schema.
+//
+// It has a step of one minute, a single GAUGE data source called value and
+// averages for a day at one minute, a week at five minutes and a year at one
+// hour, as well as the hourly maximum for a year.
+func DefaultSchema() *rrd.Schema {
+	return &rrd.Schema{
+		Step: time.Minute,
+		DS:   []rrd.DS{rrd.NewDS("DS:value:GAUGE:120:U:U")},
+		RRA: []rrd.RRA{
+			rrd.NewAverage(0.5, 1, 1440),
+			rrd.NewAverage(0.5, 5, 2016),
+			rrd.NewAverage(0.5, 60, 8760),
+			rrd.NewMax(0.5, 60, 8760),
+		},
+	}
+}
+
+// Client is the interface implemented by rrd.Client and rrd.Pool which
+// provides the commands used by a Bridge.
+type Client interface {
+	rrd.Batcher
+	CreateContext(ctx context.Context, filename string, ds []rrd.DS, rra []rrd.RRA, options ...rrd.CreateOption) error
+}
+
+// Rule maps the metrics whose path matches Pattern to an RRD.
+type Rule struct {
+	Pattern *regexp.Regexp
+
+	// Filename is the name of the RRD relative to the base directory of
+	// rrdcached, in which $1 or ${name} are replaced by the submatches of
+	// Pattern as for regexp.Expand.
+	Filename string
+
+	// Schema is used to create the RRD if it doesn't exist, if nil the
+	// default schema of the Bridge is used.
+	Schema *rrd.Schema
+}
+
+// NewRule returns a new Rule which maps the metrics matching the regular
+// expression pattern to filename, creating missing RRDs with schema.
+func NewRule(pattern, filename string, schema *rrd.Schema) (*Rule, error) {
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Rule{Pattern: re, Filename: filename, Schema: schema}, nil
+}
+
+// filename returns the RRD filename for metric and true if metric matches
+// the rule, otherwise false.
+func (r *Rule) filename(metric string) (string, bool) {
+	m := r.Pattern.FindStringSubmatchIndex(metric)
+	if m == nil {
+		return "", false
+	}
+
+	return string(r.Pattern.ExpandString(nil, r.Filename, metric, m)), true
+}
+
+// LineError represents a line which couldn't be processed.
+type LineError = ingest.LineError
+
+// CreateError represents the failure to create the RRD of a metric.
+type CreateError = ingest.CreateError
+
+// Bridge accepts metrics using the Graphite plaintext protocol, writing them
+// to rrdcached using a rrd.Writer which batches the updates. It's goroutine safe.
+//
+// Each line has the form "metric.path value timestamp", where timestamp is
+// in seconds since the epoch or -1 for now.
+type Bridge struct {
+	c             Client
+	w             *rrd.Writer
+	rules         []*Rule
+	schema        *rrd.Schema
+	timeout       time.Duration
+	onError       func(err error)
+	writerOptions []func(w *rrd.Writer) error
+
+	creator *ingest.Creator
+
+	closers map[io.Closer]struct{}
+	done    chan struct{}
+	wg      sync.WaitGroup
+	mtx     sync.Mutex
+}
+
+// Rules sets the rules used to map metrics to RRDs, the first which matches
+// is used. If no rules are set the dots of the metric path are replaced by
+// slashes and .rrd appended, otherwise metrics which match no rule are dropped.
+func Rules(rules ...*Rule) func(*Bridge) error {
+	return func(b *Bridge) error {
+		for _, r := range rules {
+			if r == nil || r.Pattern == nil {
+				return errors.New("invalid rule: missing pattern")
+			}
+			if err := checkSchema(r.Schema); err != nil {
+				return err
+			}
+		}
+		b.rules = rules
+		return nil
+	}
+}
+
+// Schema sets the schema used to create the RRDs of metrics which don't match
+// a Rule with its own Schema, defaulting to DefaultSchema.
+func Schema(s *rrd.Schema) func(*Bridge) error {
+	return func(b *Bridge) error {
+		if s == nil {
+			return errors.New("invalid schema: nil")
+		}
+		if err := checkSchema(s); err != nil {
+			return err
+		}
+		b.schema = s
+		return nil
+	}
+}
+
+// Timeout sets the maximum duration of the create command issued for a new
+// metric, defaulting to DefaultTimeout.
+func Timeout(timeout time.Duration) func(*Bridge) error {
+	return func(b *Bridge) error {
+		if timeout <= 0 {
+			return fmt.Errorf("invalid timeout %v", timeout)
+		}
+		b.timeout = timeout
+		return nil
+	}
+}
+
+// OnError sets the handler a Bridge calls for each line received by Serve
+// which failed. The error is a *LineError, *CreateError or, for failed
+// updates, a *rrd.WriteError. It's called from the connection and flushing
+// goroutines so should not block.
+func OnError(f func(err error)) func(*Bridge) error {
+	return func(b *Bridge) error {
+		b.onError = f
+		return nil
+	}
+}
+
+// WriterOptions sets the options used to create the rrd.Writer of a Bridge.
+func WriterOptions(options ...func(w *rrd.Writer) error) func(*Bridge) error {
+	return func(b *Bridge) error {
+		b.writerOptions = options
+		return nil
+	}
+}
+
+// New returns a new Bridge which writes metrics using c.
+func New(c Client, options ...func(b *Bridge) error) (*Bridge, error) {
+	b := &Bridge{
+		c:       c,
+		schema:  DefaultSchema(),
+		timeout: DefaultTimeout,
+		creator: ingest.NewCreator(c),
+		closers: make(map[io.Closer]struct{}),
+		done:    make(chan struct{}),
+	}
+	for _, f := range options {
+		if f == nil {
+			return nil, ErrNilOption
+		}
+		if err := f(b); err != nil {
+			return nil, err
+		}
+	}
+
+	onError := rrd.OnError(func(err *rrd.WriteError) {
+		b.report(err)
+	})
+	w, err := rrd.NewWriter(c, append([]func(w *rrd.Writer) error{onError}, b.writerOptions...)...)
+	if err != nil {
+		return nil, err
+	}
+	b.w = w
+
+	return b, nil
+}
+
+// checkSchema returns an error if s can't be used for a metric.
+func checkSchema(s *rrd.Schema) error {
+	if s != nil && len(s.DS) != 1 {
+		return fmt.Errorf("invalid schema: %v data sources, must be 1", len(s.DS))
+	}
+	return nil
+}
+
+// ListenAndServe listens on the network address addr and then calls Serve.
+// Network must be a stream network such as "tcp" or "unix".
+func (b *Bridge) ListenAndServe(network, addr string) error {
+	l, err := net.Listen(network, addr)
+	if err != nil {
+		return err
+	}
+
+	return b.Serve(l)
+}
+
+// Serve accepts connections on l, processing the lines they send until the Bridge is closed.
+// It always returns a non-nil error, ErrBridgeClosed after Close.
+func (b *Bridge) Serve(l net.Listener) error {
+	if !b.track(l) {
+		l.Close() // nolint: errcheck
+		return ErrBridgeClosed
+	}
+	defer b.untrack(l)
+
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			if !b.running() {
+				return ErrBridgeClosed
+			}
+			return err
+		}
+
+		if !b.track(conn) {
+			conn.Close() // nolint: errcheck
+			return ErrBridgeClosed
+		}
+
+		b.wg.Add(1)
+		go b.handle(conn)
+	}
+}
+
+// track records c so it's closed by Close, returning false if the bridge is already closed.
+func (b *Bridge) track(c io.Closer) bool {
+	b.mtx.Lock()
+	defer b.mtx.Unlock()
+
+	if !b.running() {
+		return false
+	}
+	b.closers[c] = struct{}{}
+
+	return true
+}
+
+// untrack removes c from the tracked closers.
+func (b *Bridge) untrack(c io.Closer) {
+	b.mtx.Lock()
+	delete(b.closers, c)
+	b.mtx.Unlock()
+}
+
+// running returns true unless Close has been called, false otherwise.
+func (b *Bridge) running() bool {
+	select {
+	case <-b.done:
+		return false
+	default:
+		return true
+	}
+}
+
+// handle processes the lines sent by a client connection.
+func (b *Bridge) handle(conn net.Conn) {
+	defer func() {
+		conn.Close() // nolint: errcheck
+		b.untrack(conn)
+		b.wg.Done()
+	}()
+
+	b.read(conn)
+}
+
+// read processes the lines read from r until EOF, reporting any failures.
+func (b *Bridge) read(r io.Reader) {
+	sc := bufio.NewScanner(r)
+	for sc.Scan() {
+		l := strings.TrimSpace(sc.Text())
+		if l == "" {
+			continue
+		}
+
+		if err := b.WriteLine(l); err != nil {
+			if err == ErrBridgeClosed {
+				return
+			}
+			b.report(err)
+		}
+	}
+}
+
+// report calls the OnError handler, if set, with err.
+func (b *Bridge) report(err error) {
+	if b.onError != nil {
+		b.onError(err)
+	}
+}
+
+// WriteLine processes the Graphite plaintext line, creating the RRD of the
+// metric if needed and buffering the update. It returns a *LineError if the
+// line is invalid or matches no rule and a *CreateError if the RRD couldn't be created.
+func (b *Bridge) WriteLine(line string) error {
+	if !b.running() {
+		return ErrBridgeClosed
+	}
+
+	metric, value, ts, err := parseLine(line)
+	if err != nil {
+		return err
+	}
+
+	filename, schema, ok := b.match(metric)
+	if !ok {
+		return &LineError{Line: line, Msg: "no matching rule"}
+	}
+
+	if !ingest.ValidFilename(filename) {
+		return &LineError{Line: line, Msg: fmt.Sprintf("invalid filename %q", filename)}
+	}
+
+	if err = b.create(filename, schema, ts); err != nil {
+		return &CreateError{Metric: metric, Filename: filename, Err: err}
+	}
+
+	u, err := rrd.NewUpdateBuilder().Update(ts, value)
+	if err != nil {
+		return &LineError{Line: line, Msg: err.Error()}
+	}
+
+	if err = b.w.Write(filename, u); err == rrd.ErrWriterClosed {
+		return ErrBridgeClosed
+	}
+	return err
+}
+
+// match returns the filename and schema of metric and true if it's mapped to an RRD.
+func (b *Bridge) match(metric string) (string, *rrd.Schema, bool) {
+	if len(b.rules) == 0 {
+		return strings.Replace(metric, ".", "/", -1) + ".rrd", b.schema, true
+	}
+
+	for _, r := range b.rules {
+		if f, ok := r.filename(metric); ok {
+			if r.Schema != nil {
+				return f, r.Schema, true
+			}
+			return f, b.schema, true
+		}
+	}
+
+	return "", nil, false
+}
+
+// create creates filename using schema, with a start time before ts, unless
+// it's already known to exist.
+func (b *Bridge) create(filename string, schema *rrd.Schema, ts time.Time) error {
+	ctx, cancel := context.WithTimeout(context.Background(), b.timeout)
+	defer cancel()
+
+	return b.creator.Create(ctx, filename, schema, ts)
+}
+
+// parseLine parses the Graphite plaintext line.
+func parseLine(line string) (string, float64, time.Time, error) {
+	fields := strings.Fields(line)
+	if len(fields) != 3 {
+		return "", 0, time.Time{}, &LineError{Line: line, Msg: "expected metric, value and timestamp"}
+	}
+
+	metric := fields[0]
+	for _, p := range strings.Split(metric, ".") {
+		if p == "" {
+			return "", 0, time.Time{}, &LineError{Line: line, Msg: "invalid metric path"}
+		}
+	}
+
+	value, err := strconv.ParseFloat(fields[1], 64)
+	if err != nil {
+		return "", 0, time.Time{}, &LineError{Line: line, Msg: "invalid value"}
+	}
+
+	ts, err := strconv.ParseFloat(fields[2], 64)
+	switch {
+	case err != nil || math.IsNaN(ts) || math.IsInf(ts, 0) || (ts < 0 && ts != -1):
+		return "", 0, time.Time{}, &LineError{Line: line, Msg: "invalid timestamp"}
+	case ts == -1:
+		return metric, value, time.Now(), nil
+	}
+
+	return metric, value, time.Unix(int64(ts), 0), nil
+}
+
+// Flush writes all buffered updates to rrdcached.
+func (b *Bridge) Flush() error {
+	return b.w.Flush()
+}
+
+// Close stops the bridge, closing all listeners and connections and writing
+// all buffered updates. It doesn't close the underlying Client.
+func (b *Bridge) Close() error {
+	b.mtx.Lock()
+	if !b.running() {
+		b.mtx.Unlock()
+		return ErrBridgeClosed
+	}
+	close(b.done)
+
+	for c := range b.closers {
+		c.Close() // nolint: errcheck
+	}
+	b.mtx.Unlock()
+
+	b.wg.Wait()
+
+	return b.w.Close()
+}
@@ -0,0 +1,232 @@
+package graphite
+
+import (
+	"fmt"
+	"net"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/multiplay/go-rrd"
+	"github.com/multiplay/go-rrd/internal/testserver"
+	"github.com/stretchr/testify/assert"
+)
+
+var testStart = time.Unix(1500000000, 0)
+
+// newTestBridge returns a new Bridge writing to a running in-tree server and a client connected to it.
+func newTestBridge(t *testing.T, options ...func(b *Bridge) error) (*Bridge, *rrd.Client, func()) {
+	t.Helper()
+
+	p, c, cleanup := testserver.Start(t)
+	b, err := New(p, options...)
+	if err != nil {
+		cleanup()
+		t.Fatal(err)
+	}
+
+	return b, c, func() {
+		b.Close() // nolint: errcheck
+		cleanup()
+	}
+}
+
+func TestParseLine(t *testing.T) {
+	tests := []struct {
+		line   string
+		metric string
+		value  float64
+		ts     time.Time
+		err    bool
+	}{
+		{line: "a.b.c 1.5 1500000000", metric: "a.b.c", value: 1.5, ts: testStart},
+		{line: "a 10 1500000000.7", metric: "a", value: 10, ts: testStart},
+		{line: "a.b", err: true},
+		{line: "a.b 1 2 3", err: true},
+		{line: "a..b 1 1500000000", err: true},
+		{line: ".a 1 1500000000", err: true},
+		{line: "a x 1500000000", err: true},
+		{line: "a 1 x", err: true},
+		{line: "a 1 -5", err: true},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.line, func(t *testing.T) {
+			metric, value, ts, err := parseLine(tc.line)
+			if tc.err {
+				assert.IsType(t, &LineError{}, err)
+				return
+			}
+			if assert.NoError(t, err) {
+				assert.Equal(t, tc.metric, metric)
+				assert.Equal(t, tc.value, value)
+				assert.True(t, tc.ts.Equal(ts))
+			}
+		})
+	}
+
+	_, _, ts, err := parseLine("a 1 -1")
+	if assert.NoError(t, err) {
+		assert.WithinDuration(t, time.Now(), ts, time.Second)
+	}
+}
+
+func TestMatch(t *testing.T) {
+	schema := DefaultSchema()
+	schema.Step = time.Second * 10
+
+	hosts, err := NewRule(`^servers\.([^.]+)\.(.+)$`, "hosts/$1/$2.rrd", schema)
+	if !assert.NoError(t, err) {
+		return
+	}
+	all, err := NewRule(`^(?P<name>.+)$`, "other/${name}.rrd", nil)
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	_, err = NewRule(`(`, "x.rrd", nil)
+	assert.Error(t, err)
+
+	b := &Bridge{schema: DefaultSchema()}
+	f, s, ok := b.match("a.b.c")
+	assert.True(t, ok)
+	assert.Equal(t, "a/b/c.rrd", f)
+	assert.Equal(t, b.schema, s)
+
+	b.rules = []*Rule{hosts, all}
+	tests := []struct {
+		metric   string
+		filename string
+		schema   *rrd.Schema
+	}{
+		{"servers.web1.cpu", "hosts/web1/cpu.rrd", schema},
+		{"servers.web1.load.1m", "hosts/web1/load.1m.rrd", schema},
+		{"app.requests", "other/app.requests.rrd", b.schema},
+	}
+
+	for _, tc := range tests {
+		f, s, ok := b.match(tc.metric)
+		if assert.True(t, ok, tc.metric) {
+			assert.Equal(t, tc.filename, f, tc.metric)
+			assert.Equal(t, tc.schema, s, tc.metric)
+		}
+	}
+
+	b.rules = []*Rule{hosts}
+	_, _, ok = b.match("app.requests")
+	assert.False(t, ok)
+}
+
+func TestNew(t *testing.T) {
+	_, err := New(nil, nil)
+	assert.Equal(t, ErrNilOption, err)
+
+	_, err = New(nil, Schema(&rrd.Schema{}))
+	assert.Error(t, err)
+
+	_, err = New(nil, Rules(&Rule{}))
+	assert.Error(t, err)
+
+	_, err = New(nil, Timeout(0))
+	assert.Error(t, err)
+}
+
+func TestBridge(t *testing.T) {
+	var mtx sync.Mutex
+	var errs []error
+	onError := OnError(func(err error) {
+		mtx.Lock()
+		errs = append(errs, err)
+		mtx.Unlock()
+	})
+
+	b, c, cleanup := newTestBridge(t, onError, WriterOptions(rrd.FlushInterval(0)))
+	defer cleanup()
+
+	var lines []string
+	for i := 0; i < 3; i++ {
+		ts := testStart.Add(time.Minute * time.Duration(i)).Unix()
+		lines = append(lines,
+			fmt.Sprintf("servers.web1.cpu %v %v", i, ts),
+			fmt.Sprintf("servers.web2.cpu %v %v", i*2, ts),
+		)
+	}
+	lines = append(lines, "invalid", "", "a..b 1 1500000000")
+
+	b.read(strings.NewReader(strings.Join(lines, "\n")))
+	if !assert.NoError(t, b.Flush()) {
+		return
+	}
+
+	mtx.Lock()
+	if assert.Len(t, errs, 2) {
+		assert.IsType(t, &LineError{}, errs[0])
+		assert.IsType(t, &LineError{}, errs[1])
+	}
+	mtx.Unlock()
+
+	for _, f := range []string{"servers/web1/cpu.rrd", "servers/web2/cpu.rrd"} {
+		last, err := c.Last(f)
+		if assert.NoError(t, err, f) {
+			assert.True(t, testStart.Add(time.Minute*2).Equal(last), f)
+		}
+	}
+
+	info, err := c.RRDInfo("servers/web1/cpu.rrd")
+	if assert.NoError(t, err) {
+		assert.Equal(t, time.Minute, info.Step)
+		if assert.Len(t, info.DS, 1) {
+			assert.Equal(t, "value", info.DS[0].Name)
+		}
+	}
+
+	// A new bridge doesn't know the files exist, so relies on NoOverwrite.
+	b2, err := New(c)
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.NoError(t, b2.WriteLine(fmt.Sprintf("servers.web1.cpu 5 %v", testStart.Add(time.Minute*3).Unix())))
+	assert.NoError(t, b2.Close())
+
+	last, err := c.Last("servers/web1/cpu.rrd")
+	if assert.NoError(t, err) {
+		assert.True(t, testStart.Add(time.Minute*3).Equal(last))
+	}
+
+	assert.Equal(t, ErrBridgeClosed, b2.WriteLine("a 1 1500000000"))
+	assert.Equal(t, ErrBridgeClosed, b2.Close())
+}
+
+func TestBridgeServe(t *testing.T) {
+	b, c, cleanup := newTestBridge(t, WriterOptions(rrd.FlushSize(1)))
+	defer cleanup()
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if !assert.NoError(t, err) {
+		return
+	}
+	go b.Serve(l) // nolint: errcheck
+
+	conn, err := net.Dial("tcp", l.Addr().String())
+	if !assert.NoError(t, err) {
+		return
+	}
+	_, err = fmt.Fprintf(conn, "app.requests 42 %v\n", testStart.Unix())
+	assert.NoError(t, err)
+	assert.NoError(t, conn.Close())
+
+	// The line is processed asynchronously.
+	deadline := time.Now().Add(time.Second * 5)
+	for {
+		last, err := c.Last("app/requests.rrd")
+		if err == nil && testStart.Equal(last) {
+			break
+		}
+		if time.Now().After(deadline) {
+			assert.Fail(t, "update not written", "last: %v, err: %v", last, err)
+			break
+		}
+		time.Sleep(time.Millisecond * 10)
+	}
+}
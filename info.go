@@ -0,0 +1,345 @@
+package rrd
+
+import (
+	"fmt"
+	"math"
+	"regexp"
+	"sort"
+	"strconv"
+	"time"
+)
+
+var (
+	infoKeyRe     = regexp.MustCompile(`^(ds|rra)\[([^\]]+)\]\.(.+)$`)
+	infoCDPPrepRe = regexp.MustCompile(`^cdp_prep\[(\d+)\]\.(\w+)$`)
+)
+
+// DSInfo represents the definition and state of a data source of an RRD.
+type DSInfo struct {
+	Name      string
+	Index     int
+	Type      string
+	Heartbeat time.Duration
+
+	// Min and Max are NaN if the data source is unbounded.
+	Min float64
+	Max float64
+
+	// CDEF is the RPN expression of a COMPUTE data source.
+	CDEF string
+
+	LastDS     string
+	Value      float64
+	UnknownSec int
+}
+
+// CDPPrepInfo represents the consolidation state of a data source in an RRA.
+//
+// Which fields are reported depends on the consolidation function of the RRA:
+// Value and UnknownDatapoints for AVERAGE, MIN, MAX and LAST, Intercept, Slope
+// and NaNCount for HWPREDICT and MHWPREDICT, Seasonal for SEASONAL and
+// Deviation for DEVSEASONAL. Floats which aren't reported are NaN.
+type CDPPrepInfo struct {
+	Value             float64
+	UnknownDatapoints int
+
+	Intercept float64
+	Slope     float64
+	NaNCount  int
+	Seasonal  float64
+	Deviation float64
+}
+
+// RRAInfo represents the definition and state of a round robin archive of an RRD.
+type RRAInfo struct {
+	CF        string
+	Rows      int
+	CurRow    int
+	PDPPerRow int
+
+	// XFF is NaN for RRAs which don't have an xfiles factor.
+	XFF float64
+
+	// Alpha and Beta are the parameters of HWPREDICT and MHWPREDICT, Gamma
+	// and SmoothingWindow of SEASONAL and DEVSEASONAL and DeltaPos, DeltaNeg,
+	// FailureThreshold and WindowLength of FAILURES.
+	// Floats which aren't reported are NaN.
+	Alpha            float64
+	Beta             float64
+	Gamma            float64
+	SmoothingWindow  float64
+	DeltaPos         float64
+	DeltaNeg         float64
+	FailureThreshold int
+	WindowLength     int
+
+	// CDPPrep contains the consolidation state of each data source.
+	CDPPrep []*CDPPrepInfo
+}
+
+// RRDInfo represents the structured configuration information of an RRD.
+type RRDInfo struct {
+	Filename   string
+	Version    string
+	Step       time.Duration
+	LastUpdate time.Time
+	HeaderSize int
+
+	// DS contains the data sources ordered by index.
+	DS  []*DSInfo
+	RRA []*RRAInfo
+}
+
+// NewRRDInfo returns a new RRDInfo parsed from the configuration information
+// returned by Info. Keys it doesn't recognise are ignored.
+func NewRRDInfo(info []*Info) (*RRDInfo, error) {
+	r := &RRDInfo{}
+	dss := make(map[string]*DSInfo)
+	for _, i := range info {
+		var err error
+		if m := infoKeyRe.FindStringSubmatch(i.Key); m != nil {
+			if m[1] == "ds" {
+				ds, ok := dss[m[2]]
+				if !ok {
+					ds = &DSInfo{Name: m[2], Index: len(r.DS), Min: math.NaN(), Max: math.NaN(), Value: math.NaN()}
+					dss[m[2]] = ds
+					r.DS = append(r.DS, ds)
+				}
+				err = ds.set(m[3], i.Value)
+			} else {
+				err = r.setRRA(m[2], m[3], i.Value)
+			}
+		} else {
+			err = r.set(i.Key, i.Value)
+		}
+
+		if err != nil {
+			return nil, NewInvalidResponseError(fmt.Sprintf("info: %v", err), fmt.Sprintf("%v %v", i.Key, i.Value))
+		}
+	}
+
+	sort.SliceStable(r.DS, func(i, j int) bool {
+		return r.DS[i].Index < r.DS[j].Index
+	})
+
+	return r, nil
+}
+
+// DSNamed returns the data source called name or nil if it doesn't exist.
+func (r *RRDInfo) DSNamed(name string) *DSInfo {
+	for _, ds := range r.DS {
+		if ds.Name == name {
+			return ds
+		}
+	}
+	return nil
+}
+
+// Def returns the definition of the data source.
+func (ds *DSInfo) Def() *DSDef {
+	return &DSDef{
+		Name:      ds.Name,
+		Type:      ds.Type,
+		Heartbeat: ds.Heartbeat,
+		Min:       ds.Min,
+		Max:       ds.Max,
+		CDEF:      ds.CDEF,
+	}
+}
+
+// Def returns the definition of the RRA. Info doesn't report the seasonal
+// period or the dependent RRA of Holt-Winters RRAs, so those are zero.
+func (rra *RRAInfo) Def() *RRADef {
+	def := &RRADef{
+		CF:              rra.CF,
+		XFF:             rra.XFF,
+		Steps:           rra.PDPPerRow,
+		Rows:            rra.Rows,
+		SmoothingWindow: rra.SmoothingWindow,
+		Threshold:       rra.FailureThreshold,
+		Window:          rra.WindowLength,
+	}
+	for _, v := range []struct {
+		dst *float64
+		src float64
+	}{{&def.Alpha, rra.Alpha}, {&def.Beta, rra.Beta}, {&def.Gamma, rra.Gamma}} {
+		if !math.IsNaN(v.src) {
+			*v.dst = v.src
+		}
+	}
+	return def
+}
+
+// set sets the top level field identified by key to v.
+func (r *RRDInfo) set(key string, v interface{}) (err error) {
+	switch key {
+	case "filename":
+		r.Filename, err = infoString(key, v)
+	case "rrd_version":
+		r.Version, err = infoString(key, v)
+	case "step":
+		var i int64
+		i, err = infoInt(key, v)
+		r.Step = time.Duration(i) * time.Second
+	case "last_update":
+		var i int64
+		i, err = infoInt(key, v)
+		r.LastUpdate = time.Unix(i, 0)
+	case "header_size":
+		r.HeaderSize, err = infoIntValue(key, v)
+	}
+	return err
+}
+
+// setRRA sets the field identified by key of the RRA idx to v.
+func (r *RRDInfo) setRRA(idx, key string, v interface{}) error {
+	i, err := strconv.Atoi(idx)
+	if err != nil || i < 0 || i > len(r.RRA) {
+		return fmt.Errorf("invalid rra index %q", idx)
+	}
+
+	if i == len(r.RRA) {
+		nan := math.NaN()
+		r.RRA = append(r.RRA, &RRAInfo{
+			XFF:             nan,
+			Alpha:           nan,
+			Beta:            nan,
+			Gamma:           nan,
+			SmoothingWindow: nan,
+			DeltaPos:        nan,
+			DeltaNeg:        nan,
+		})
+	}
+	rra := r.RRA[i]
+
+	if m := infoCDPPrepRe.FindStringSubmatch(key); m != nil {
+		j, err := strconv.Atoi(m[1])
+		if err != nil || j > len(rra.CDPPrep) {
+			return fmt.Errorf("invalid cdp_prep index %q", m[1])
+		}
+
+		if j == len(rra.CDPPrep) {
+			nan := math.NaN()
+			rra.CDPPrep = append(rra.CDPPrep, &CDPPrepInfo{Value: nan, Intercept: nan, Slope: nan, Seasonal: nan, Deviation: nan})
+		}
+		return rra.CDPPrep[j].set(m[2], v)
+	}
+
+	return rra.set(key, v)
+}
+
+// set sets the field of the data source identified by key to v.
+func (ds *DSInfo) set(key string, v interface{}) (err error) {
+	switch key {
+	case "index":
+		ds.Index, err = infoIntValue(key, v)
+	case "type":
+		ds.Type, err = infoString(key, v)
+	case "minimal_heartbeat":
+		var i int64
+		i, err = infoInt(key, v)
+		ds.Heartbeat = time.Duration(i) * time.Second
+	case "min":
+		ds.Min, err = infoFloat(key, v)
+	case "max":
+		ds.Max, err = infoFloat(key, v)
+	case "cdef":
+		ds.CDEF, err = infoString(key, v)
+	case "last_ds":
+		ds.LastDS, err = infoString(key, v)
+	case "value":
+		ds.Value, err = infoFloat(key, v)
+	case "unknown_sec":
+		ds.UnknownSec, err = infoIntValue(key, v)
+	}
+	return err
+}
+
+// set sets the field of the RRA identified by key to v.
+func (rra *RRAInfo) set(key string, v interface{}) (err error) {
+	switch key {
+	case "cf":
+		rra.CF, err = infoString(key, v)
+	case "rows":
+		rra.Rows, err = infoIntValue(key, v)
+	case "cur_row":
+		rra.CurRow, err = infoIntValue(key, v)
+	case "pdp_per_row":
+		rra.PDPPerRow, err = infoIntValue(key, v)
+	case "xff":
+		rra.XFF, err = infoFloat(key, v)
+	case "alpha":
+		rra.Alpha, err = infoFloat(key, v)
+	case "beta":
+		rra.Beta, err = infoFloat(key, v)
+	case "gamma":
+		rra.Gamma, err = infoFloat(key, v)
+	case "smoothing_window":
+		rra.SmoothingWindow, err = infoFloat(key, v)
+	case "delta_pos":
+		rra.DeltaPos, err = infoFloat(key, v)
+	case "delta_neg":
+		rra.DeltaNeg, err = infoFloat(key, v)
+	case "failure_threshold":
+		rra.FailureThreshold, err = infoIntValue(key, v)
+	case "window_length":
+		rra.WindowLength, err = infoIntValue(key, v)
+	}
+	return err
+}
+
+// set sets the field of the consolidation state identified by key to v.
+func (cdp *CDPPrepInfo) set(key string, v interface{}) (err error) {
+	switch key {
+	case "value":
+		cdp.Value, err = infoFloat(key, v)
+	case "unknown_datapoints":
+		cdp.UnknownDatapoints, err = infoIntValue(key, v)
+	case "intercept":
+		cdp.Intercept, err = infoFloat(key, v)
+	case "slope":
+		cdp.Slope, err = infoFloat(key, v)
+	case "NaN_count":
+		cdp.NaNCount, err = infoIntValue(key, v)
+	case "seasonal":
+		cdp.Seasonal, err = infoFloat(key, v)
+	case "deviation":
+		cdp.Deviation, err = infoFloat(key, v)
+	}
+	return err
+}
+
+// infoString returns the string value v of key.
+func infoString(key string, v interface{}) (string, error) {
+	s, ok := v.(string)
+	if !ok {
+		return "", fmt.Errorf("invalid string for key %v", key)
+	}
+	return s, nil
+}
+
+// infoInt returns the int value v of key.
+func infoInt(key string, v interface{}) (int64, error) {
+	i, ok := v.(int64)
+	if !ok {
+		return 0, fmt.Errorf("invalid int for key %v", key)
+	}
+	return i, nil
+}
+
+// infoIntValue returns the int value v of key as an int.
+func infoIntValue(key string, v interface{}) (int, error) {
+	i, err := infoInt(key, v)
+	return int(i), err
+}
+
+// infoFloat returns the float value v of key, which may also be an int.
+func infoFloat(key string, v interface{}) (float64, error) {
+	switch v := v.(type) {
+	case float64:
+		return v, nil
+	case int64:
+		return float64(v), nil
+	}
+	return 0, fmt.Errorf("invalid float for key %v", key)
+}
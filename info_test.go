@@ -0,0 +1,156 @@
+package rrd
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNewRRDInfo(t *testing.T) {
+	r, err := NewRRDInfo([]*Info{
+		{Key: "filename", Value: "test.rrd"},
+		{Key: "rrd_version", Value: "0003"},
+		{Key: "step", Value: int64(300)},
+		{Key: "last_update", Value: int64(1499981928)},
+		{Key: "header_size", Value: int64(2872)},
+		{Key: "ds[watts].index", Value: int64(1)},
+		{Key: "ds[watts].type", Value: Gauge},
+		{Key: "ds[watts].minimal_heartbeat", Value: int64(600)},
+		{Key: "ds[watts].min", Value: float64(0)},
+		{Key: "ds[watts].max", Value: math.NaN()},
+		{Key: "ds[watts].last_ds", Value: "U"},
+		{Key: "ds[watts].value", Value: float64(1.5)},
+		{Key: "ds[watts].unknown_sec", Value: int64(228)},
+		{Key: "ds[amps].index", Value: int64(0)},
+		{Key: "ds[amps].type", Value: Counter},
+		{Key: "ds[amps].max", Value: int64(100)},
+		{Key: "rra[0].cf", Value: Average},
+		{Key: "rra[0].rows", Value: int64(864000)},
+		{Key: "rra[0].cur_row", Value: int64(12)},
+		{Key: "rra[0].pdp_per_row", Value: int64(1)},
+		{Key: "rra[0].xff", Value: float64(0.5)},
+		{Key: "rra[0].cdp_prep[0].value", Value: math.NaN()},
+		{Key: "rra[0].cdp_prep[0].unknown_datapoints", Value: int64(0)},
+		{Key: "rra[0].cdp_prep[1].value", Value: float64(3)},
+		{Key: "rra[0].cdp_prep[1].unknown_datapoints", Value: int64(2)},
+		{Key: "rra[1].cf", Value: HoltWintersPredict},
+		{Key: "rra[1].rows", Value: int64(288)},
+		{Key: "rra[1].alpha", Value: float64(0.1)},
+		{Key: "rra[1].beta", Value: float64(0.0035)},
+		{Key: "rra[1].cdp_prep[0].intercept", Value: float64(4)},
+		{Key: "rra[1].cdp_prep[0].slope", Value: float64(-0.5)},
+		{Key: "rra[1].cdp_prep[0].NaN_count", Value: int64(1)},
+		{Key: "rra[2].cf", Value: Seasonal},
+		{Key: "rra[2].rows", Value: int64(288)},
+		{Key: "rra[2].gamma", Value: float64(0.1)},
+		{Key: "rra[2].smoothing_window", Value: float64(0.05)},
+		{Key: "rra[2].cdp_prep[0].seasonal", Value: float64(2)},
+		{Key: "rra[3].cf", Value: Failures},
+		{Key: "rra[3].rows", Value: int64(288)},
+		{Key: "rra[3].delta_pos", Value: float64(2)},
+		{Key: "rra[3].delta_neg", Value: float64(2)},
+		{Key: "rra[3].failure_threshold", Value: int64(7)},
+		{Key: "rra[3].window_length", Value: int64(9)},
+	})
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	assert.Equal(t, "test.rrd", r.Filename)
+	assert.Equal(t, "0003", r.Version)
+	assert.Equal(t, time.Minute*5, r.Step)
+	assert.Equal(t, time.Unix(1499981928, 0), r.LastUpdate)
+	assert.Equal(t, 2872, r.HeaderSize)
+
+	if assert.Len(t, r.DS, 2) {
+		// Ordered by index.
+		amps, watts := r.DS[0], r.DS[1]
+		assert.Equal(t, "amps", amps.Name)
+		assert.Equal(t, Counter, amps.Type)
+		assert.True(t, math.IsNaN(amps.Min))
+		assert.Equal(t, float64(100), amps.Max)
+
+		assert.Equal(t, "watts", watts.Name)
+		assert.Equal(t, 1, watts.Index)
+		assert.Equal(t, time.Minute*10, watts.Heartbeat)
+		assert.Equal(t, float64(0), watts.Min)
+		assert.True(t, math.IsNaN(watts.Max))
+		assert.Equal(t, "U", watts.LastDS)
+		assert.Equal(t, 1.5, watts.Value)
+		assert.Equal(t, 228, watts.UnknownSec)
+
+		assert.Equal(t, watts, r.DSNamed("watts"))
+		assert.Nil(t, r.DSNamed("volts"))
+	}
+
+	if assert.Len(t, r.RRA, 4) {
+		rra := r.RRA[0]
+		assert.Equal(t, Average, rra.CF)
+		assert.Equal(t, 864000, rra.Rows)
+		assert.Equal(t, 12, rra.CurRow)
+		assert.Equal(t, 1, rra.PDPPerRow)
+		assert.Equal(t, 0.5, rra.XFF)
+		if assert.Len(t, rra.CDPPrep, 2) {
+			assert.True(t, math.IsNaN(rra.CDPPrep[0].Value))
+			assert.Equal(t, float64(3), rra.CDPPrep[1].Value)
+			assert.Equal(t, 2, rra.CDPPrep[1].UnknownDatapoints)
+			assert.True(t, math.IsNaN(rra.CDPPrep[1].Intercept))
+		}
+		assert.Equal(t, RRA("RRA:AVERAGE:0.5:1:864000"), rra.Def().RRA())
+
+		rra = r.RRA[1]
+		assert.Equal(t, HoltWintersPredict, rra.CF)
+		assert.Equal(t, 288, rra.Rows)
+		assert.True(t, math.IsNaN(rra.XFF))
+		assert.Equal(t, 0.1, rra.Alpha)
+		assert.Equal(t, 0.0035, rra.Beta)
+		assert.True(t, math.IsNaN(rra.Gamma))
+		if assert.Len(t, rra.CDPPrep, 1) {
+			cdp := rra.CDPPrep[0]
+			assert.Equal(t, float64(4), cdp.Intercept)
+			assert.Equal(t, -0.5, cdp.Slope)
+			assert.Equal(t, 1, cdp.NaNCount)
+			assert.True(t, math.IsNaN(cdp.Value))
+		}
+
+		rra = r.RRA[2]
+		assert.Equal(t, 0.1, rra.Gamma)
+		assert.Equal(t, 0.05, rra.SmoothingWindow)
+		if assert.Len(t, rra.CDPPrep, 1) {
+			assert.Equal(t, float64(2), rra.CDPPrep[0].Seasonal)
+			assert.True(t, math.IsNaN(rra.CDPPrep[0].Deviation))
+		}
+		assert.Equal(t, RRA("RRA:SEASONAL:288:0.1:0:smoothing-window=0.05"), rra.Def().RRA())
+
+		rra = r.RRA[3]
+		assert.Equal(t, float64(2), rra.DeltaPos)
+		assert.Equal(t, float64(2), rra.DeltaNeg)
+		assert.Equal(t, 7, rra.FailureThreshold)
+		assert.Equal(t, 9, rra.WindowLength)
+		assert.Equal(t, RRA("RRA:FAILURES:288:7:9:0"), rra.Def().RRA())
+	}
+}
+
+func TestNewRRDInfoErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		info *Info
+	}{
+		{"string", &Info{Key: "rrd_version", Value: int64(3)}},
+		{"int", &Info{Key: "step", Value: "300"}},
+		{"float", &Info{Key: "ds[watts].min", Value: "0"}},
+		{"rra-index", &Info{Key: "rra[1].cf", Value: Average}},
+		{"cdp-prep-index", &Info{Key: "rra[0].cdp_prep[2].value", Value: float64(1)}},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := NewRRDInfo([]*Info{tc.info})
+			if assert.Error(t, err) {
+				assert.IsType(t, &InvalidResponseError{}, err)
+			}
+		})
+	}
+}
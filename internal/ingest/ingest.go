@@ -0,0 +1,128 @@
+// Package ingest provides the helpers shared by the gateways which write
+// metrics received using other protocols to rrdcached.
+package ingest
+
+import (
+	"context"
+	"fmt"
+	"path"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/multiplay/go-rrd"
+)
+
+// LineError represents a line which couldn't be processed.
+type LineError struct {
+	Line string
+	Msg  string
+}
+
+func (e *LineError) Error() string {
+	return fmt.Sprintf("%v: %q", e.Msg, e.Line)
+}
+
+// CreateError represents the failure to create the RRD of a metric.
+type CreateError struct {
+	Metric   string
+	Filename string
+	Err      error
+}
+
+func (e *CreateError) Error() string {
+	return fmt.Sprintf("%v: create %v: %v", e.Metric, e.Filename, e.Err)
+}
+
+// CreateClient is the interface implemented by rrd.Client and rrd.Pool used
+// to create RRDs.
+type CreateClient interface {
+	CreateContext(ctx context.Context, filename string, ds []rrd.DS, rra []rrd.RRA, options ...rrd.CreateOption) error
+}
+
+// creation is an in progress create of a file.
+type creation struct {
+	done chan struct{}
+	err  error
+}
+
+// Creator creates RRDs on demand, recording the files known to exist so each
+// is only created once. It's goroutine safe.
+type Creator struct {
+	c CreateClient
+
+	mtx sync.Mutex
+
+	// created records the files known to exist.
+	created map[string]bool
+
+	// creating records the files being created.
+	creating map[string]*creation
+}
+
+// NewCreator returns a new Creator which creates files using c.
+func NewCreator(c CreateClient) *Creator {
+	return &Creator{
+		c:        c,
+		created:  make(map[string]bool),
+		creating: make(map[string]*creation),
+	}
+}
+
+// Create creates filename using s, with a start time before ts, unless it's
+// already known to exist. Files which already exist on the server are left
+// unchanged. Concurrent calls for the same file wait for the first to finish
+// and return its result, calls for other files aren't blocked.
+func (cr *Creator) Create(ctx context.Context, filename string, s *rrd.Schema, ts time.Time) error {
+	cr.mtx.Lock()
+	if cr.created[filename] {
+		cr.mtx.Unlock()
+		return nil
+	}
+
+	if c, ok := cr.creating[filename]; ok {
+		cr.mtx.Unlock()
+		select {
+		case <-c.done:
+			return c.err
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+
+	c := &creation{done: make(chan struct{})}
+	cr.creating[filename] = c
+	cr.mtx.Unlock()
+
+	options := []rrd.CreateOption{rrd.NoOverwrite(), rrd.Start(ts.Add(-time.Second))}
+	if s.Step != 0 {
+		options = append(options, rrd.Step(s.Step))
+	}
+
+	if err := cr.c.CreateContext(ctx, filename, s.DS, s.RRA, options...); err != nil && !isExist(err) {
+		c.err = err
+	}
+
+	cr.mtx.Lock()
+	delete(cr.creating, filename)
+	if c.err == nil {
+		cr.created[filename] = true
+	}
+	cr.mtx.Unlock()
+	close(c.done)
+
+	return c.err
+}
+
+// isExist returns true if err indicates a created file already exists.
+func isExist(err error) bool {
+	e, ok := err.(*rrd.Error)
+	return ok && strings.HasSuffix(e.Msg, "File exists")
+}
+
+// ValidFilename returns true if filename is a relative path within the base
+// directory of rrdcached.
+func ValidFilename(filename string) bool {
+	f := path.Clean(filename)
+	return filename != "" && f != "." && f != ".." && !path.IsAbs(f) && !strings.HasPrefix(f, "../")
+}
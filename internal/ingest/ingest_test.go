@@ -0,0 +1,101 @@
+package ingest
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/multiplay/go-rrd"
+	"github.com/stretchr/testify/assert"
+)
+
+// testClient records creates, blocking those of files in block until released.
+type testClient struct {
+	mtx     sync.Mutex
+	creates map[string]int
+	err     error
+	block   map[string]chan struct{}
+}
+
+func (c *testClient) CreateContext(ctx context.Context, filename string, ds []rrd.DS, rra []rrd.RRA, options ...rrd.CreateOption) error {
+	c.mtx.Lock()
+	c.creates[filename]++
+	ch := c.block[filename]
+	err := c.err
+	c.mtx.Unlock()
+
+	if ch != nil {
+		<-ch
+	}
+	return err
+}
+
+func TestCreator(t *testing.T) {
+	release := make(chan struct{})
+	c := &testClient{
+		creates: make(map[string]int),
+		block:   map[string]chan struct{}{"slow.rrd": release},
+	}
+	cr := NewCreator(c)
+	ctx := context.Background()
+	s := &rrd.Schema{}
+	ts := time.Unix(1500000000, 0)
+
+	var wg sync.WaitGroup
+	errs := make([]error, 3)
+	for i := range errs {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			errs[i] = cr.Create(ctx, "slow.rrd", s, ts)
+		}(i)
+	}
+
+	// Wait for the first create to start.
+	for n := 0; n == 0; {
+		time.Sleep(time.Millisecond)
+		c.mtx.Lock()
+		n = c.creates["slow.rrd"]
+		c.mtx.Unlock()
+	}
+
+	// Other files aren't blocked by an in progress create.
+	assert.NoError(t, cr.Create(ctx, "fast.rrd", s, ts))
+	close(release)
+	wg.Wait()
+
+	for _, err := range errs {
+		assert.NoError(t, err)
+	}
+	assert.NoError(t, cr.Create(ctx, "slow.rrd", s, ts))
+	assert.Equal(t, map[string]int{"slow.rrd": 1, "fast.rrd": 1}, c.creates)
+
+	// Existing files are known to exist, failures are retried.
+	c.err = &rrd.Error{Code: -1, Msg: "RRD Error: creating 'exists.rrd': File exists"}
+	assert.NoError(t, cr.Create(ctx, "exists.rrd", s, ts))
+	assert.NoError(t, cr.Create(ctx, "exists.rrd", s, ts))
+
+	errTest := errors.New("test")
+	c.err = errTest
+	assert.Equal(t, errTest, cr.Create(ctx, "failed.rrd", s, ts))
+	assert.Equal(t, errTest, cr.Create(ctx, "failed.rrd", s, ts))
+	assert.Equal(t, map[string]int{"slow.rrd": 1, "fast.rrd": 1, "exists.rrd": 1, "failed.rrd": 2}, c.creates)
+}
+
+func TestValidFilename(t *testing.T) {
+	tests := map[string]bool{
+		"a.rrd":      true,
+		"a/b.rrd":    true,
+		"a/../b.rrd": true,
+		"":           false,
+		"/a.rrd":     false,
+		"../a.rrd":   false,
+		"a/../../b":  false,
+	}
+
+	for f, valid := range tests {
+		assert.Equal(t, valid, ValidFilename(f), f)
+	}
+}
@@ -0,0 +1,52 @@
+// Package testserver runs the in-tree server for the tests of the packages
+// which write to rrdcached.
+package testserver
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"github.com/multiplay/go-rrd"
+	"github.com/multiplay/go-rrd/server"
+)
+
+// Start starts a server with a MemStore, returning a pool and a client
+// connected to it and a function which closes them and the server. If the
+// server can't be started the test is stopped using t.Fatal.
+func Start(t testing.TB) (*rrd.Pool, *rrd.Client, func()) {
+	t.Helper()
+
+	s, err := server.New(server.NewMemStore())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		s.Close() // nolint: errcheck
+		t.Fatal(err)
+	}
+	go s.Serve(l) // nolint: errcheck
+
+	p, err := rrd.NewPool(l.Addr().String(), rrd.ClientOptions(rrd.Timeout(time.Second*2)))
+	if err != nil {
+		s.Close() // nolint: errcheck
+		t.Fatal(err)
+	}
+
+	c, err := rrd.NewClient(l.Addr().String(), rrd.Timeout(time.Second*2))
+	if err != nil {
+		p.Close() // nolint: errcheck
+		s.Close() // nolint: errcheck
+		t.Fatal(err)
+	}
+
+	return p, c, func() {
+		c.Close() // nolint: errcheck
+		p.Close() // nolint: errcheck
+		if err := s.Close(); err != nil {
+			t.Error(err)
+		}
+	}
+}
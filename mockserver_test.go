@@ -13,6 +13,9 @@ import (
 
 const (
 	cmdQuit = "quit"
+
+	// cmdHang is a command the server never responds to.
+	cmdHang = "hang"
 )
 
 var (
@@ -84,8 +87,13 @@ var (
 			"ds[watts].last_ds 2 U",
 			"ds[watts].unknown_sec 1 228",
 		},
-		"create": {"0 RRD created OK"},
-		"batch":  {"0 Go ahead.  End with dot '.' on its own line."},
+		"create":     {"0 RRD created OK"},
+		"suspend":    {"0 test.rrd suspended"},
+		"resume":     {"-1 test.rrd not suspended"},
+		"suspendall": {"0 2 rrds suspended"},
+		"resumeall":  {"0 2 rrds resumed"},
+		"list":       {"2 RRDs", "test.rrd", "sub/other.rrd"},
+		"batch":      {"0 Go ahead.  End with dot '.' on its own line."},
 		".": {
 			"2 errors",
 			"1 Can't use 'ping' here.",
@@ -219,13 +227,15 @@ func (s *server) handle(conn net.Conn) {
 			return
 		case ".":
 			batch = false
+		case cmdHang:
+			continue
 		}
 
 		if batch {
 			continue
 		}
 
-		resp, ok := commands[parts[0]]
+		resp, ok := commands[strings.ToLower(parts[0])]
 		var err error
 		if ok {
 			err = s.write(c, resp...)
@@ -240,11 +250,29 @@ func (s *server) handle(conn net.Conn) {
 		}
 	}
 
-	if err := sc.Err(); err != nil && s.running() {
+	if err := sc.Err(); err != nil && s.running() && s.active(conn) {
 		assert.NoError(s.t, err)
 	}
 }
 
+// active returns true if conn hasn't been dropped, false otherwise.
+func (s *server) active(conn net.Conn) bool {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	_, ok := s.conns[conn]
+	return ok
+}
+
+// dropConns closes all current client connections, leaving the server running.
+func (s *server) dropConns() {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	for c := range s.conns {
+		c.Close() // nolint: errcheck
+		delete(s.conns, c)
+	}
+}
+
 // closeConn closes a client connection and removes it from our map of connections.
 func (s *server) closeConn(conn net.Conn) {
 	s.mtx.Lock()
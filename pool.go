@@ -0,0 +1,225 @@
+package rrd
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+var (
+	// DefaultMaxIdle is the default maximum number of idle connections retained by a Pool.
+	DefaultMaxIdle = 2
+
+	// DefaultCheckIdle is the default idle duration after which a Pool checks
+	// a connection with a ping before reusing it.
+	DefaultCheckIdle = time.Second * 30
+)
+
+// idleClient is a Client waiting to be reused.
+type idleClient struct {
+	*Client
+	since time.Time
+}
+
+// Pool is a goroutine safe pool of rrdcached Clients.
+// It supports the same commands as Client, each of which is
+// run on a connection which is exclusive for its duration.
+type Pool struct {
+	addr          string
+	clientOptions []func(c *Client) error
+	maxOpen       int
+	maxIdle       int
+	checkIdle     time.Duration
+
+	sem    chan struct{}
+	idle   []idleClient
+	closed bool
+	mtx    sync.Mutex
+}
+
+// ClientOptions sets the options used to create the Clients of a Pool.
+func ClientOptions(options ...func(c *Client) error) func(*Pool) error {
+	return func(p *Pool) error {
+		p.clientOptions = options
+		return nil
+	}
+}
+
+// MaxOpen sets the maximum number of open connections of a Pool.
+// If n <= 0, the default, then there is no limit.
+// Commands issued when the limit is reached wait for a connection to be released.
+func MaxOpen(n int) func(*Pool) error {
+	return func(p *Pool) error {
+		p.maxOpen = n
+		return nil
+	}
+}
+
+// MaxIdle sets the maximum number of idle connections retained by a Pool.
+// If n <= 0 then no idle connections are retained.
+func MaxIdle(n int) func(*Pool) error {
+	return func(p *Pool) error {
+		p.maxIdle = n
+		return nil
+	}
+}
+
+// CheckIdle sets the duration a connection can be idle in a Pool
+// before it's checked with a ping prior to being reused.
+func CheckIdle(d time.Duration) func(*Pool) error {
+	return func(p *Pool) error {
+		p.checkIdle = d
+		return nil
+	}
+}
+
+// NewPool returns a new Pool which creates Clients connected to addr using NewClient.
+// Connections are established on demand.
+func NewPool(addr string, options ...func(p *Pool) error) (*Pool, error) {
+	p := &Pool{addr: addr, maxIdle: DefaultMaxIdle, checkIdle: DefaultCheckIdle}
+	for _, f := range options {
+		if f == nil {
+			return nil, ErrNilOption
+		}
+		if err := f(p); err != nil {
+			return nil, err
+		}
+	}
+
+	for _, f := range p.clientOptions {
+		if f == nil {
+			return nil, ErrNilOption
+		}
+	}
+
+	if p.maxOpen > 0 {
+		p.sem = make(chan struct{}, p.maxOpen)
+	}
+
+	return p, nil
+}
+
+// acquire reserves an open connection slot.
+func (p *Pool) acquire(ctx context.Context) error {
+	if p.sem == nil {
+		return nil
+	}
+
+	select {
+	case p.sem <- struct{}{}:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// release releases an open connection slot.
+func (p *Pool) release() {
+	if p.sem != nil {
+		<-p.sem
+	}
+}
+
+// popIdle returns the most recently used idle client or nil if there are none.
+func (p *Pool) popIdle() (*idleClient, error) {
+	p.mtx.Lock()
+	defer p.mtx.Unlock()
+
+	if p.closed {
+		return nil, ErrPoolClosed
+	}
+
+	n := len(p.idle)
+	if n == 0 {
+		return nil, nil
+	}
+
+	c := p.idle[n-1]
+	p.idle = p.idle[:n-1]
+	return &c, nil
+}
+
+// get returns a Client for exclusive use, which must be returned with put.
+func (p *Pool) get(ctx context.Context) (*Client, error) {
+	if err := p.acquire(ctx); err != nil {
+		return nil, err
+	}
+
+	for {
+		c, err := p.popIdle()
+		if err != nil {
+			p.release()
+			return nil, err
+		} else if c == nil {
+			break
+		}
+
+		if time.Since(c.since) < p.checkIdle || c.PingContext(ctx) == nil {
+			return c.Client, nil
+		}
+
+		c.Close() // nolint: errcheck
+	}
+
+	c, err := NewClientContext(ctx, p.addr, p.clientOptions...)
+	if err != nil {
+		p.release()
+		return nil, err
+	}
+
+	return c, nil
+}
+
+// put returns c to the pool, closing it if its connection is broken or it
+// isn't needed.
+func (p *Pool) put(c *Client) {
+	defer p.release()
+
+	if c.broken {
+		c.Close() // nolint: errcheck
+		return
+	}
+
+	p.mtx.Lock()
+	if p.closed || len(p.idle) >= p.maxIdle {
+		p.mtx.Unlock()
+		c.Close() // nolint: errcheck
+		return
+	}
+	p.idle = append(p.idle, idleClient{Client: c, since: time.Now()})
+	p.mtx.Unlock()
+}
+
+// do runs f with a Client from the pool.
+func (p *Pool) do(ctx context.Context, f func(c *Client) error) error {
+	c, err := p.get(ctx)
+	if err != nil {
+		return err
+	}
+
+	err = f(c)
+	p.put(c)
+	return err
+}
+
+// Close closes the pool and all its idle connections.
+// Connections in use are closed when released.
+func (p *Pool) Close() error {
+	p.mtx.Lock()
+	defer p.mtx.Unlock()
+
+	if p.closed {
+		return ErrPoolClosed
+	}
+
+	p.closed = true
+	var err error
+	for _, c := range p.idle {
+		if err2 := c.Close(); err2 != nil && err == nil {
+			err = err2
+		}
+	}
+	p.idle = nil
+
+	return err
+}
@@ -0,0 +1,476 @@
+package rrd
+
+import (
+	"context"
+	"time"
+)
+
+// Exec executes cmd on the server and returns the response.
+func (p *Pool) Exec(cmd string) ([]string, error) {
+	return p.ExecContext(context.Background(), cmd)
+}
+
+// ExecContext executes cmd on the server and returns the response.
+func (p *Pool) ExecContext(ctx context.Context, cmd string) ([]string, error) {
+	var r []string
+	err := p.do(ctx, func(c *Client) (err error) {
+		r, err = c.ExecContext(ctx, cmd)
+		return err
+	})
+	return r, err
+}
+
+// ExecCmd executes cmd on the server and returns the response.
+func (p *Pool) ExecCmd(cmd *Cmd) ([]string, error) {
+	return p.ExecCmdContext(context.Background(), cmd)
+}
+
+// ExecCmdContext executes cmd on the server and returns the response.
+func (p *Pool) ExecCmdContext(ctx context.Context, cmd *Cmd) ([]string, error) {
+	var r []string
+	err := p.do(ctx, func(c *Client) (err error) {
+		r, err = c.ExecCmdContext(ctx, cmd)
+		return err
+	})
+	return r, err
+}
+
+// Flush requests rrdcached flushed all values pending for filename to disk.
+func (p *Pool) Flush(filename string) error {
+	return p.FlushContext(context.Background(), filename)
+}
+
+// FlushContext requests rrdcached flushed all values pending for filename to disk.
+func (p *Pool) FlushContext(ctx context.Context, filename string) error {
+	return p.do(ctx, func(c *Client) error {
+		return c.FlushContext(ctx, filename)
+	})
+}
+
+// FlushAll requests the rrdcached start to flush all pending values to disk.
+func (p *Pool) FlushAll() error {
+	return p.FlushAllContext(context.Background())
+}
+
+// FlushAllContext requests the rrdcached start to flush all pending values to disk.
+func (p *Pool) FlushAllContext(ctx context.Context) error {
+	return p.do(ctx, func(c *Client) error {
+		return c.FlushAllContext(ctx)
+	})
+}
+
+// Pending returns any "pending" updates for a file, in order.
+func (p *Pool) Pending(filename string) ([]*PendingUpdate, error) {
+	return p.PendingContext(context.Background(), filename)
+}
+
+// PendingContext returns any "pending" updates for a file, in order.
+func (p *Pool) PendingContext(ctx context.Context, filename string) ([]*PendingUpdate, error) {
+	var r []*PendingUpdate
+	err := p.do(ctx, func(c *Client) (err error) {
+		r, err = c.PendingContext(ctx, filename)
+		return err
+	})
+	return r, err
+}
+
+// Fetch returns the free text results of a fetch command with the given options.
+func (p *Pool) Fetch(filename, cf string, options ...interface{}) (*Fetch, error) {
+	return p.FetchContext(context.Background(), filename, cf, options...)
+}
+
+// FetchContext returns the free text results of a fetch command with the given options.
+func (p *Pool) FetchContext(ctx context.Context, filename, cf string, options ...interface{}) (*Fetch, error) {
+	var r *Fetch
+	err := p.do(ctx, func(c *Client) (err error) {
+		r, err = c.FetchContext(ctx, filename, cf, options...)
+		return err
+	})
+	return r, err
+}
+
+// FetchWithOptions returns the free text results of a fetch command with the given options.
+func (p *Pool) FetchWithOptions(filename, cf string, opts FetchOptions) (*Fetch, error) {
+	return p.FetchContext(context.Background(), filename, cf, opts)
+}
+
+// FetchWithOptionsContext returns the free text results of a fetch command with the given options.
+func (p *Pool) FetchWithOptionsContext(ctx context.Context, filename, cf string, opts FetchOptions) (*Fetch, error) {
+	return p.FetchContext(ctx, filename, cf, opts)
+}
+
+// FetchStream performs a fetch command with the given options, calling fn for
+// each row as it's read instead of storing them, returning the fetch header.
+func (p *Pool) FetchStream(filename, cf string, fn FetchRowFunc, options ...interface{}) (*Fetch, error) {
+	return p.FetchStreamContext(context.Background(), filename, cf, fn, options...)
+}
+
+// FetchStreamContext performs a fetch command with the given options, calling
+// fn for each row as it's read instead of storing them, returning the fetch header.
+func (p *Pool) FetchStreamContext(ctx context.Context, filename, cf string, fn FetchRowFunc, options ...interface{}) (*Fetch, error) {
+	var r *Fetch
+	err := p.do(ctx, func(c *Client) (err error) {
+		r, err = c.FetchStreamContext(ctx, filename, cf, fn, options...)
+		return err
+	})
+	return r, err
+}
+
+// FetchBin returns the text/binary results of a fetch command with the given options.
+func (p *Pool) FetchBin(filename, cf string, options ...interface{}) (*FetchBin, error) {
+	return p.FetchBinContext(context.Background(), filename, cf, options...)
+}
+
+// FetchBinWithOptions returns the text/binary results of a fetch command with the given options.
+func (p *Pool) FetchBinWithOptions(filename, cf string, opts FetchOptions) (*FetchBin, error) {
+	return p.FetchBinContext(context.Background(), filename, cf, opts)
+}
+
+// FetchBinWithOptionsContext returns the text/binary results of a fetch command with the given options.
+func (p *Pool) FetchBinWithOptionsContext(ctx context.Context, filename, cf string, opts FetchOptions) (*FetchBin, error) {
+	return p.FetchBinContext(ctx, filename, cf, opts)
+}
+
+// FetchBinContext returns the text/binary results of a fetch command with the given options.
+func (p *Pool) FetchBinContext(ctx context.Context, filename, cf string, options ...interface{}) (*FetchBin, error) {
+	var r *FetchBin
+	err := p.do(ctx, func(c *Client) (err error) {
+		r, err = c.FetchBinContext(ctx, filename, cf, options...)
+		return err
+	})
+	return r, err
+}
+
+// Forget requests rrdcached remove filename from the cache.
+// Any pending updates WILL BE LOST.
+func (p *Pool) Forget(filename string) error {
+	return p.ForgetContext(context.Background(), filename)
+}
+
+// ForgetContext requests rrdcached remove filename from the cache.
+// Any pending updates WILL BE LOST.
+func (p *Pool) ForgetContext(ctx context.Context, filename string) error {
+	return p.do(ctx, func(c *Client) error {
+		return c.ForgetContext(ctx, filename)
+	})
+}
+
+// Suspend requests rrdcached stop writing updates for filename to disk, for
+// example during a backup. Updates continue to be cached until it's resumed.
+func (p *Pool) Suspend(filename string) error {
+	return p.SuspendContext(context.Background(), filename)
+}
+
+// SuspendContext requests rrdcached stop writing updates for filename to disk, for
+// example during a backup. Updates continue to be cached until it's resumed.
+func (p *Pool) SuspendContext(ctx context.Context, filename string) error {
+	return p.do(ctx, func(c *Client) error {
+		return c.SuspendContext(ctx, filename)
+	})
+}
+
+// Resume requests rrdcached resume writing updates for filename to disk.
+func (p *Pool) Resume(filename string) error {
+	return p.ResumeContext(context.Background(), filename)
+}
+
+// ResumeContext requests rrdcached resume writing updates for filename to disk.
+func (p *Pool) ResumeContext(ctx context.Context, filename string) error {
+	return p.do(ctx, func(c *Client) error {
+		return c.ResumeContext(ctx, filename)
+	})
+}
+
+// SuspendAll requests rrdcached stop writing updates for all files to disk.
+func (p *Pool) SuspendAll() error {
+	return p.SuspendAllContext(context.Background())
+}
+
+// SuspendAllContext requests rrdcached stop writing updates for all files to disk.
+func (p *Pool) SuspendAllContext(ctx context.Context) error {
+	return p.do(ctx, func(c *Client) error {
+		return c.SuspendAllContext(ctx)
+	})
+}
+
+// ResumeAll requests rrdcached resume writing updates for all files to disk.
+func (p *Pool) ResumeAll() error {
+	return p.ResumeAllContext(context.Background())
+}
+
+// ResumeAllContext requests rrdcached resume writing updates for all files to disk.
+func (p *Pool) ResumeAllContext(ctx context.Context) error {
+	return p.do(ctx, func(c *Client) error {
+		return c.ResumeAllContext(ctx)
+	})
+}
+
+// List returns the paths of the files in the cache under path, which is / for
+// all files, descending into sub-directories if recursive is true. The paths are
+// relative to path.
+func (p *Pool) List(path string, recursive bool) ([]string, error) {
+	return p.ListContext(context.Background(), path, recursive)
+}
+
+// ListContext returns the paths of the files in the cache under path, which is / for
+// all files, descending into sub-directories if recursive is true. The paths are
+// relative to path.
+func (p *Pool) ListContext(ctx context.Context, path string, recursive bool) ([]string, error) {
+	var r []string
+	err := p.do(ctx, func(c *Client) (err error) {
+		r, err = c.ListContext(ctx, path, recursive)
+		return err
+	})
+	return r, err
+}
+
+// Walk walks the tree of files in the cache under root, calling fn for each
+// file and directory. See Client.Walk for details.
+func (p *Pool) Walk(root string, fn WalkFunc, patterns ...string) error {
+	return p.WalkContext(context.Background(), root, fn, patterns...)
+}
+
+// WalkContext walks the tree of files in the cache under root, calling fn for
+// each file and directory. See Client.Walk for details.
+func (p *Pool) WalkContext(ctx context.Context, root string, fn WalkFunc, patterns ...string) error {
+	if err := checkPatterns(patterns); err != nil {
+		return err
+	}
+
+	files, err := p.ListContext(ctx, listPath(root), true)
+	if err != nil {
+		return err
+	}
+
+	return walk(root, files, fn, patterns)
+}
+
+// Stale returns the files in the cache under root matching patterns, as
+// for Walk, which haven't been updated for at least age.
+func (p *Pool) Stale(root string, age time.Duration, patterns ...string) ([]string, error) {
+	return p.StaleContext(context.Background(), root, age, patterns...)
+}
+
+// StaleContext returns the files in the cache under root matching patterns,
+// as for Walk, which haven't been updated for at least age.
+func (p *Pool) StaleContext(ctx context.Context, root string, age time.Duration, patterns ...string) ([]string, error) {
+	var r []string
+	err := p.do(ctx, func(c *Client) (err error) {
+		r, err = c.StaleContext(ctx, root, age, patterns...)
+		return err
+	})
+	return r, err
+}
+
+// Queue returns the files that are on the rrdcached output queue.
+func (p *Pool) Queue(filename string) ([]*Queue, error) {
+	return p.QueueContext(context.Background(), filename)
+}
+
+// QueueContext returns the files that are on the rrdcached output queue.
+func (p *Pool) QueueContext(ctx context.Context, filename string) ([]*Queue, error) {
+	var r []*Queue
+	err := p.do(ctx, func(c *Client) (err error) {
+		r, err = c.QueueContext(ctx, filename)
+		return err
+	})
+	return r, err
+}
+
+// Help returns command help.
+func (p *Pool) Help(cmd ...string) ([]string, error) {
+	return p.HelpContext(context.Background(), cmd...)
+}
+
+// HelpContext returns command help.
+func (p *Pool) HelpContext(ctx context.Context, cmd ...string) ([]string, error) {
+	var r []string
+	err := p.do(ctx, func(c *Client) (err error) {
+		r, err = c.HelpContext(ctx, cmd...)
+		return err
+	})
+	return r, err
+}
+
+// Stats returns stats about rrdcached.
+func (p *Pool) Stats() (*Stats, error) {
+	return p.StatsContext(context.Background())
+}
+
+// StatsContext returns stats about rrdcached.
+func (p *Pool) StatsContext(ctx context.Context) (*Stats, error) {
+	var r *Stats
+	err := p.do(ctx, func(c *Client) (err error) {
+		r, err = c.StatsContext(ctx)
+		return err
+	})
+	return r, err
+}
+
+// Ping sends a ping to the server.
+func (p *Pool) Ping() error {
+	return p.PingContext(context.Background())
+}
+
+// PingContext sends a ping to the server.
+func (p *Pool) PingContext(ctx context.Context) error {
+	return p.do(ctx, func(c *Client) error {
+		return c.PingContext(ctx)
+	})
+}
+
+// Update adds more data to filename.
+func (p *Pool) Update(filename string, value Update, values ...Update) error {
+	return p.UpdateContext(context.Background(), filename, value, values...)
+}
+
+// UpdateContext adds more data to filename.
+func (p *Pool) UpdateContext(ctx context.Context, filename string, value Update, values ...Update) error {
+	return p.do(ctx, func(c *Client) error {
+		return c.UpdateContext(ctx, filename, value, values...)
+	})
+}
+
+// Wrote sends a wrote command for filename to rrdcached.
+func (p *Pool) Wrote(filename string) error {
+	return p.WroteContext(context.Background(), filename)
+}
+
+// WroteContext sends a wrote command for filename to rrdcached.
+func (p *Pool) WroteContext(ctx context.Context, filename string) error {
+	return p.do(ctx, func(c *Client) error {
+		return c.WroteContext(ctx, filename)
+	})
+}
+
+// First returns the timestamp of the first CDP for the given RRA.
+func (p *Pool) First(filename string, rra int) (time.Time, error) {
+	return p.FirstContext(context.Background(), filename, rra)
+}
+
+// FirstContext returns the timestamp of the first CDP for the given RRA.
+func (p *Pool) FirstContext(ctx context.Context, filename string, rra int) (time.Time, error) {
+	var r time.Time
+	err := p.do(ctx, func(c *Client) (err error) {
+		r, err = c.FirstContext(ctx, filename, rra)
+		return err
+	})
+	return r, err
+}
+
+// Last returns the timestamp of the last update to the specified RRD.
+func (p *Pool) Last(filename string) (time.Time, error) {
+	return p.LastContext(context.Background(), filename)
+}
+
+// LastContext returns the timestamp of the last update to the specified RRD.
+func (p *Pool) LastContext(ctx context.Context, filename string) (time.Time, error) {
+	var r time.Time
+	err := p.do(ctx, func(c *Client) (err error) {
+		r, err = c.LastContext(ctx, filename)
+		return err
+	})
+	return r, err
+}
+
+// Info returns the configuration information for the specified RRD.
+func (p *Pool) Info(filename string) ([]*Info, error) {
+	return p.InfoContext(context.Background(), filename)
+}
+
+// InfoContext returns the configuration information for the specified RRD.
+func (p *Pool) InfoContext(ctx context.Context, filename string) ([]*Info, error) {
+	var r []*Info
+	err := p.do(ctx, func(c *Client) (err error) {
+		r, err = c.InfoContext(ctx, filename)
+		return err
+	})
+	return r, err
+}
+
+// RRDInfo returns the structured configuration information for the specified RRD.
+func (p *Pool) RRDInfo(filename string) (*RRDInfo, error) {
+	return p.RRDInfoContext(context.Background(), filename)
+}
+
+// RRDInfoContext returns the structured configuration information for the specified RRD.
+func (p *Pool) RRDInfoContext(ctx context.Context, filename string) (*RRDInfo, error) {
+	var r *RRDInfo
+	err := p.do(ctx, func(c *Client) (err error) {
+		r, err = c.RRDInfoContext(ctx, filename)
+		return err
+	})
+	return r, err
+}
+
+// Create creates the RRD according to the supplied parameters.
+func (p *Pool) Create(filename string, ds []DS, rra []RRA, options ...CreateOption) error {
+	return p.CreateContext(context.Background(), filename, ds, rra, options...)
+}
+
+// CreateContext creates the RRD according to the supplied parameters.
+func (p *Pool) CreateContext(ctx context.Context, filename string, ds []DS, rra []RRA, options ...CreateOption) error {
+	return p.do(ctx, func(c *Client) error {
+		return c.CreateContext(ctx, filename, ds, rra, options...)
+	})
+}
+
+// Migrate migrates the RRD filename to schema if it differs, returning the
+// changes which were made.
+func (p *Pool) Migrate(filename string, schema *Schema) ([]*SchemaChange, error) {
+	return p.MigrateContext(context.Background(), filename, schema)
+}
+
+// MigrateContext migrates the RRD filename to schema if it differs, returning the
+// changes which were made.
+func (p *Pool) MigrateContext(ctx context.Context, filename string, schema *Schema) ([]*SchemaChange, error) {
+	var r []*SchemaChange
+	err := p.do(ctx, func(c *Client) (err error) {
+		r, err = c.MigrateContext(ctx, filename, schema)
+		return err
+	})
+	return r, err
+}
+
+// Batch initiates the bulk load of multiple commands.
+func (p *Pool) Batch(cmds ...*Cmd) error {
+	return p.BatchContext(context.Background(), cmds...)
+}
+
+// BatchContext initiates the bulk load of multiple commands.
+func (p *Pool) BatchContext(ctx context.Context, cmds ...*Cmd) error {
+	return p.do(ctx, func(c *Client) error {
+		return c.BatchContext(ctx, cmds...)
+	})
+}
+
+// ExecBatch performs the bulk load of multiple commands returning the result of each.
+func (p *Pool) ExecBatch(cmds ...*Cmd) (*BatchResult, error) {
+	return p.ExecBatchContext(context.Background(), cmds...)
+}
+
+// ExecBatchContext performs the bulk load of multiple commands returning the result of each.
+func (p *Pool) ExecBatchContext(ctx context.Context, cmds ...*Cmd) (*BatchResult, error) {
+	var r *BatchResult
+	err := p.do(ctx, func(c *Client) (err error) {
+		r, err = c.ExecBatchContext(ctx, cmds...)
+		return err
+	})
+	return r, err
+}
+
+// RetryBatch performs the bulk load of the commands which failed in r.
+// If there were no failures it returns r.
+func (p *Pool) RetryBatch(r *BatchResult) (*BatchResult, error) {
+	return p.RetryBatchContext(context.Background(), r)
+}
+
+// RetryBatchContext performs the bulk load of the commands which failed in r.
+// If there were no failures it returns r.
+func (p *Pool) RetryBatchContext(ctx context.Context, r *BatchResult) (*BatchResult, error) {
+	if len(r.Errors) == 0 {
+		return r, nil
+	}
+
+	return p.ExecBatchContext(ctx, r.Failed()...)
+}
@@ -0,0 +1,129 @@
+package rrd
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPool(t *testing.T) {
+	s := newServer(t)
+	if s == nil {
+		return
+	}
+	defer func() {
+		assert.NoError(t, s.Close())
+	}()
+
+	p, err := NewPool(s.Addr, MaxOpen(4), MaxIdle(2), ClientOptions(Timeout(time.Second*2)))
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 10; j++ {
+				assert.NoError(t, p.Ping())
+				ts, err := p.Last("test.rrd")
+				if assert.NoError(t, err) {
+					assert.Equal(t, time.Unix(1499981700, 0), ts)
+				}
+			}
+		}()
+	}
+	wg.Wait()
+
+	assert.True(t, len(p.idle) <= 2)
+
+	err = p.Wrote("test.rrd")
+	if assert.Error(t, err) {
+		assert.IsType(t, &Error{}, err)
+	}
+
+	// A FetchStream stopped by its function leaves the client idle.
+	errTest := errors.New("test")
+	idle := len(p.idle)
+	_, err = p.FetchStream("test.rrd", Average, func(f *Fetch, row *FetchRow) error {
+		return errTest
+	})
+	assert.Equal(t, errTest, err)
+	assert.Equal(t, idle, len(p.idle))
+
+	// As does an error detected before the command is sent.
+	_, err = p.Fetch("test.rrd", Average, FetchOptions{}, FetchOptions{})
+	assert.Error(t, err)
+	assert.Equal(t, idle, len(p.idle))
+
+	assert.NoError(t, p.Close())
+	assert.Equal(t, ErrPoolClosed, p.Ping())
+	assert.Equal(t, ErrPoolClosed, p.Close())
+}
+
+func TestPoolNilOption(t *testing.T) {
+	_, err := NewPool("", nil)
+	assert.Equal(t, ErrNilOption, err)
+
+	_, err = NewPool("", ClientOptions(nil))
+	assert.Equal(t, ErrNilOption, err)
+}
+
+func TestPoolCheckIdle(t *testing.T) {
+	s := newServer(t)
+	if s == nil {
+		return
+	}
+	defer func() {
+		assert.NoError(t, s.Close())
+	}()
+
+	p, err := NewPool(s.Addr, CheckIdle(0), ClientOptions(Timeout(time.Second*2)))
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer func() {
+		assert.NoError(t, p.Close())
+	}()
+
+	assert.NoError(t, p.Ping())
+	s.dropConns()
+
+	// The broken idle connection is detected and replaced.
+	assert.NoError(t, p.Ping())
+}
+
+func TestPoolMaxOpen(t *testing.T) {
+	s := newServer(t)
+	if s == nil {
+		return
+	}
+	defer func() {
+		assert.NoError(t, s.Close())
+	}()
+
+	p, err := NewPool(s.Addr, MaxOpen(1), ClientOptions(Timeout(time.Second*2)))
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer func() {
+		assert.NoError(t, p.Close())
+	}()
+
+	c, err := p.get(context.Background())
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond*50)
+	defer cancel()
+	assert.Equal(t, context.DeadlineExceeded, p.PingContext(ctx))
+
+	p.put(c)
+	assert.NoError(t, p.Ping())
+}
@@ -0,0 +1,109 @@
+package rrd
+
+import (
+	"context"
+	"math/rand"
+	"time"
+)
+
+var (
+	// DefaultReconnectPolicy is the ReconnectPolicy used if a field of the
+	// policy passed to Reconnect isn't set.
+	DefaultReconnectPolicy = ReconnectPolicy{
+		Attempts: 5,
+		MinDelay: time.Millisecond * 100,
+		MaxDelay: time.Second * 10,
+	}
+
+	// idempotent are the commands which are safe to retry, by lower case name.
+	idempotent = map[string]bool{
+		"ping":     true,
+		"stats":    true,
+		"info":     true,
+		"fetch":    true,
+		"fetchbin": true,
+		"first":    true,
+		"last":     true,
+		"help":     true,
+		"pending":  true,
+		"queue":    true,
+		"list":     true,
+	}
+)
+
+// ReconnectPolicy configures how a Client re-establishes a broken connection.
+type ReconnectPolicy struct {
+	// Attempts is the maximum number of dials performed before giving up.
+	Attempts int
+
+	// MinDelay is the base delay between dial attempts,
+	// which doubles after every failed attempt.
+	MinDelay time.Duration
+
+	// MaxDelay is the maximum delay between dial attempts.
+	MaxDelay time.Duration
+}
+
+// Reconnect enables automatic reconnection of a broken connection for a rrdcached Client.
+//
+// The connection is redialed using exponential backoff with jitter as defined by policy
+// and idempotent commands, such as ping, stats, info, fetch, first and last, are retried
+// transparently. Non-idempotent commands, such as update, return an UncertainError as
+// it's unknown if rrdcached processed them before the connection failed.
+func Reconnect(policy ReconnectPolicy) func(*Client) error {
+	return func(c *Client) error {
+		if policy.Attempts <= 0 {
+			policy.Attempts = DefaultReconnectPolicy.Attempts
+		}
+		if policy.MinDelay <= 0 {
+			policy.MinDelay = DefaultReconnectPolicy.MinDelay
+		}
+		if policy.MaxDelay <= 0 {
+			policy.MaxDelay = DefaultReconnectPolicy.MaxDelay
+		}
+		c.reconnect = &policy
+		return nil
+	}
+}
+
+// delay returns the randomised delay before dial attempt n, which must be > 0.
+func (p *ReconnectPolicy) delay(n int) time.Duration {
+	d := p.MinDelay << uint(n-1)
+	if d > p.MaxDelay || d <= 0 {
+		d = p.MaxDelay
+	}
+
+	// Equal jitter, so we never retry immediately.
+	return d/2 + time.Duration(rand.Int63n(int64(d/2)+1))
+}
+
+// redial re-establishes the clients connection as defined by its ReconnectPolicy.
+func (c *Client) redial(ctx context.Context) error {
+	var err error
+	for n := 0; n < c.reconnect.Attempts; n++ {
+		if n > 0 {
+			if err := sleep(ctx, c.reconnect.delay(n)); err != nil {
+				return err
+			}
+		}
+
+		if err = c.dial(ctx); err == nil {
+			return nil
+		}
+	}
+
+	return err
+}
+
+// sleep pauses for d or until ctx is done, returning the error from ctx if it was.
+func sleep(ctx context.Context, d time.Duration) error {
+	t := time.NewTimer(d)
+	defer t.Stop()
+
+	select {
+	case <-t.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
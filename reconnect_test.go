@@ -0,0 +1,115 @@
+package rrd
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestReconnect(t *testing.T) {
+	s := newServer(t)
+	if s == nil {
+		return
+	}
+	defer func() {
+		assert.NoError(t, s.Close())
+	}()
+
+	policy := ReconnectPolicy{Attempts: 3, MinDelay: time.Millisecond, MaxDelay: time.Millisecond * 10}
+	c, err := NewClient(s.Addr, Timeout(time.Second*2), Reconnect(policy))
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	defer func() {
+		assert.NoError(t, c.Close())
+	}()
+
+	assert.NoError(t, c.Ping())
+
+	// Idempotent commands are retried.
+	s.dropConns()
+	ts, err := c.Last("test.rrd")
+	if assert.NoError(t, err) {
+		assert.Equal(t, time.Unix(1499981700, 0), ts)
+	}
+
+	// Command names are case insensitive.
+	s.dropConns()
+	_, err = c.Exec("PING")
+	assert.NoError(t, err)
+
+	// Non-idempotent commands report an uncertain delivery.
+	s.dropConns()
+	err = c.Update("test.rrd", "1499968801:U")
+	if assert.Error(t, err) {
+		assert.True(t, IsUncertain(err))
+	}
+
+	// The next command reconnects.
+	assert.NoError(t, c.Update("test.rrd", "1499968801:U"))
+}
+
+func TestReconnectDisabled(t *testing.T) {
+	s := newServer(t)
+	if s == nil {
+		return
+	}
+	defer func() {
+		assert.NoError(t, s.Close())
+	}()
+
+	c, err := NewClient(s.Addr, Timeout(time.Second*2))
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	defer func() {
+		assert.NoError(t, c.Close())
+	}()
+
+	// Ensure the server has accepted the connection before dropping it.
+	assert.NoError(t, c.Ping())
+
+	s.dropConns()
+	err = c.Ping()
+	if assert.Error(t, err) {
+		assert.False(t, IsUncertain(err))
+	}
+	assert.Equal(t, ErrConnAborted, c.Ping())
+}
+
+func TestReconnectFail(t *testing.T) {
+	s := newServer(t)
+	if s == nil {
+		return
+	}
+
+	policy := ReconnectPolicy{Attempts: 2, MinDelay: time.Millisecond, MaxDelay: time.Millisecond}
+	c, err := NewClient(s.Addr, Timeout(time.Second*2), Reconnect(policy))
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	defer func() {
+		assert.NoError(t, c.Close())
+	}()
+
+	assert.NoError(t, s.Close())
+	assert.Error(t, c.Ping())
+	assert.Error(t, c.Ping())
+}
+
+func TestReconnectPolicyDelay(t *testing.T) {
+	p := ReconnectPolicy{MinDelay: time.Millisecond * 100, MaxDelay: time.Second}
+	for n := 1; n < 100; n++ {
+		d := p.delay(n)
+		max := p.MinDelay << uint(n-1)
+		if max > p.MaxDelay || max <= 0 {
+			max = p.MaxDelay
+		}
+		assert.True(t, d >= max/2, "delay %v too short for attempt %v", d, n)
+		assert.True(t, d <= max, "delay %v too long for attempt %v", d, n)
+	}
+}
@@ -2,6 +2,8 @@ package rrd
 
 import (
 	"fmt"
+	"math"
+	"strconv"
 	"strings"
 )
 
@@ -87,3 +89,176 @@ func NewDevPredict(rows, idx int) RRA {
 func NewFailures(rows, threshold, window, idx int) RRA {
 	return newRRA(Failures, rows, threshold, window, idx)
 }
+
+// RRADef represents a parsed round robin archive definition.
+type RRADef struct {
+	CF string
+
+	// XFF and Steps are only used by the AVERAGE, MIN, MAX and LAST
+	// consolidation functions, Steps is 1 for the others.
+	XFF   float64
+	Steps int
+
+	// Rows is the number of rows, which for SEASONAL and DEVSEASONAL is
+	// the seasonal period.
+	Rows int
+
+	// Alpha, Beta and SeasonalPeriod are the parameters of HWPREDICT and MHWPREDICT.
+	Alpha          float64
+	Beta           float64
+	SeasonalPeriod int
+
+	// Gamma and SmoothingWindow are the parameters of SEASONAL and DEVSEASONAL,
+	// SmoothingWindow is NaN if not specified.
+	Gamma           float64
+	SmoothingWindow float64
+
+	// Threshold and Window are the parameters of FAILURES.
+	Threshold int
+	Window    int
+
+	// Index is the 1-based index of the RRA which a Holt-Winters RRA
+	// depends on, zero if not specified.
+	Index int
+}
+
+// ParseRRA parses the round robin archive definition r, in the form returned
+// by the RRA builders.
+func ParseRRA(r RRA) (*RRADef, error) {
+	parts := strings.Split(string(r), ":")
+	if len(parts) < 3 || parts[0] != "RRA" {
+		return nil, fmt.Errorf("invalid RRA format: %v", r)
+	}
+
+	def := &RRADef{CF: parts[1], Steps: 1, XFF: math.NaN(), SmoothingWindow: math.NaN()}
+	p := &rraParser{parts: parts[2:]}
+	switch def.CF {
+	case Average, Min, Max, Last:
+		// RRA:CF:xff:steps:rows
+		p.float(&def.XFF)
+		p.int(&def.Steps)
+		p.int(&def.Rows)
+	case HoltWintersPredict, MultipliedHoltWinterPredict:
+		// RRA:HWPREDICT:rows:alpha:beta:seasonal-period[:rra-num]
+		p.int(&def.Rows)
+		p.float(&def.Alpha)
+		p.float(&def.Beta)
+		p.int(&def.SeasonalPeriod)
+		p.optionalInt(&def.Index)
+	case Seasonal, DevSeasonal:
+		// RRA:SEASONAL:seasonal-period:gamma:rra-num[:smoothing-window=fraction]
+		p.int(&def.Rows)
+		p.float(&def.Gamma)
+		p.int(&def.Index)
+		if len(p.parts) > 0 {
+			v := strings.TrimPrefix(p.parts[0], "smoothing-window=")
+			if v == p.parts[0] {
+				p.err = fmt.Errorf("invalid argument %q", v)
+			} else {
+				p.parts[0] = v
+				p.float(&def.SmoothingWindow)
+			}
+		}
+	case DevPredict:
+		// RRA:DEVPREDICT:rows:rra-num
+		p.int(&def.Rows)
+		p.int(&def.Index)
+	case Failures:
+		// RRA:FAILURES:rows:threshold:window-length:rra-num
+		p.int(&def.Rows)
+		p.int(&def.Threshold)
+		p.int(&def.Window)
+		p.int(&def.Index)
+	default:
+		return nil, fmt.Errorf("invalid RRA consolidation function %v: %v", def.CF, r)
+	}
+
+	if p.err == nil && len(p.parts) != 0 {
+		p.err = fmt.Errorf("unexpected arguments %v", strings.Join(p.parts, ":"))
+	}
+
+	if p.err != nil {
+		return nil, fmt.Errorf("invalid RRA %v: %v", r, p.err)
+	}
+
+	return def, nil
+}
+
+// RRA returns the round robin archive definition of r.
+func (r *RRADef) RRA() RRA {
+	switch r.CF {
+	case HoltWintersPredict, MultipliedHoltWinterPredict:
+		vals := []interface{}{r.Rows, formatFloat(r.Alpha), formatFloat(r.Beta), r.SeasonalPeriod}
+		if r.Index != 0 {
+			vals = append(vals, r.Index)
+		}
+		return newRRA(r.CF, vals...)
+	case Seasonal, DevSeasonal:
+		vals := []interface{}{r.Rows, formatFloat(r.Gamma), r.Index}
+		if !math.IsNaN(r.SmoothingWindow) {
+			vals = append(vals, "smoothing-window="+formatFloat(r.SmoothingWindow))
+		}
+		return newRRA(r.CF, vals...)
+	case DevPredict:
+		return newRRA(r.CF, r.Rows, r.Index)
+	case Failures:
+		return newRRA(r.CF, r.Rows, r.Threshold, r.Window, r.Index)
+	}
+
+	return newRRA(r.CF, formatFloat(r.XFF), r.Steps, r.Rows)
+}
+
+// rraParser parses the colon separated arguments of an RRA definition,
+// recording the first error.
+type rraParser struct {
+	parts []string
+	err   error
+}
+
+// next returns the next argument or false if there are none or an error occurred.
+func (p *rraParser) next() (string, bool) {
+	if p.err != nil {
+		return "", false
+	}
+
+	if len(p.parts) == 0 {
+		p.err = fmt.Errorf("missing arguments")
+		return "", false
+	}
+
+	v := p.parts[0]
+	p.parts = p.parts[1:]
+	return v, true
+}
+
+// int parses the next argument into v.
+func (p *rraParser) int(v *int) {
+	if s, ok := p.next(); ok {
+		var err error
+		if *v, err = strconv.Atoi(s); err != nil {
+			p.err = fmt.Errorf("invalid integer %q", s)
+		}
+	}
+}
+
+// optionalInt parses the next argument, if any, into v.
+func (p *rraParser) optionalInt(v *int) {
+	if len(p.parts) > 0 {
+		p.int(v)
+	}
+}
+
+// float parses the next argument into v.
+func (p *rraParser) float(v *float64) {
+	if s, ok := p.next(); ok {
+		var err error
+		if *v, err = strconv.ParseFloat(s, 64); err != nil {
+			p.err = fmt.Errorf("invalid number %q", s)
+		}
+	}
+}
+
+// formatFloat formats v in its shortest form.
+func formatFloat(v float64) string {
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
@@ -32,3 +32,76 @@ func TestRRA(t *testing.T) {
 		})
 	}
 }
+
+func TestParseRRA(t *testing.T) {
+	for _, r := range []RRA{
+		NewAverage(0.5, 60, 129600),
+		NewMin(0.5, 60, 129600),
+		NewMax(0.25, 1, 10),
+		NewLast(0, 60, 129600),
+		NewHWPredict(10, 0.5, 0.1, 50, 1),
+		NewMHWPredict(10, 0.5, 0.1, 50, 1),
+		NewSeasonal(10, 0.5, 1, 0.3),
+		NewDevSeasonal(10, 0.5, 1, 0.3),
+		NewDevPredict(10, 1),
+		NewFailures(10, 3, 20, 1),
+		NewRRA("RRA:HWPREDICT:10:0.5:0.1:50"),
+		NewRRA("RRA:SEASONAL:10:0.5:1"),
+	} {
+		t.Run(string(r), func(t *testing.T) {
+			def, err := ParseRRA(r)
+			if assert.NoError(t, err) {
+				assert.Equal(t, r, def.RRA())
+			}
+		})
+	}
+
+	def, err := ParseRRA(NewAverage(0.5, 60, 129600))
+	if assert.NoError(t, err) {
+		assert.Equal(t, Average, def.CF)
+		assert.Equal(t, 0.5, def.XFF)
+		assert.Equal(t, 60, def.Steps)
+		assert.Equal(t, 129600, def.Rows)
+	}
+
+	def, err = ParseRRA(NewHWPredict(10, 0.5, 0.1, 50, 2))
+	if assert.NoError(t, err) {
+		assert.Equal(t, 1, def.Steps)
+		assert.Equal(t, 10, def.Rows)
+		assert.Equal(t, 0.5, def.Alpha)
+		assert.Equal(t, 0.1, def.Beta)
+		assert.Equal(t, 50, def.SeasonalPeriod)
+		assert.Equal(t, 2, def.Index)
+	}
+
+	def, err = ParseRRA(NewDevSeasonal(288, 0.1, 2, 0.05))
+	if assert.NoError(t, err) {
+		assert.Equal(t, 288, def.Rows)
+		assert.Equal(t, 0.1, def.Gamma)
+		assert.Equal(t, 2, def.Index)
+		assert.Equal(t, 0.05, def.SmoothingWindow)
+	}
+
+	def, err = ParseRRA(NewFailures(10, 3, 20, 4))
+	if assert.NoError(t, err) {
+		assert.Equal(t, 3, def.Threshold)
+		assert.Equal(t, 20, def.Window)
+		assert.Equal(t, 4, def.Index)
+	}
+
+	for _, r := range []string{
+		"AVERAGE:0.5:1:10",
+		"RRA:AVERAGE",
+		"RRA:AVERAGE:0.5:1",
+		"RRA:AVERAGE:0.5:1:10:1",
+		"RRA:AVERAGE:x:1:10",
+		"RRA:BOGUS:0.5:1:10",
+		"RRA:HWPREDICT:10:0.5:0.1",
+		"RRA:SEASONAL:10:0.5:1:window=0.3",
+		"RRA:DEVPREDICT:10",
+		"RRA:FAILURES:10:3:20",
+	} {
+		_, err := ParseRRA(NewRRA(r))
+		assert.Error(t, err, r)
+	}
+}
@@ -0,0 +1,400 @@
+package rrdfile
+
+import (
+	"fmt"
+	"math"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/multiplay/go-rrd"
+)
+
+var (
+	// DefaultStep is the step used by Create if no Step option is given.
+	DefaultStep = time.Second * 300
+)
+
+// createOptions represents the parsed options of a create.
+type createOptions struct {
+	step        time.Duration
+	start       time.Time
+	noOverwrite bool
+	template    string
+	sources     []string
+}
+
+// parseCreateOptions parses the rrd.CreateOption values supported by rrdcached.
+func parseCreateOptions(options []rrd.CreateOption) (*createOptions, error) {
+	o := &createOptions{}
+	for _, opt := range options {
+		parts := strings.SplitN(string(opt), " ", 2)
+		val := ""
+		if len(parts) == 2 {
+			val = strings.TrimSpace(parts[1])
+		}
+
+		switch parts[0] {
+		case "-O", "--no-overwrite":
+			o.noOverwrite = true
+		case "-s", "--step":
+			v, err := strconv.ParseInt(val, 10, 64)
+			if err != nil || v < 1 {
+				return nil, fmt.Errorf("invalid step %q", val)
+			}
+			o.step = time.Duration(v) * time.Second
+		case "-b", "--start":
+			v, err := strconv.ParseInt(val, 10, 64)
+			if err != nil {
+				return nil, fmt.Errorf("invalid start %q", val)
+			}
+			o.start = time.Unix(v, 0)
+		case "-t", "--template":
+			if val == "" {
+				return nil, fmt.Errorf("missing template file")
+			}
+			o.template = val
+		case "-r", "--source":
+			if val == "" {
+				return nil, fmt.Errorf("missing source file")
+			}
+			o.sources = append(o.sources, val)
+		default:
+			return nil, fmt.Errorf("unsupported create option %q", opt)
+		}
+	}
+
+	return o, nil
+}
+
+// mapping is the source of a data sources prefill data.
+type mapping struct {
+	name  string
+	index int
+}
+
+// parseDS parses a data source definition of the form DS:name[=mapped[index]]:type:heartbeat:min:max.
+func parseDS(d rrd.DS) (*DS, *mapping, error) {
+	def, err := rrd.ParseDS(d)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	switch {
+	case !rrd.ValidDSName(def.Name):
+		return nil, nil, fmt.Errorf("invalid DS name in %q", d)
+	case def.Type == rrd.Compute:
+		return nil, nil, fmt.Errorf("unsupported DS type %q in %q", def.Type, d)
+	case def.Heartbeat < time.Second:
+		return nil, nil, fmt.Errorf("invalid DS heartbeat in %q", d)
+	case def.Min >= def.Max:
+		return nil, nil, fmt.Errorf("min must be less than max in DS definition %q", d)
+	}
+
+	ds := &DS{
+		Name:      def.Name,
+		Type:      def.Type,
+		Heartbeat: def.Heartbeat,
+		Min:       def.Min,
+		Max:       def.Max,
+		LastDS:    "U",
+	}
+
+	src := &mapping{name: def.Name, index: def.SourceIndex}
+	if def.MappedName != "" {
+		src.name = def.MappedName
+	}
+
+	return ds, src, nil
+}
+
+// parseRRA parses a round robin archive definition of the form RRA:cf:xff:steps:rows.
+func parseRRA(r rrd.RRA) (*RRA, error) {
+	def, err := rrd.ParseRRA(r)
+	if err != nil {
+		return nil, err
+	}
+
+	switch {
+	case !standardCF(def.CF):
+		return nil, fmt.Errorf("unsupported RRA consolidation function %q in %q", def.CF, r)
+	case def.XFF < 0 || def.XFF >= 1:
+		return nil, fmt.Errorf("invalid RRA xff in %q", r)
+	case def.Steps < 1:
+		return nil, fmt.Errorf("invalid RRA steps in %q", r)
+	case def.Rows < 1:
+		return nil, fmt.Errorf("invalid RRA rows in %q", r)
+	}
+
+	return &RRA{CF: def.CF, XFF: def.XFF, PDPPerRow: def.Steps, Rows: def.Rows}, nil
+}
+
+// Create returns a new RRD created from ds and rra with the given options,
+// which are the same as those accepted by rrd.Client.Create.
+//
+// Template and Source options read the named RRD files from disk. Data sources
+// from a template are replaced by those in ds with the same name, its RRAs are
+// replaced if rra is not empty. Sources prefill the data of RRAs with the same
+// consolidation function and resolution from data sources with matching names.
+//
+// COMPUTE data sources and Holt-Winters RRAs are not supported.
+func Create(ds []rrd.DS, rra []rrd.RRA, options ...rrd.CreateOption) (*File, error) {
+	o, err := parseCreateOptions(options)
+	if err != nil {
+		return nil, err
+	}
+
+	return create(ds, rra, o)
+}
+
+// CreateFile creates the RRD file filename from ds and rra with the given
+// options, which are the same as those accepted by rrd.Client.Create.
+//
+// If the NoOverwrite option is given and filename exists an error satisfying
+// os.IsExist is returned.
+func CreateFile(filename string, ds []rrd.DS, rra []rrd.RRA, options ...rrd.CreateOption) error {
+	o, err := parseCreateOptions(options)
+	if err != nil {
+		return err
+	}
+
+	f, err := create(ds, rra, o)
+	if err != nil {
+		return err
+	}
+
+	if !o.noOverwrite {
+		return f.WriteFile(filename)
+	}
+
+	b, err := f.encode()
+	if err != nil {
+		return err
+	}
+
+	w, err := os.OpenFile(filename, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+	if err != nil {
+		return err
+	}
+
+	if _, err = w.Write(b); err != nil {
+		w.Close() // nolint: errcheck
+		return err
+	}
+
+	return w.Close()
+}
+
+// create returns a new RRD created from ds and rra with the options o.
+func create(ds []rrd.DS, rra []rrd.RRA, o *createOptions) (*File, error) {
+	f := &File{Version: "0003", Step: DefaultStep, layout: native}
+	if o.template != "" {
+		tmpl, err := Open(o.template)
+		if err != nil {
+			return nil, err
+		}
+
+		f.Step = tmpl.Step
+		for _, d := range tmpl.DS {
+			if d.Type == rrd.Compute {
+				return nil, fmt.Errorf("template %v: unsupported DS type %v", o.template, d.Type)
+			}
+			f.DS = append(f.DS, &DS{Name: d.Name, Type: d.Type, Heartbeat: d.Heartbeat, Min: d.Min, Max: d.Max})
+		}
+		for _, r := range tmpl.RRA {
+			if !standardCF(r.CF) {
+				return nil, fmt.Errorf("template %v: unsupported RRA consolidation function %v", o.template, r.CF)
+			}
+			f.RRA = append(f.RRA, &RRA{CF: r.CF, Rows: r.Rows, PDPPerRow: r.PDPPerRow, XFF: r.XFF})
+		}
+	}
+
+	if o.step > 0 {
+		f.Step = o.step
+	}
+
+	mappings := make(map[string]*mapping)
+	for _, d := range ds {
+		def, m, err := parseDS(d)
+		if err != nil {
+			return nil, err
+		}
+
+		if _, ok := mappings[def.Name]; ok {
+			return nil, fmt.Errorf("duplicate DS name %v", def.Name)
+		}
+		mappings[def.Name] = m
+		if i := f.index(def.Name); i != -1 {
+			f.DS[i] = def
+		} else {
+			f.DS = append(f.DS, def)
+		}
+	}
+
+	if len(rra) > 0 {
+		f.RRA = nil
+		for _, r := range rra {
+			def, err := parseRRA(r)
+			if err != nil {
+				return nil, err
+			}
+			f.RRA = append(f.RRA, def)
+		}
+	}
+
+	switch {
+	case len(f.DS) == 0:
+		return nil, fmt.Errorf("you must define at least one Data Source")
+	case len(f.RRA) == 0:
+		return nil, fmt.Errorf("you must define at least one Round Robin Archive")
+	}
+
+	for _, d := range f.DS {
+		if d.Type == rrd.DCounter || d.Type == rrd.DDerive {
+			f.Version = "0004"
+		}
+	}
+
+	sources := make([]*File, len(o.sources))
+	start := o.start
+	for i, name := range o.sources {
+		src, err := Open(name)
+		if err != nil {
+			return nil, err
+		}
+		sources[i] = src
+		if o.start.IsZero() && src.Last().After(start) {
+			start = src.Last()
+		}
+	}
+
+	if start.IsZero() {
+		start = time.Now().Add(-time.Second * 10)
+	}
+	f.init(start)
+
+	for i, src := range sources {
+		f.prefill(src, i+1, mappings)
+	}
+
+	e := &encoder{layout: f.layout}
+	f.header(e)
+	f.headerSize = len(e.buf)
+
+	return f, nil
+}
+
+// index returns the index of the DS name or -1 if not found.
+func (f *File) index(name string) int {
+	for i, ds := range f.DS {
+		if ds.Name == name {
+			return i
+		}
+	}
+	return -1
+}
+
+// init initialises the live state of f for a last update of start, as done by rrdtool create.
+func (f *File) init(start time.Time) {
+	step := int64(f.Step / time.Second)
+	last := start.Unix()
+	f.LastUpdate = time.Unix(last, 0)
+
+	for _, ds := range f.DS {
+		ds.LastDS = "U"
+		ds.Value = 0
+		ds.UnknownSec = int(last % step)
+	}
+
+	for _, rra := range f.RRA {
+		rra.CDPPrep = make([]*CDPPrep, len(f.DS))
+		for i, ds := range f.DS {
+			rra.CDPPrep[i] = &CDPPrep{
+				Value:             math.NaN(),
+				UnknownDatapoints: int((last - int64(ds.UnknownSec)) % (step * int64(rra.PDPPerRow)) / step),
+			}
+		}
+
+		// rrdtool 1.4 and later start each RRA at a random row, to spread the
+		// writes of many files over the disk. The first row written is always
+		// the first one here so files created from the same definition are
+		// identical, which makes no difference to the data read back.
+		rra.CurRow = rra.Rows - 1
+		rra.Data = make([][]float64, rra.Rows)
+		for i := range rra.Data {
+			row := make([]float64, len(f.DS))
+			for j := range row {
+				row[j] = math.NaN()
+			}
+			rra.Data[i] = row
+		}
+	}
+}
+
+// prefill copies data from the RRAs of src, which is the nth source, with
+// the same consolidation function and resolution for the mapped data sources.
+// If src was last updated at the same time as f its live state is also copied.
+func (f *File) prefill(src *File, n int, mappings map[string]*mapping) {
+	idx := make([]int, len(f.DS))
+	for i, ds := range f.DS {
+		m := mappings[ds.Name]
+		if m == nil {
+			m = &mapping{name: ds.Name}
+		}
+
+		idx[i] = -1
+		if m.index == 0 || m.index == n {
+			idx[i] = src.index(m.name)
+		}
+	}
+
+	live := src.Last().Equal(f.LastUpdate)
+	for i, j := range idx {
+		if j != -1 && live {
+			ds, sds := f.DS[i], src.DS[j]
+			ds.LastDS, ds.Value, ds.UnknownSec = sds.LastDS, sds.Value, sds.UnknownSec
+		}
+	}
+
+	for _, rra := range f.RRA {
+		step := f.step(rra)
+		var srra *RRA
+		for _, r := range src.RRA {
+			if r.CF == rra.CF && src.step(r) == step {
+				srra = r
+				break
+			}
+		}
+		if srra == nil {
+			continue
+		}
+
+		end, send := f.end(rra), src.end(srra)
+		for age := 0; age < rra.Rows; age++ {
+			sage := (send-end)/step + int64(age)
+			if sage < 0 {
+				continue
+			} else if sage >= int64(srra.Rows) {
+				break
+			}
+
+			row := rra.Data[(rra.CurRow-age+rra.Rows)%rra.Rows]
+			srow := srra.Data[(srra.CurRow-int(sage)+srra.Rows)%srra.Rows]
+			for i, j := range idx {
+				if j != -1 && !math.IsNaN(srow[j]) {
+					row[i] = srow[j]
+				}
+			}
+		}
+
+		if live && src.Step == f.Step && srra.PDPPerRow == rra.PDPPerRow {
+			for i, j := range idx {
+				if j != -1 {
+					cdp := srra.CDPPrep[j]
+					rra.CDPPrep[i] = &CDPPrep{Value: cdp.Value, UnknownDatapoints: cdp.UnknownDatapoints}
+				}
+			}
+		}
+	}
+}
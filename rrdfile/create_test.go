@@ -0,0 +1,179 @@
+package rrdfile
+
+import (
+	"bytes"
+	"io/ioutil"
+	"math"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/multiplay/go-rrd"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCreate(t *testing.T) {
+	f, err := Create(
+		[]rrd.DS{
+			rrd.NewGauge("g", time.Minute*10, 0, 100),
+			rrd.NewDS("DS:c:COUNTER:900:U:U"),
+		},
+		[]rrd.RRA{rrd.NewAverage(0.5, 1, 10), rrd.NewMax(0.25, 3, 5)},
+		rrd.Step(time.Minute*5),
+		rrd.Start(testEnd.Add(time.Second*60)),
+	)
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	assert.Equal(t, "0003", f.Version)
+	assert.Equal(t, time.Minute*5, f.Step)
+	assert.Equal(t, testEnd.Add(time.Second*60), f.LastUpdate)
+
+	if assert.Len(t, f.DS, 2) {
+		ds := f.DS[0]
+		assert.Equal(t, "g", ds.Name)
+		assert.Equal(t, rrd.Gauge, ds.Type)
+		assert.Equal(t, time.Minute*10, ds.Heartbeat)
+		assert.Equal(t, float64(0), ds.Min)
+		assert.Equal(t, float64(100), ds.Max)
+		assert.Equal(t, "U", ds.LastDS)
+		assert.Equal(t, 60, ds.UnknownSec)
+
+		ds = f.DS[1]
+		assert.Equal(t, rrd.Counter, ds.Type)
+		assert.True(t, math.IsNaN(ds.Min))
+		assert.True(t, math.IsNaN(ds.Max))
+	}
+
+	if assert.Len(t, f.RRA, 2) {
+		rra := f.RRA[1]
+		assert.Equal(t, rrd.Max, rra.CF)
+		assert.Equal(t, 0.25, rra.XFF)
+		assert.Equal(t, 3, rra.PDPPerRow)
+		assert.Equal(t, 5, rra.Rows)
+		assert.Equal(t, 4, rra.CurRow)
+		// testEnd is 2 primary data points into a 3 step row.
+		assert.Equal(t, 2, rra.CDPPrep[0].UnknownDatapoints)
+		assert.True(t, math.IsNaN(rra.CDPPrep[0].Value))
+		for _, row := range rra.Data {
+			assert.True(t, math.IsNaN(row[0]))
+			assert.True(t, math.IsNaN(row[1]))
+		}
+	}
+
+	// Created files must round trip.
+	var buf bytes.Buffer
+	if _, err = f.WriteTo(&buf); !assert.NoError(t, err) {
+		return
+	}
+
+	f2, err := Read(bytes.NewReader(buf.Bytes()))
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	var buf2 bytes.Buffer
+	if _, err = f2.WriteTo(&buf2); assert.NoError(t, err) {
+		assert.Equal(t, buf.Bytes(), buf2.Bytes())
+	}
+	assert.Equal(t, len(f.Info()), len(f2.Info()))
+}
+
+func TestCreateErrors(t *testing.T) {
+	ds := []rrd.DS{rrd.NewGauge("g", time.Minute, 0, 100)}
+	rra := []rrd.RRA{rrd.NewAverage(0.5, 1, 10)}
+
+	tests := []struct {
+		name    string
+		ds      []rrd.DS
+		rra     []rrd.RRA
+		options []rrd.CreateOption
+	}{
+		{name: "no-ds", rra: rra},
+		{name: "no-rra", ds: ds},
+		{name: "ds-format", ds: []rrd.DS{"DS:g:GAUGE:60:0"}, rra: rra},
+		{name: "ds-name", ds: []rrd.DS{"DS:g-1:GAUGE:60:0:U"}, rra: rra},
+		{name: "ds-type", ds: []rrd.DS{"DS:g:BOGUS:60:0:U"}, rra: rra},
+		{name: "ds-compute", ds: []rrd.DS{rrd.NewCompute("c", "g,2,*")}, rra: rra},
+		{name: "ds-heartbeat", ds: []rrd.DS{"DS:g:GAUGE:0:0:U"}, rra: rra},
+		{name: "ds-min-max", ds: []rrd.DS{rrd.NewGauge("g", time.Minute, 10, 1)}, rra: rra},
+		{name: "ds-duplicate", ds: append(ds, ds...), rra: rra},
+		{name: "rra-cf", ds: ds, rra: []rrd.RRA{"RRA:HWPREDICT:1440:0.1:0.0035:288"}},
+		{name: "rra-xff", ds: ds, rra: []rrd.RRA{rrd.NewAverage(1, 1, 10)}},
+		{name: "rra-rows", ds: ds, rra: []rrd.RRA{rrd.NewAverage(0.5, 1, 0)}},
+		{name: "option", ds: ds, rra: rra, options: []rrd.CreateOption{"-x"}},
+		{name: "step", ds: ds, rra: rra, options: []rrd.CreateOption{rrd.Step(0)}},
+		{name: "template", ds: ds, rra: rra, options: []rrd.CreateOption{rrd.Template("missing.rrd")}},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := Create(tc.ds, tc.rra, tc.options...)
+			assert.Error(t, err)
+		})
+	}
+}
+
+func TestCreateFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "rrdfile")
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer os.RemoveAll(dir) // nolint: errcheck
+
+	filename := filepath.Join(dir, "test.rrd")
+	ds := []rrd.DS{rrd.NewGauge("g", time.Minute*10, 0, 100)}
+	rra := []rrd.RRA{rrd.NewAverage(0.5, 1, 10)}
+	start := rrd.Start(testEnd)
+	if !assert.NoError(t, CreateFile(filename, ds, rra, start)) {
+		return
+	}
+
+	err = CreateFile(filename, ds, rra, start, rrd.NoOverwrite())
+	assert.True(t, os.IsExist(err))
+	assert.NoError(t, CreateFile(filename, ds, rra, start))
+
+	// Template replaces data sources by name and keeps the RRAs.
+	tmpl := filepath.Join(dir, "tmpl.rrd")
+	err = CreateFile(tmpl, []rrd.DS{rrd.NewGauge("g", time.Minute*20, 0, 50), rrd.NewGauge("h", time.Minute, 0, 1)}, nil,
+		start, rrd.Template(filename))
+	if assert.NoError(t, err) {
+		f, err := Open(tmpl)
+		if assert.NoError(t, err) && assert.Len(t, f.DS, 2) && assert.Len(t, f.RRA, 1) {
+			assert.Equal(t, time.Minute*20, f.DS[0].Heartbeat)
+			assert.Equal(t, "h", f.DS[1].Name)
+			assert.Equal(t, 10, f.RRA[0].Rows)
+		}
+	}
+
+	// Source prefills data from matching data sources and RRAs.
+	if !assert.NoError(t, UpdateFile(filename, rrd.NewUpdate(testEnd.Add(time.Second*300), 10), rrd.NewUpdate(testEnd.Add(time.Second*600), 20))) {
+		return
+	}
+
+	prefilled := filepath.Join(dir, "prefilled.rrd")
+	err = CreateFile(prefilled, []rrd.DS{"DS:x=g:GAUGE:600:0:100", rrd.NewGauge("g", time.Minute*10, 0, 100)}, rra, rrd.Source(filename))
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	f, err := Open(prefilled)
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	assert.Equal(t, testEnd.Add(time.Second*600), f.LastUpdate)
+	assert.Equal(t, "20", f.DS[0].LastDS)
+	r, err := f.Fetch(rrd.Average, testEnd, testEnd.Add(time.Second*600))
+	if assert.NoError(t, err) && assert.Len(t, r.Rows, 2) {
+		for i, v := range []float64{10, 20} {
+			for _, d := range r.Rows[i].Data {
+				if assert.NotNil(t, d) {
+					assert.Equal(t, v, *d)
+				}
+			}
+		}
+	}
+}
@@ -0,0 +1,480 @@
+package rrdfile
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/multiplay/go-rrd"
+)
+
+const (
+	// dumpHeader precedes the XML of a dump, as written by rrdtool dump.
+	dumpHeader = xml.Header + `<!DOCTYPE rrd SYSTEM "https://oss.oetiker.ch/rrdtool/rrdtool.dtd">` + "\n" +
+		"<!-- Round Robin Database Dump -->\n"
+
+	// failuresWindowMax is the maximum window length of a FAILURES RRA.
+	failuresWindowMax = 28
+)
+
+// Float is a floating point value in a Dump, which is formatted the same way as rrdtool.
+type Float float64
+
+// NewFloat returns a pointer to the Float v.
+func NewFloat(v float64) *Float {
+	f := Float(v)
+	return &f
+}
+
+// MarshalText implements encoding.TextMarshaler.
+func (f Float) MarshalText() ([]byte, error) {
+	v := float64(f)
+	switch {
+	case math.IsNaN(v):
+		return []byte("NaN"), nil
+	case math.IsInf(v, 1):
+		return []byte("Inf"), nil
+	case math.IsInf(v, -1):
+		return []byte("-Inf"), nil
+	}
+	return []byte(fmt.Sprintf("%0.10e", v)), nil
+}
+
+// UnmarshalText implements encoding.TextUnmarshaler.
+func (f *Float) UnmarshalText(b []byte) error {
+	v, err := strconv.ParseFloat(strings.TrimSpace(string(b)), 64)
+	if err != nil {
+		return err
+	}
+	*f = Float(v)
+	return nil
+}
+
+// value returns the value of f or NaN if it's nil.
+func (f *Float) value() float64 {
+	if f == nil {
+		return math.NaN()
+	}
+	return float64(*f)
+}
+
+// newCount returns a pointer to the count v.
+func newCount(v uint64) *int64 {
+	c := int64(v)
+	return &c
+}
+
+// count returns the value of c or 0 if it's nil.
+func count(c *int64) uint64 {
+	if c == nil {
+		return 0
+	}
+	return uint64(*c)
+}
+
+// DumpDS represents a data source in a Dump.
+type DumpDS struct {
+	Name             string `xml:"name"`
+	Type             string `xml:"type"`
+	MinimalHeartbeat int64  `xml:"minimal_heartbeat"`
+	Min              Float  `xml:"min"`
+	Max              Float  `xml:"max"`
+	LastDS           string `xml:"last_ds"`
+	Value            Float  `xml:"value"`
+	UnknownSec       int64  `xml:"unknown_sec"`
+}
+
+// DumpParams represents the parameters of an RRA in a Dump.
+// Only those relevant to the RRAs consolidation function are set.
+type DumpParams struct {
+	SeasonalSmoothIdx *int64 `xml:"seasonal_smooth_idx,omitempty"`
+	SmoothingWindow   *Float `xml:"smoothing_window,omitempty"`
+	HWAlpha           *Float `xml:"hw_alpha,omitempty"`
+	HWBeta            *Float `xml:"hw_beta,omitempty"`
+	HWGamma           *Float `xml:"hw_gamma,omitempty"`
+	DeltaPos          *Float `xml:"delta_pos,omitempty"`
+	DeltaNeg          *Float `xml:"delta_neg,omitempty"`
+	WindowLen         *int64 `xml:"window_len,omitempty"`
+	FailureThreshold  *int64 `xml:"failure_threshold,omitempty"`
+	DependentRRAIdx   *int64 `xml:"dependent_rra_idx,omitempty"`
+	XFF               *Float `xml:"xff,omitempty"`
+}
+
+// DumpCDPPrep represents the consolidation state of a data source in an RRA in a Dump.
+// Only the values relevant to the RRAs consolidation function are set.
+type DumpCDPPrep struct {
+	PrimaryValue      *Float  `xml:"primary_value,omitempty"`
+	SecondaryValue    *Float  `xml:"secondary_value,omitempty"`
+	Intercept         *Float  `xml:"intercept,omitempty"`
+	LastIntercept     *Float  `xml:"last_intercept,omitempty"`
+	Slope             *Float  `xml:"slope,omitempty"`
+	LastSlope         *Float  `xml:"last_slope,omitempty"`
+	NaNCount          *int64  `xml:"nan_count,omitempty"`
+	LastNaNCount      *int64  `xml:"last_nan_count,omitempty"`
+	Seasonal          *Float  `xml:"seasonal,omitempty"`
+	LastSeasonal      *Float  `xml:"last_seasonal,omitempty"`
+	InitFlag          *int64  `xml:"init_flag,omitempty"`
+	History           *string `xml:"history,omitempty"`
+	Value             *Float  `xml:"value,omitempty"`
+	UnknownDatapoints *int64  `xml:"unknown_datapoints,omitempty"`
+}
+
+// DumpRow represents a row of an RRA in a Dump.
+type DumpRow struct {
+	Comment string  `xml:",comment"`
+	Values  []Float `xml:"v"`
+}
+
+// DumpRRA represents a round robin archive in a Dump.
+type DumpRRA struct {
+	CF        string         `xml:"cf"`
+	PDPPerRow int64          `xml:"pdp_per_row"`
+	Params    DumpParams     `xml:"params"`
+	CDPPrep   []*DumpCDPPrep `xml:"cdp_prep>ds"`
+
+	// Database contains the rows of the RRA, oldest first.
+	Database []*DumpRow `xml:"database>row"`
+}
+
+// Dump represents an RRD in rrdtool's XML dump format.
+type Dump struct {
+	XMLName    xml.Name   `xml:"rrd"`
+	Version    string     `xml:"version"`
+	Step       int64      `xml:"step"`
+	LastUpdate int64      `xml:"lastupdate"`
+	DS         []*DumpDS  `xml:"ds"`
+	RRA        []*DumpRRA `xml:"rra"`
+}
+
+// ReadDump reads an RRD in rrdtool's XML dump format from r.
+func ReadDump(r io.Reader) (*Dump, error) {
+	d := &Dump{}
+	if err := xml.NewDecoder(r).Decode(d); err != nil {
+		return nil, err
+	}
+
+	d.Version = strings.TrimSpace(d.Version)
+	for _, ds := range d.DS {
+		ds.Name = strings.TrimSpace(ds.Name)
+		ds.Type = strings.TrimSpace(ds.Type)
+		ds.LastDS = strings.TrimSpace(ds.LastDS)
+	}
+
+	for _, rra := range d.RRA {
+		rra.CF = strings.TrimSpace(rra.CF)
+		for _, cdp := range rra.CDPPrep {
+			if cdp.History != nil {
+				h := strings.TrimSpace(*cdp.History)
+				cdp.History = &h
+			}
+		}
+	}
+
+	return d, nil
+}
+
+// Restore reads an RRD in rrdtool's XML dump format from r, returning it as a File.
+func Restore(r io.Reader) (*File, error) {
+	d, err := ReadDump(r)
+	if err != nil {
+		return nil, err
+	}
+
+	return d.File()
+}
+
+// WriteTo writes d to w in rrdtool's XML dump format.
+func (d *Dump) WriteTo(w io.Writer) (int64, error) {
+	step := time.Duration(d.Step) * time.Second
+	for _, rra := range d.RRA {
+		// Comment each row with its time like rrdtool.
+		res := int64(step/time.Second) * rra.PDPPerRow
+		if res <= 0 {
+			continue
+		}
+		end := d.LastUpdate - d.LastUpdate%res
+		for i, row := range rra.Database {
+			t := end - int64(len(rra.Database)-1-i)*res
+			row.Comment = fmt.Sprintf(" %v / %v ", time.Unix(t, 0).UTC().Format("2006-01-02 15:04:05 MST"), t)
+		}
+	}
+
+	b, err := xml.MarshalIndent(d, "", "\t")
+	if err != nil {
+		return 0, err
+	}
+
+	n, err := io.WriteString(w, dumpHeader)
+	if err != nil {
+		return int64(n), err
+	}
+
+	m, err := w.Write(append(b, '\n'))
+	return int64(n + m), err
+}
+
+// Dump returns f in rrdtool's XML dump format.
+// RRDs with COMPUTE data sources can't be dumped.
+func (f *File) Dump() (*Dump, error) {
+	l := f.layout
+	d := &Dump{
+		Version:    f.Version,
+		Step:       int64(f.Step / time.Second),
+		LastUpdate: f.LastUpdate.Unix(),
+	}
+
+	for _, ds := range f.DS {
+		if ds.Type == rrd.Compute {
+			return nil, fmt.Errorf("dumping %v data sources is not supported", ds.Type)
+		}
+
+		d.DS = append(d.DS, &DumpDS{
+			Name:             ds.Name,
+			Type:             ds.Type,
+			MinimalHeartbeat: int64(ds.Heartbeat / time.Second),
+			Min:              Float(ds.Min),
+			Max:              Float(ds.Max),
+			LastDS:           ds.LastDS,
+			Value:            Float(ds.Value),
+			UnknownSec:       int64(ds.UnknownSec),
+		})
+	}
+
+	for _, rra := range f.RRA {
+		r := &DumpRRA{CF: rra.CF, PDPPerRow: int64(rra.PDPPerRow)}
+		p := &r.Params
+		switch rra.CF {
+		case rrd.HoltWintersPredict, rrd.MultipliedHoltWinterPredict:
+			p.HWAlpha = NewFloat(l.val(rra.par[rraHWAlpha]))
+			p.HWBeta = NewFloat(l.val(rra.par[rraHWBeta]))
+			p.DependentRRAIdx = newCount(l.cnt(rra.par[rraDependent]))
+		case rrd.Seasonal, rrd.DevSeasonal:
+			p.SeasonalSmoothIdx = newCount(l.cnt(rra.par[rraSeasonalSmoothIdx]))
+			if f.Version >= "0004" {
+				p.SmoothingWindow = NewFloat(l.val(rra.par[rraSmoothingWindow]))
+			}
+			p.HWGamma = NewFloat(l.val(rra.par[rraSeasonalGamma]))
+			p.DependentRRAIdx = newCount(l.cnt(rra.par[rraDependent]))
+		case rrd.Failures:
+			p.DeltaPos = NewFloat(l.val(rra.par[rraDeltaPos]))
+			p.DeltaNeg = NewFloat(l.val(rra.par[rraDeltaNeg]))
+			p.WindowLen = newCount(l.cnt(rra.par[rraWindowLen]))
+			p.FailureThreshold = newCount(l.cnt(rra.par[rraFailureThreshold]))
+			p.DependentRRAIdx = newCount(l.cnt(rra.par[rraDependent]))
+		case rrd.DevPredict:
+			p.DependentRRAIdx = newCount(l.cnt(rra.par[rraDependent]))
+		default:
+			p.XFF = NewFloat(rra.XFF)
+		}
+
+		for _, cdp := range rra.CDPPrep {
+			r.CDPPrep = append(r.CDPPrep, f.dumpCDPPrep(rra, cdp))
+		}
+
+		for age := rra.Rows - 1; age >= 0; age-- {
+			row := &DumpRow{}
+			for _, v := range rra.Data[(rra.CurRow-age+rra.Rows)%rra.Rows] {
+				row.Values = append(row.Values, Float(v))
+			}
+			r.Database = append(r.Database, row)
+		}
+
+		d.RRA = append(d.RRA, r)
+	}
+
+	return d, nil
+}
+
+// dumpCDPPrep returns the dump of the consolidation state cdp of rra.
+func (f *File) dumpCDPPrep(rra *RRA, cdp *CDPPrep) *DumpCDPPrep {
+	l := f.layout
+	s := cdp.scratch
+	switch rra.CF {
+	case rrd.HoltWintersPredict, rrd.MultipliedHoltWinterPredict:
+		return &DumpCDPPrep{
+			Intercept:     NewFloat(l.val(s[cdpHWIntercept])),
+			LastIntercept: NewFloat(l.val(s[cdpHWLastIntercept])),
+			Slope:         NewFloat(l.val(s[cdpHWSlope])),
+			LastSlope:     NewFloat(l.val(s[cdpHWLastSlope])),
+			NaNCount:      newCount(l.cnt(s[cdpNullCount])),
+			LastNaNCount:  newCount(l.cnt(s[cdpLastNullCount])),
+		}
+	case rrd.Seasonal, rrd.DevSeasonal:
+		return &DumpCDPPrep{
+			Seasonal:     NewFloat(l.val(s[cdpSeasonal])),
+			LastSeasonal: NewFloat(l.val(s[cdpLastSeasonal])),
+			InitFlag:     newCount(l.cnt(s[cdpInitSeasonal])),
+		}
+	case rrd.DevPredict:
+		return &DumpCDPPrep{}
+	case rrd.Failures:
+		// The violation history is stored as a char array over the scratch area.
+		n := int(l.cnt(rra.par[rraWindowLen]))
+		if n > failuresWindowMax {
+			n = failuresWindowMax
+		}
+		h := make([]byte, n)
+		for i := range h {
+			h[i] = '0' + s[i/8][i%8]
+		}
+		history := string(h)
+		return &DumpCDPPrep{History: &history}
+	}
+
+	return &DumpCDPPrep{
+		PrimaryValue:      NewFloat(l.val(s[cdpPrimary])),
+		SecondaryValue:    NewFloat(l.val(s[cdpSecondary])),
+		Value:             NewFloat(cdp.Value),
+		UnknownDatapoints: newCount(uint64(cdp.UnknownDatapoints)),
+	}
+}
+
+// File returns a new File restored from d, using the layout of the current platform.
+func (d *Dump) File() (*File, error) {
+	f := &File{
+		Version:    d.Version,
+		Step:       time.Duration(d.Step) * time.Second,
+		LastUpdate: time.Unix(d.LastUpdate, 0),
+		layout:     native,
+	}
+	if !versions[f.Version] {
+		return nil, ErrUnsupportedVersion
+	}
+	l := f.layout
+
+	for _, ds := range d.DS {
+		switch ds.Type {
+		case rrd.Gauge, rrd.Counter, rrd.DCounter, rrd.Derive, rrd.DDerive, rrd.Absolute:
+		default:
+			return nil, fmt.Errorf("unsupported DS type %q", ds.Type)
+		}
+
+		f.DS = append(f.DS, &DS{
+			Name:       ds.Name,
+			Type:       ds.Type,
+			Heartbeat:  time.Duration(ds.MinimalHeartbeat) * time.Second,
+			Min:        float64(ds.Min),
+			Max:        float64(ds.Max),
+			LastDS:     ds.LastDS,
+			Value:      float64(ds.Value),
+			UnknownSec: int(ds.UnknownSec),
+		})
+	}
+
+	for i, r := range d.RRA {
+		if len(r.CDPPrep) != len(d.DS) {
+			return nil, fmt.Errorf("rra %v: %v cdp_prep entries for %v data sources", i, len(r.CDPPrep), len(d.DS))
+		}
+
+		rra := &RRA{
+			CF:        r.CF,
+			PDPPerRow: int(r.PDPPerRow),
+			Rows:      len(r.Database),
+			CurRow:    len(r.Database) - 1,
+		}
+
+		p := &r.Params
+		switch r.CF {
+		case rrd.HoltWintersPredict, rrd.MultipliedHoltWinterPredict:
+			l.setVal(&rra.par[rraHWAlpha], p.HWAlpha.value())
+			l.setVal(&rra.par[rraHWBeta], p.HWBeta.value())
+			l.setCnt(&rra.par[rraDependent], count(p.DependentRRAIdx))
+		case rrd.Seasonal, rrd.DevSeasonal:
+			l.setCnt(&rra.par[rraSeasonalSmoothIdx], count(p.SeasonalSmoothIdx))
+			if p.SmoothingWindow != nil {
+				l.setVal(&rra.par[rraSmoothingWindow], p.SmoothingWindow.value())
+			}
+			l.setVal(&rra.par[rraSeasonalGamma], p.HWGamma.value())
+			l.setCnt(&rra.par[rraDependent], count(p.DependentRRAIdx))
+		case rrd.Failures:
+			l.setVal(&rra.par[rraDeltaPos], p.DeltaPos.value())
+			l.setVal(&rra.par[rraDeltaNeg], p.DeltaNeg.value())
+			l.setCnt(&rra.par[rraWindowLen], count(p.WindowLen))
+			l.setCnt(&rra.par[rraFailureThreshold], count(p.FailureThreshold))
+			l.setCnt(&rra.par[rraDependent], count(p.DependentRRAIdx))
+		case rrd.DevPredict:
+			l.setCnt(&rra.par[rraDependent], count(p.DependentRRAIdx))
+		case rrd.Average, rrd.Min, rrd.Max, rrd.Last:
+			rra.XFF = p.XFF.value()
+		default:
+			return nil, fmt.Errorf("rra %v: unsupported consolidation function %q", i, r.CF)
+		}
+
+		for _, c := range r.CDPPrep {
+			cdp, err := restoreCDPPrep(l, r.CF, c)
+			if err != nil {
+				return nil, fmt.Errorf("rra %v: %v", i, err)
+			}
+			rra.CDPPrep = append(rra.CDPPrep, cdp)
+		}
+
+		for _, row := range r.Database {
+			vals := make([]float64, len(row.Values))
+			for j, v := range row.Values {
+				vals[j] = float64(v)
+			}
+			rra.Data = append(rra.Data, vals)
+		}
+
+		f.RRA = append(f.RRA, rra)
+	}
+
+	if err := f.validate(); err != nil {
+		return nil, err
+	}
+
+	e := &encoder{layout: f.layout}
+	f.header(e)
+	f.headerSize = len(e.buf)
+
+	return f, nil
+}
+
+// restoreCDPPrep returns the consolidation state c of an RRA with consolidation function cf.
+func restoreCDPPrep(l layout, cf string, c *DumpCDPPrep) (*CDPPrep, error) {
+	cdp := &CDPPrep{Value: math.NaN()}
+	s := &cdp.scratch
+	switch cf {
+	case rrd.HoltWintersPredict, rrd.MultipliedHoltWinterPredict:
+		l.setVal(&s[cdpHWIntercept], c.Intercept.value())
+		l.setVal(&s[cdpHWLastIntercept], c.LastIntercept.value())
+		l.setVal(&s[cdpHWSlope], c.Slope.value())
+		l.setVal(&s[cdpHWLastSlope], c.LastSlope.value())
+		l.setCnt(&s[cdpNullCount], count(c.NaNCount))
+		l.setCnt(&s[cdpLastNullCount], count(c.LastNaNCount))
+	case rrd.Seasonal, rrd.DevSeasonal:
+		l.setVal(&s[cdpSeasonal], c.Seasonal.value())
+		l.setVal(&s[cdpLastSeasonal], c.LastSeasonal.value())
+		l.setCnt(&s[cdpInitSeasonal], count(c.InitFlag))
+	case rrd.DevPredict:
+	case rrd.Failures:
+		var h string
+		if c.History != nil {
+			h = *c.History
+		}
+		if len(h) > failuresWindowMax {
+			return nil, fmt.Errorf("failures history too long: %v", len(h))
+		}
+		for i := 0; i < len(h); i++ {
+			if h[i] != '0' && h[i] != '1' {
+				return nil, fmt.Errorf("invalid failures history %q", h)
+			}
+			s[i/8][i%8] = h[i] - '0'
+		}
+	default:
+		cdp.Value = c.Value.value()
+		cdp.UnknownDatapoints = int(count(c.UnknownDatapoints))
+		l.setVal(&s[cdpPrimary], c.PrimaryValue.value())
+		l.setVal(&s[cdpSecondary], c.SecondaryValue.value())
+		return cdp, nil
+	}
+
+	// Holt-Winters RRAs don't use the standard consolidation state.
+	cdp.Value = l.val(s[cdpVal])
+	cdp.UnknownDatapoints = int(l.cnt(s[cdpUnknown]))
+	return cdp, nil
+}
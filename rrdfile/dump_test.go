@@ -0,0 +1,443 @@
+package rrdfile
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/multiplay/go-rrd"
+	"github.com/stretchr/testify/assert"
+)
+
+// testHWDump is an rrdtool dump of an RRD with Holt-Winters RRAs.
+const testHWDump = `<?xml version="1.0" encoding="utf-8"?>
+<!DOCTYPE rrd SYSTEM "https://oss.oetiker.ch/rrdtool/rrdtool.dtd">
+<!-- Round Robin Database Dump -->
+<rrd>
+	<version>0003</version>
+	<step>300</step> <!-- Seconds -->
+	<lastupdate>1500000000</lastupdate> <!-- 2017-07-14 02:40:00 UTC -->
+
+	<ds>
+		<name> a </name>
+		<type> GAUGE </type>
+		<minimal_heartbeat>600</minimal_heartbeat>
+		<min>0.0000000000e+00</min>
+		<max>NaN</max>
+
+		<!-- PDP Status -->
+		<last_ds>12</last_ds>
+		<value>6.0000000000e+00</value>
+		<unknown_sec> 0 </unknown_sec>
+	</ds>
+
+	<!-- Round Robin Archives -->
+	<rra>
+		<cf>AVERAGE</cf>
+		<pdp_per_row>1</pdp_per_row> <!-- 300 seconds -->
+		<params>
+		<xff>5.0000000000e-01</xff>
+		</params>
+		<cdp_prep>
+			<ds>
+			<primary_value>1.2000000000e+01</primary_value>
+			<secondary_value>1.1000000000e+01</secondary_value>
+			<value>NaN</value>
+			<unknown_datapoints>0</unknown_datapoints>
+			</ds>
+		</cdp_prep>
+		<database>
+			<!-- 2017-07-14 02:35:00 UTC / 1499999700 --> <row><v>1.1000000000e+01</v></row>
+			<!-- 2017-07-14 02:40:00 UTC / 1500000000 --> <row><v>1.2000000000e+01</v></row>
+		</database>
+	</rra>
+	<rra>
+		<cf>HWPREDICT</cf>
+		<pdp_per_row>1</pdp_per_row> <!-- 300 seconds -->
+		<params>
+		<hw_alpha>1.0000000000e-01</hw_alpha>
+		<hw_beta>3.5000000000e-03</hw_beta>
+		<dependent_rra_idx>2</dependent_rra_idx>
+		</params>
+		<cdp_prep>
+			<ds>
+			<intercept>1.1500000000e+01</intercept>
+			<last_intercept>1.1000000000e+01</last_intercept>
+			<slope>2.5000000000e-01</slope>
+			<last_slope>2.0000000000e-01</last_slope>
+			<nan_count>1</nan_count>
+			<last_nan_count>0</last_nan_count>
+			</ds>
+		</cdp_prep>
+		<database>
+			<!-- 2017-07-14 02:35:00 UTC / 1499999700 --> <row><v>NaN</v></row>
+			<!-- 2017-07-14 02:40:00 UTC / 1500000000 --> <row><v>1.1750000000e+01</v></row>
+		</database>
+	</rra>
+	<rra>
+		<cf>SEASONAL</cf>
+		<pdp_per_row>1</pdp_per_row> <!-- 300 seconds -->
+		<params>
+		<seasonal_smooth_idx>1</seasonal_smooth_idx>
+		<hw_gamma>1.0000000000e-01</hw_gamma>
+		<dependent_rra_idx>1</dependent_rra_idx>
+		</params>
+		<cdp_prep>
+			<ds>
+			<seasonal>5.0000000000e-01</seasonal>
+			<last_seasonal>2.5000000000e-01</last_seasonal>
+			<init_flag>1</init_flag>
+			</ds>
+		</cdp_prep>
+		<database>
+			<!-- 2017-07-14 02:35:00 UTC / 1499999700 --> <row><v>2.5000000000e-01</v></row>
+			<!-- 2017-07-14 02:40:00 UTC / 1500000000 --> <row><v>5.0000000000e-01</v></row>
+		</database>
+	</rra>
+	<rra>
+		<cf>FAILURES</cf>
+		<pdp_per_row>1</pdp_per_row> <!-- 300 seconds -->
+		<params>
+		<delta_pos>2.0000000000e+00</delta_pos>
+		<delta_neg>2.0000000000e+00</delta_neg>
+		<window_len>9</window_len>
+		<failure_threshold>7</failure_threshold>
+		<dependent_rra_idx>2</dependent_rra_idx>
+		</params>
+		<cdp_prep>
+			<ds>
+			<history>010000001</history>
+			</ds>
+		</cdp_prep>
+		<database>
+			<!-- 2017-07-14 02:35:00 UTC / 1499999700 --> <row><v>0.0000000000e+00</v></row>
+			<!-- 2017-07-14 02:40:00 UTC / 1500000000 --> <row><v>1.0000000000e+00</v></row>
+		</database>
+	</rra>
+</rrd>
+`
+
+// newTestDumpFile returns a File with a GAUGE and COUNTER data source which
+// has been updated with a few values.
+func newTestDumpFile(t *testing.T) *File {
+	f, err := Create(
+		[]rrd.DS{rrd.NewDS("DS:g:GAUGE:600:0:U"), rrd.NewDS("DS:c:COUNTER:600:U:U")},
+		[]rrd.RRA{rrd.NewAverage(0.5, 1, 10), rrd.NewMax(0.5, 3, 5)},
+		rrd.Start(testEnd),
+	)
+	if !assert.NoError(t, err) {
+		return nil
+	}
+
+	err = f.Update(at(300, 10, 100), at(600, 20, 400), at(900, 30, 1000), at(1000, 40, 1100))
+	if !assert.NoError(t, err) {
+		return nil
+	}
+
+	return f
+}
+
+func TestDump(t *testing.T) {
+	f := newTestDumpFile(t)
+	if f == nil {
+		return
+	}
+
+	d, err := f.Dump()
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	assert.Equal(t, int64(300), d.Step)
+	assert.Equal(t, testEnd.Unix()+1000, d.LastUpdate)
+	if assert.Len(t, d.DS, 2) {
+		assert.Equal(t, "g", d.DS[0].Name)
+		assert.Equal(t, rrd.Counter, d.DS[1].Type)
+		assert.Equal(t, "1100", d.DS[1].LastDS)
+	}
+	if assert.Len(t, d.RRA, 2) {
+		r := d.RRA[0]
+		assert.Equal(t, rrd.Average, r.CF)
+		assert.Equal(t, Float(0.5), *r.Params.XFF)
+		assert.Nil(t, r.Params.HWAlpha)
+		if assert.Len(t, r.Database, 10) {
+			// Newest row last.
+			assert.Equal(t, []Float{30, 2}, r.Database[9].Values)
+			assert.Equal(t, []Float{20, 1}, r.Database[8].Values)
+		}
+	}
+
+	var buf bytes.Buffer
+	n, err := d.WriteTo(&buf)
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.Equal(t, int64(buf.Len()), n)
+
+	xml := buf.String()
+	assert.True(t, strings.HasPrefix(xml, "<?xml"))
+	assert.Contains(t, xml, "<cf>AVERAGE</cf>")
+	assert.Contains(t, xml, "<xff>5.0000000000e-01</xff>")
+	assert.Contains(t, xml, "<v>3.0000000000e+01</v>")
+	assert.Contains(t, xml, "<!-- 2017-07-14 02:55:00 UTC / 1500000900 -->")
+
+	r, err := Restore(&buf)
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	// The restored file matches the original other than the current row
+	// and the sign of NaNs.
+	for _, rra := range f.RRA {
+		data := make([][]float64, rra.Rows)
+		for i := range data {
+			data[i] = rra.Data[(rra.CurRow+1+i)%rra.Rows]
+			for j, v := range data[i] {
+				if math.IsNaN(v) {
+					data[i][j] = math.NaN()
+				}
+			}
+		}
+		rra.Data = data
+		rra.CurRow = rra.Rows - 1
+	}
+
+	expected, err := f.encode()
+	if !assert.NoError(t, err) {
+		return
+	}
+	actual, err := r.encode()
+	if assert.NoError(t, err) {
+		assert.Equal(t, expected, actual)
+	}
+	assert.Equal(t, f.headerSize, r.headerSize)
+}
+
+func TestRestoreHoltWinters(t *testing.T) {
+	d, err := ReadDump(strings.NewReader(testHWDump))
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	assert.Equal(t, "a", d.DS[0].Name)
+	assert.Equal(t, rrd.Gauge, d.DS[0].Type)
+
+	f, err := d.File()
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	l := f.layout
+	if assert.Len(t, f.RRA, 4) {
+		hw := f.RRA[1]
+		assert.Equal(t, 0.1, l.val(hw.par[rraHWAlpha]))
+		assert.Equal(t, uint64(2), l.cnt(hw.par[rraDependent]))
+		assert.Equal(t, 11.5, l.val(hw.CDPPrep[0].scratch[cdpHWIntercept]))
+		assert.Equal(t, uint64(1), l.cnt(hw.CDPPrep[0].scratch[cdpNullCount]))
+		assert.Equal(t, 1, hw.CurRow)
+		assert.Equal(t, 11.75, hw.Data[1][0])
+
+		s := f.RRA[2]
+		assert.Equal(t, uint64(1), l.cnt(s.par[rraSeasonalSmoothIdx]))
+		assert.Equal(t, 0.25, l.val(s.CDPPrep[0].scratch[cdpLastSeasonal]))
+
+		assert.Equal(t, uint64(7), l.cnt(f.RRA[3].par[rraFailureThreshold]))
+	}
+
+	// Dumping the restored file reproduces the original.
+	r, err := f.Dump()
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	var expected, actual bytes.Buffer
+	if _, err = d.WriteTo(&expected); !assert.NoError(t, err) {
+		return
+	}
+	if _, err = r.WriteTo(&actual); assert.NoError(t, err) {
+		assert.Equal(t, expected.String(), actual.String())
+	}
+
+	// The restored file can be encoded and read back.
+	b, err := f.encode()
+	if !assert.NoError(t, err) {
+		return
+	}
+	f, err = Read(bytes.NewReader(b))
+	if !assert.NoError(t, err) {
+		return
+	}
+	if r, err = f.Dump(); assert.NoError(t, err) {
+		assert.Equal(t, "010000001", *r.RRA[3].CDPPrep[0].History)
+	}
+}
+
+func TestRestoreErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		old  string
+		new  string
+	}{
+		{"version", "<version>0003", "<version>0002"},
+		{"ds type", "<type> GAUGE", "<type> COMPUTE"},
+		{"cf", "<cf>SEASONAL", "<cf>OTHER"},
+		{"history", "010000001", "010000002"},
+		{"xml", "</rrd>", ""},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := Restore(strings.NewReader(strings.Replace(testHWDump, tc.old, tc.new, 1)))
+			assert.Error(t, err)
+		})
+	}
+}
+
+// testFetcher implements InfoFetcher using a File.
+type testFetcher struct {
+	*File
+}
+
+func (f testFetcher) InfoContext(ctx context.Context, filename string) ([]*rrd.Info, error) {
+	return f.Info(), nil
+}
+
+func (f testFetcher) FetchContext(ctx context.Context, filename, cf string, options ...interface{}) (*rrd.Fetch, error) {
+	o := options[0].(rrd.FetchOptions)
+	start, err := strconv.ParseInt(string(o.Start), 10, 64)
+	if err != nil {
+		return nil, err
+	}
+	end, err := strconv.ParseInt(string(o.End), 10, 64)
+	if err != nil {
+		return nil, err
+	}
+	return f.Fetch(cf, time.Unix(start, 0), time.Unix(end, 0))
+}
+
+func TestRemoteDump(t *testing.T) {
+	f := newTestDumpFile(t)
+	if f == nil {
+		return
+	}
+
+	expected, err := f.Dump()
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	d, err := RemoteDump(context.Background(), testFetcher{f}, "test.rrd")
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	assert.Equal(t, expected.Version, d.Version)
+	assert.Equal(t, expected.Step, d.Step)
+	assert.Equal(t, expected.LastUpdate, d.LastUpdate)
+	if assert.Len(t, d.DS, len(expected.DS)) {
+		for i, ds := range d.DS {
+			e := expected.DS[i]
+			assert.Equal(t, e.Name, ds.Name)
+			assert.Equal(t, e.Type, ds.Type)
+			assert.Equal(t, e.LastDS, ds.LastDS)
+			assert.Equal(t, e.UnknownSec, ds.UnknownSec)
+		}
+	}
+	if !assert.Len(t, d.RRA, len(expected.RRA)) {
+		return
+	}
+
+	for i, r := range d.RRA {
+		e := expected.RRA[i]
+		assert.Equal(t, e.CF, r.CF)
+		assert.Equal(t, e.PDPPerRow, r.PDPPerRow)
+		assert.Equal(t, e.Params, r.Params)
+		if assert.Len(t, r.CDPPrep, len(e.CDPPrep)) {
+			for j, cdp := range r.CDPPrep {
+				assert.Equal(t, *e.CDPPrep[j].UnknownDatapoints, *cdp.UnknownDatapoints)
+			}
+		}
+		if assert.Len(t, r.Database, len(e.Database)) {
+			for j, row := range r.Database {
+				for k, v := range row.Values {
+					ev := e.Database[j].Values[k]
+					if math.IsNaN(float64(ev)) {
+						assert.True(t, math.IsNaN(float64(v)), "rra %v row %v ds %v", i, j, k)
+					} else {
+						assert.Equal(t, ev, v, "rra %v row %v ds %v", i, j, k)
+					}
+				}
+			}
+		}
+	}
+
+	if _, err = d.File(); assert.NoError(t, err) {
+		_, err = RemoteDump(context.Background(), testFetcher{&File{}}, "test.rrd")
+		assert.Error(t, err)
+	}
+}
+
+// infoFetcher returns info and fails fetches.
+type infoFetcher []*rrd.Info
+
+func (f infoFetcher) InfoContext(ctx context.Context, filename string) ([]*rrd.Info, error) {
+	return f, nil
+}
+
+func (f infoFetcher) FetchContext(ctx context.Context, filename, cf string, options ...interface{}) (*rrd.Fetch, error) {
+	return nil, fmt.Errorf("unexpected fetch of %v", cf)
+}
+
+func TestRemoteDumpHoltWinters(t *testing.T) {
+	d, err := RemoteDump(context.Background(), infoFetcher{
+		{Key: "rrd_version", Value: "0004"},
+		{Key: "step", Value: int64(300)},
+		{Key: "last_update", Value: testEnd.Unix()},
+		{Key: "ds[g].index", Value: int64(0)},
+		{Key: "ds[g].type", Value: rrd.Gauge},
+		{Key: "rra[0].cf", Value: rrd.HoltWintersPredict},
+		{Key: "rra[0].rows", Value: int64(10)},
+		{Key: "rra[0].pdp_per_row", Value: int64(1)},
+		{Key: "rra[0].alpha", Value: 0.1},
+		{Key: "rra[0].beta", Value: 0.0035},
+		{Key: "rra[0].cdp_prep[0].intercept", Value: 4.0},
+		{Key: "rra[0].cdp_prep[0].slope", Value: -0.5},
+		{Key: "rra[0].cdp_prep[0].NaN_count", Value: int64(1)},
+		{Key: "rra[1].cf", Value: rrd.Seasonal},
+		{Key: "rra[1].rows", Value: int64(5)},
+		{Key: "rra[1].pdp_per_row", Value: int64(1)},
+		{Key: "rra[1].gamma", Value: 0.1},
+		{Key: "rra[1].smoothing_window", Value: 0.05},
+		{Key: "rra[1].cdp_prep[0].seasonal", Value: 2.0},
+	}, "test.rrd")
+	if !assert.NoError(t, err) || !assert.Len(t, d.RRA, 2) {
+		return
+	}
+
+	hw, seasonal := d.RRA[0], d.RRA[1]
+	assert.Nil(t, hw.Params.XFF)
+	assert.Equal(t, NewFloat(0.1), hw.Params.HWAlpha)
+	assert.Equal(t, NewFloat(0.0035), hw.Params.HWBeta)
+	assert.Equal(t, int64(1), *hw.Params.DependentRRAIdx)
+	if assert.Len(t, hw.CDPPrep, 1) {
+		cdp := hw.CDPPrep[0]
+		assert.Equal(t, NewFloat(4), cdp.Intercept)
+		assert.Equal(t, NewFloat(-0.5), cdp.Slope)
+		assert.Equal(t, int64(1), *cdp.NaNCount)
+		assert.Nil(t, cdp.Value)
+	}
+
+	assert.Equal(t, NewFloat(0.1), seasonal.Params.HWGamma)
+	assert.Equal(t, NewFloat(0.05), seasonal.Params.SmoothingWindow)
+	assert.Equal(t, int64(0), *seasonal.Params.DependentRRAIdx)
+	if assert.Len(t, seasonal.CDPPrep, 1) {
+		assert.Equal(t, NewFloat(2), seasonal.CDPPrep[0].Seasonal)
+		assert.Equal(t, int64(1), *seasonal.CDPPrep[0].InitFlag)
+	}
+	assert.Len(t, seasonal.Database, 5)
+}
@@ -0,0 +1,25 @@
+package rrdfile
+
+import (
+	"errors"
+)
+
+var (
+	// ErrNotRRD is returned when reading data which isn't an RRD file.
+	ErrNotRRD = errors.New("not an RRD file")
+
+	// ErrUnsupportedVersion is returned when reading an RRD file with an unsupported version.
+	ErrUnsupportedVersion = errors.New("unsupported RRD version")
+
+	// ErrUnknownLayout is returned when the architecture an RRD file was created on can't be determined.
+	ErrUnknownLayout = errors.New("unknown RRD layout")
+
+	// ErrNoMatchingRRA is returned by Fetch if the RRD does not contain an RRA matching the chosen CF.
+	ErrNoMatchingRRA = errors.New("no RRA matching the chosen CF")
+
+	// ErrInvalidRange is returned by Fetch if start is not before end.
+	ErrInvalidRange = errors.New("start must be before end")
+
+	// ErrInvalidRRA is returned by First if the requested RRA doesn't exist.
+	ErrInvalidRRA = errors.New("invalid RRA index")
+)
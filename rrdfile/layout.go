@@ -0,0 +1,341 @@
+package rrdfile
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"math"
+	"runtime"
+	"strconv"
+	"unsafe"
+)
+
+const (
+	cookie      = "RRD\x00"
+	floatCookie = 8.642135e130
+
+	dsNameSize = 20
+	dstSize    = 20
+	cfNameSize = 20
+	lastDSSize = 30
+	parCount   = 10
+)
+
+// Indices of the parameters in rra_def_t, which depend on the consolidation function.
+const (
+	rraXFF               = 0
+	rraHWAlpha           = 1
+	rraHWBeta            = 2
+	rraDependent         = 3
+	rraSeasonalGamma     = 1
+	rraSmoothingWindow   = 2
+	rraSeasonalSmoothIdx = 4
+	rraDeltaPos          = 1
+	rraDeltaNeg          = 2
+	rraWindowLen         = 4
+	rraFailureThreshold  = 5
+)
+
+// Indices of the values in cdp_prep_t, which depend on the consolidation function.
+const (
+	cdpVal             = 0
+	cdpUnknown         = 1
+	cdpHWIntercept     = 2
+	cdpHWLastIntercept = 3
+	cdpHWSlope         = 4
+	cdpHWLastSlope     = 5
+	cdpNullCount       = 6
+	cdpLastNullCount   = 7
+	cdpSeasonal        = 2
+	cdpLastSeasonal    = 3
+	cdpInitSeasonal    = 6
+
+	// cdpPrimary and cdpSecondary are the values written to
+	// the first and any subsequent rows of an RRA by an update.
+	cdpPrimary   = 8
+	cdpSecondary = 9
+)
+
+var (
+	// versions are the supported RRD file format versions.
+	versions = map[string]bool{
+		"0001": true,
+		"0003": true,
+		"0004": true,
+		"0005": true,
+	}
+)
+
+// unival is the raw value of a C unival union, which is interpreted as either
+// an unsigned long or a double depending on its use.
+type unival [8]byte
+
+// layout describes the architecture specific encoding of an RRD file.
+type layout struct {
+	order binary.ByteOrder
+
+	// word is the size of an unsigned long and time_t.
+	word int
+
+	// align is the alignment of a double.
+	align int
+}
+
+// native is the layout used by rrdtool on the current platform.
+var native = func() layout {
+	l := layout{order: binary.BigEndian, word: strconv.IntSize / 8, align: 8}
+	if v := uint16(1); *(*byte)(unsafe.Pointer(&v)) == 1 {
+		l.order = binary.LittleEndian
+	}
+
+	switch runtime.GOOS {
+	case "windows":
+		// unsigned long is 32-bit on 64-bit Windows.
+		l.word = 4
+	}
+
+	switch runtime.GOARCH {
+	case "386":
+		// The i386 System V ABI aligns doubles in structs to 4 bytes.
+		l.align = 4
+	}
+
+	return l
+}()
+
+// maxAlign returns the alignment of structs containing univals.
+func (l layout) maxAlign() int {
+	if l.word > l.align {
+		return l.word
+	}
+	return l.align
+}
+
+// cnt returns u interpreted as an unsigned long.
+func (l layout) cnt(u unival) uint64 {
+	if l.word == 4 {
+		return uint64(l.order.Uint32(u[:]))
+	}
+	return l.order.Uint64(u[:])
+}
+
+// val returns u interpreted as a double.
+func (l layout) val(u unival) float64 {
+	return math.Float64frombits(l.order.Uint64(u[:]))
+}
+
+// setCnt sets u to the unsigned long v.
+func (l layout) setCnt(u *unival, v uint64) {
+	*u = unival{}
+	if l.word == 4 {
+		l.order.PutUint32(u[:], uint32(v))
+		return
+	}
+	l.order.PutUint64(u[:], v)
+}
+
+// setVal sets u to the double v.
+func (l layout) setVal(u *unival, v float64) {
+	l.order.PutUint64(u[:], math.Float64bits(v))
+}
+
+// detect determines the layout of the RRD file data in b from its header.
+func detect(b []byte) (layout, string, error) {
+	if len(b) < 48 {
+		if len(b) >= len(cookie) && string(b[:len(cookie)]) != cookie {
+			return layout{}, "", ErrNotRRD
+		}
+		return layout{}, "", io.ErrUnexpectedEOF
+	}
+
+	if string(b[:len(cookie)]) != cookie {
+		return layout{}, "", ErrNotRRD
+	}
+
+	version := string(b[4:8])
+	if !versions[version] || b[8] != 0 {
+		return layout{}, "", ErrUnsupportedVersion
+	}
+
+	for _, align := range []int{8, 4} {
+		off := (9 + align - 1) / align * align
+		for _, order := range []binary.ByteOrder{binary.LittleEndian, binary.BigEndian} {
+			if math.Float64frombits(order.Uint64(b[off:])) != floatCookie {
+				continue
+			}
+
+			l := layout{order: order, word: 4, align: align}
+			if align == 8 {
+				// A 32-bit ds_cnt followed by a non-zero rra_cnt reads as a
+				// value which doesn't fit in 32-bits on 64-bit platforms.
+				if v := order.Uint64(b[24:]); v > 0 && v <= math.MaxUint32 {
+					l.word = 8
+				}
+			}
+			return l, version, nil
+		}
+	}
+
+	return layout{}, "", ErrUnknownLayout
+}
+
+// decoder decodes C structs from RRD file data.
+type decoder struct {
+	layout
+	buf  []byte
+	off  int
+	base int
+	err  error
+}
+
+// begin marks the start of a struct.
+func (d *decoder) begin() {
+	d.base = d.off
+}
+
+// end pads the current struct to the given alignment.
+func (d *decoder) end(align int) {
+	d.pad(align)
+}
+
+// pad advances to the next offset with the given alignment relative to the start of the current struct.
+func (d *decoder) pad(align int) {
+	d.off = d.base + (d.off-d.base+align-1)/align*align
+}
+
+// next returns the next n bytes at the given alignment.
+func (d *decoder) next(n, align int) []byte {
+	d.pad(align)
+	if d.err != nil || d.off+n > len(d.buf) {
+		if d.err == nil {
+			d.err = io.ErrUnexpectedEOF
+		}
+		return make([]byte, n)
+	}
+
+	b := d.buf[d.off : d.off+n]
+	d.off += n
+	return b
+}
+
+// str returns the next NUL terminated string from a char array of size n.
+func (d *decoder) str(n int) string {
+	b := d.next(n, 1)
+	if i := bytes.IndexByte(b, 0); i != -1 {
+		b = b[:i]
+	}
+	return string(b)
+}
+
+// uword returns the next unsigned long.
+func (d *decoder) uword() uint64 {
+	b := d.next(d.word, d.word)
+	if d.word == 4 {
+		return uint64(d.order.Uint32(b))
+	}
+	return d.order.Uint64(b)
+}
+
+// sword returns the next long or time_t.
+func (d *decoder) sword() int64 {
+	b := d.next(d.word, d.word)
+	if d.word == 4 {
+		return int64(int32(d.order.Uint32(b)))
+	}
+	return int64(d.order.Uint64(b))
+}
+
+// double returns the next double.
+func (d *decoder) double() float64 {
+	return math.Float64frombits(d.order.Uint64(d.next(8, d.align)))
+}
+
+// univals returns the next array of parCount univals.
+func (d *decoder) univals() (v [parCount]unival) {
+	for i := range v {
+		copy(v[i][:], d.next(len(v[i]), d.maxAlign()))
+	}
+	return v
+}
+
+// count returns the next unsigned long, validating that at least n
+// bytes per item remain so corrupt counts can't cause huge allocations.
+func (d *decoder) count(n int) int {
+	if n < 1 {
+		n = 1
+	}
+	v := d.uword()
+	if d.err == nil && v > uint64(len(d.buf)-d.off)/uint64(n) {
+		d.err = io.ErrUnexpectedEOF
+	}
+	if d.err != nil {
+		return 0
+	}
+	return int(v)
+}
+
+// encoder encodes C structs as RRD file data.
+type encoder struct {
+	layout
+	buf  []byte
+	base int
+}
+
+// begin marks the start of a struct.
+func (e *encoder) begin() {
+	e.base = len(e.buf)
+}
+
+// end pads the current struct to the given alignment.
+func (e *encoder) end(align int) {
+	e.pad(align)
+}
+
+// pad writes zeros up to the next offset with the given alignment relative to the start of the current struct.
+func (e *encoder) pad(align int) {
+	for (len(e.buf)-e.base)%align != 0 {
+		e.buf = append(e.buf, 0)
+	}
+}
+
+// next returns the next n bytes at the given alignment for writing.
+func (e *encoder) next(n, align int) []byte {
+	e.pad(align)
+	e.buf = append(e.buf, make([]byte, n)...)
+	return e.buf[len(e.buf)-n:]
+}
+
+// str writes s as a NUL terminated char array of size n, truncating it if needed.
+func (e *encoder) str(s string, n int) {
+	if len(s) > n-1 {
+		s = s[:n-1]
+	}
+	copy(e.next(n, 1), s)
+}
+
+// uword writes the unsigned long v.
+func (e *encoder) uword(v uint64) {
+	b := e.next(e.word, e.word)
+	if e.word == 4 {
+		e.order.PutUint32(b, uint32(v))
+		return
+	}
+	e.order.PutUint64(b, v)
+}
+
+// sword writes the long or time_t v.
+func (e *encoder) sword(v int64) {
+	e.uword(uint64(v))
+}
+
+// double writes the double v.
+func (e *encoder) double(v float64) {
+	e.order.PutUint64(e.next(8, e.align), math.Float64bits(v))
+}
+
+// univals writes the array of univals v.
+func (e *encoder) univals(v [parCount]unival) {
+	for i := range v {
+		copy(e.next(len(v[i]), e.maxAlign()), v[i][:])
+	}
+}
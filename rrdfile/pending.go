@@ -0,0 +1,113 @@
+package rrdfile
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/multiplay/go-rrd"
+)
+
+// PendingLister is the interface implemented by rrd.Client and rrd.Pool which
+// provides the command needed to read the updates cached by rrdcached.
+type PendingLister interface {
+	PendingContext(ctx context.Context, filename string) ([]*rrd.PendingUpdate, error)
+}
+
+// FetchWithPending returns the data of the RRD file filename consolidated with
+// cf between start and end, as File.Fetch, including the updates rrdcached has
+// cached for it but not yet written, which are read using c for the file name.
+//
+// rrdcached flushes a file before answering a fetch, so this is only needed
+// when reading files directly while rrdcached caches their updates, avoiding
+// the expense of a flush. The pending updates are applied to the data read
+// from filename, but not written, with the same semantics as Update, and rows
+// whose values they changed have Estimated set. Pending updates which were
+// written before filename was read are skipped.
+func FetchWithPending(ctx context.Context, c PendingLister, name, filename, cf string, start, end time.Time) (*rrd.Fetch, error) {
+	// Read the pending updates first, so any written in the mean time are
+	// in the file rather than lost.
+	pending, err := c.PendingContext(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+
+	f, err := Open(filename)
+	if err != nil {
+		return nil, err
+	}
+
+	base, err := f.Fetch(cf, start, end)
+	if err != nil {
+		return nil, err
+	}
+
+	var updates []rrd.Update
+	for _, p := range pending {
+		if p.Time.After(f.LastUpdate) {
+			updates = append(updates, pendingUpdate(p))
+		}
+	}
+	if len(updates) == 0 {
+		return base, nil
+	}
+
+	if err = f.Update(updates...); err != nil {
+		return nil, fmt.Errorf("%v: pending: %v", filename, err)
+	}
+
+	r, err := f.Fetch(cf, start, end)
+	if err != nil {
+		return nil, err
+	}
+
+	rows := make(map[int64][]*float64, len(base.Rows))
+	for _, row := range base.Rows {
+		rows[row.Time.Unix()] = row.Data
+	}
+
+	for i, row := range r.Rows {
+		old, ok := rows[row.Time.Unix()]
+		r.Rows[i].Estimated = !ok || !valuesEqual(old, row.Data)
+	}
+
+	return r, nil
+}
+
+// pendingUpdate returns the update for p. Values are formatted from their
+// float64 representation, so counters beyond 2^53 lose precision.
+func pendingUpdate(p *rrd.PendingUpdate) rrd.Update {
+	parts := make([]string, len(p.Data)+1)
+	parts[0] = fmt.Sprintf("%v.%06d", p.Time.Unix(), p.Time.Nanosecond()/int(time.Microsecond))
+	for i, v := range p.Data {
+		if v == nil {
+			parts[i+1] = "U"
+		} else {
+			parts[i+1] = strconv.FormatFloat(*v, 'g', -1, 64)
+		}
+	}
+	return rrd.Update(strings.Join(parts, ":"))
+}
+
+// valuesEqual returns true if a and b contain the same values, false otherwise.
+func valuesEqual(a, b []*float64) bool {
+	if len(a) != len(b) {
+		return false
+	}
+
+	for i := range a {
+		switch {
+		case a[i] == nil || b[i] == nil:
+			if a[i] != b[i] {
+				return false
+			}
+		case *a[i] != *b[i] && !(math.IsNaN(*a[i]) && math.IsNaN(*b[i])):
+			return false
+		}
+	}
+
+	return true
+}
@@ -0,0 +1,84 @@
+package rrdfile
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/multiplay/go-rrd"
+	"github.com/stretchr/testify/assert"
+)
+
+// testPending is a PendingLister returning fixed updates.
+type testPending struct {
+	updates []*rrd.PendingUpdate
+	err     error
+}
+
+func (p *testPending) PendingContext(ctx context.Context, filename string) ([]*rrd.PendingUpdate, error) {
+	return p.updates, p.err
+}
+
+// pendingAt returns a pending update at offset seconds from testEnd.
+func pendingAt(offset int, v float64) *rrd.PendingUpdate {
+	return &rrd.PendingUpdate{Time: testEnd.Add(time.Second * time.Duration(offset)), Data: []*float64{&v}}
+}
+
+func TestFetchWithPending(t *testing.T) {
+	dir, err := ioutil.TempDir("", "rrdfile")
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer os.RemoveAll(dir) // nolint: errcheck
+
+	filename := filepath.Join(dir, "test.rrd")
+	err = CreateFile(filename, []rrd.DS{rrd.NewDS("DS:g:GAUGE:600:U:U")}, []rrd.RRA{rrd.NewAverage(0.5, 1, 10)}, rrd.Start(testEnd))
+	if !assert.NoError(t, err) {
+		return
+	}
+	if !assert.NoError(t, UpdateFile(filename, at(300, 10), at(600, 20))) {
+		return
+	}
+
+	// The first pending update has already been written.
+	c := &testPending{updates: []*rrd.PendingUpdate{pendingAt(600, 20), pendingAt(900, 30), pendingAt(1200, 40)}}
+	end := testEnd.Add(time.Second * 1200)
+	r, err := FetchWithPending(context.Background(), c, "test.rrd", filename, rrd.Average, testEnd, end)
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	vals := make([]float64, len(r.Rows))
+	estimated := make([]bool, len(r.Rows))
+	for i, row := range r.Rows {
+		if assert.NotNil(t, row.Data[0]) {
+			vals[i] = *row.Data[0]
+		}
+		estimated[i] = row.Estimated
+	}
+	assert.Equal(t, []float64{10, 20, 30, 40}, vals)
+	assert.Equal(t, []bool{false, false, true, true}, estimated)
+
+	// The file is unchanged.
+	f, err := Open(filename)
+	if assert.NoError(t, err) {
+		assert.Equal(t, testEnd.Add(time.Second*600), f.LastUpdate)
+	}
+
+	// Without pending updates the result is that of Fetch.
+	r, err = FetchWithPending(context.Background(), &testPending{}, "test.rrd", filename, rrd.Average, testEnd, end)
+	if assert.NoError(t, err) {
+		expected, err := f.Fetch(rrd.Average, testEnd, end)
+		if assert.NoError(t, err) {
+			assert.Equal(t, expected, r)
+		}
+	}
+
+	errPending := errors.New("pending failed")
+	_, err = FetchWithPending(context.Background(), &testPending{err: errPending}, "test.rrd", filename, rrd.Average, testEnd, end)
+	assert.Equal(t, errPending, err)
+}
@@ -0,0 +1,223 @@
+package rrdfile
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"time"
+
+	"github.com/multiplay/go-rrd"
+)
+
+// InfoFetcher is the interface implemented by rrd.Client and rrd.Pool which
+// provides the commands needed to dump an RRD over rrdcached.
+type InfoFetcher interface {
+	InfoContext(ctx context.Context, filename string) ([]*rrd.Info, error)
+	FetchContext(ctx context.Context, filename, cf string, options ...interface{}) (*rrd.Fetch, error)
+}
+
+// RemoteDump returns the RRD filename in rrdtool's XML dump format, using the
+// info and fetch commands of c.
+//
+// rrdtool info doesn't expose every value stored in an RRD, so values it omits
+// such as the primary and secondary values of the consolidation state are
+// unknown, Holt-Winters RRA dependencies are inferred from their consolidation
+// functions and FAILURES history is empty.
+func RemoteDump(ctx context.Context, c InfoFetcher, filename string) (*Dump, error) {
+	kvs, err := c.InfoContext(ctx, filename)
+	if err != nil {
+		return nil, err
+	}
+
+	info, err := rrd.NewRRDInfo(kvs)
+	if err != nil {
+		return nil, err
+	}
+
+	d := &Dump{Version: info.Version, Step: int64(info.Step / time.Second)}
+	if !info.LastUpdate.IsZero() {
+		d.LastUpdate = info.LastUpdate.Unix()
+	}
+	for _, ds := range info.DS {
+		d.DS = append(d.DS, &DumpDS{
+			Name:             ds.Name,
+			Type:             ds.Type,
+			MinimalHeartbeat: int64(ds.Heartbeat / time.Second),
+			Min:              Float(ds.Min),
+			Max:              Float(ds.Max),
+			LastDS:           ds.LastDS,
+			Value:            Float(ds.Value),
+			UnknownSec:       int64(ds.UnknownSec),
+		})
+	}
+
+	if d.Step <= 0 {
+		return nil, fmt.Errorf("invalid step %v", d.Step)
+	}
+
+	for i, rra := range info.RRA {
+		if rra.PDPPerRow <= 0 || rra.Rows <= 0 {
+			return nil, fmt.Errorf("rra %v: invalid %v RRA with %v rows and %v pdp per row", i, rra.CF, rra.Rows, rra.PDPPerRow)
+		}
+		d.RRA = append(d.RRA, dumpRRA(rra))
+	}
+
+	for i, r := range d.RRA {
+
+		for j := range r.Database {
+			vals := make([]Float, len(d.DS))
+			for k := range vals {
+				vals[k] = Float(math.NaN())
+			}
+			r.Database[j] = &DumpRow{Values: vals}
+		}
+
+		r.Params.DependentRRAIdx = dependentRRA(d.RRA, r.CF)
+		if !standardCF(r.CF) {
+			// Holt-Winters RRAs can't be fetched.
+			continue
+		}
+
+		if err := fetchRRA(ctx, c, filename, d, r); err != nil {
+			return nil, fmt.Errorf("rra %v: %v", i, err)
+		}
+	}
+
+	return d, nil
+}
+
+// dumpRRA returns the dump of rra without its database rows.
+func dumpRRA(rra *rrd.RRAInfo) *DumpRRA {
+	r := &DumpRRA{
+		CF:        rra.CF,
+		PDPPerRow: int64(rra.PDPPerRow),
+		// The rows themselves are filled in by RemoteDump.
+		Database: make([]*DumpRow, rra.Rows),
+	}
+
+	p := &r.Params
+	for _, v := range []struct {
+		dst **Float
+		src float64
+	}{
+		{&p.XFF, rra.XFF},
+		{&p.HWAlpha, rra.Alpha},
+		{&p.HWBeta, rra.Beta},
+		{&p.HWGamma, rra.Gamma},
+		{&p.SmoothingWindow, rra.SmoothingWindow},
+		{&p.DeltaPos, rra.DeltaPos},
+		{&p.DeltaNeg, rra.DeltaNeg},
+	} {
+		if !math.IsNaN(v.src) {
+			*v.dst = NewFloat(v.src)
+		}
+	}
+
+	switch rra.CF {
+	case rrd.Seasonal, rrd.DevSeasonal:
+		zero := int64(0)
+		p.SeasonalSmoothIdx = &zero
+	case rrd.Failures:
+		threshold, window := int64(rra.FailureThreshold), int64(rra.WindowLength)
+		p.FailureThreshold = &threshold
+		p.WindowLen = &window
+	}
+
+	for _, c := range rra.CDPPrep {
+		cdp := &DumpCDPPrep{}
+		switch rra.CF {
+		case rrd.HoltWintersPredict, rrd.MultipliedHoltWinterPredict:
+			n := int64(c.NaNCount)
+			cdp.Intercept = NewFloat(c.Intercept)
+			cdp.LastIntercept = cdp.Intercept
+			cdp.Slope = NewFloat(c.Slope)
+			cdp.LastSlope = cdp.Slope
+			cdp.NaNCount = &n
+			cdp.LastNaNCount = &n
+		case rrd.Seasonal, rrd.DevSeasonal:
+			v := c.Seasonal
+			if rra.CF == rrd.DevSeasonal {
+				v = c.Deviation
+			}
+			one := int64(1)
+			cdp.Seasonal = NewFloat(v)
+			cdp.LastSeasonal = cdp.Seasonal
+			cdp.InitFlag = &one
+		default:
+			n := int64(c.UnknownDatapoints)
+			cdp.Value = NewFloat(c.Value)
+			cdp.PrimaryValue = NewFloat(math.NaN())
+			cdp.SecondaryValue = NewFloat(math.NaN())
+			cdp.UnknownDatapoints = &n
+		}
+		r.CDPPrep = append(r.CDPPrep, cdp)
+	}
+
+	return r
+}
+
+// dependentRRA returns the index of the RRA which an RRA with consolidation
+// function cf depends on, as created by rrdtool, or nil if it has none.
+func dependentRRA(rras []*DumpRRA, cf string) *int64 {
+	var dep string
+	switch cf {
+	case rrd.HoltWintersPredict, rrd.MultipliedHoltWinterPredict:
+		dep = rrd.Seasonal
+	case rrd.Seasonal, rrd.DevSeasonal:
+		dep = rrd.HoltWintersPredict
+	case rrd.DevPredict, rrd.Failures:
+		dep = rrd.DevSeasonal
+	default:
+		return nil
+	}
+
+	for i, r := range rras {
+		if r.CF == dep || (dep == rrd.HoltWintersPredict && r.CF == rrd.MultipliedHoltWinterPredict) {
+			idx := int64(i)
+			return &idx
+		}
+	}
+
+	zero := int64(0)
+	return &zero
+}
+
+// fetchRRA fills in the database rows of r with the values fetched from c.
+func fetchRRA(ctx context.Context, c InfoFetcher, filename string, d *Dump, r *DumpRRA) error {
+	res := d.Step * r.PDPPerRow
+	rows := int64(len(r.Database))
+	end := d.LastUpdate - d.LastUpdate%res
+	first := end - (rows-1)*res
+
+	// Rows are returned from start + step so start one row early.
+	f, err := c.FetchContext(ctx, filename, r.CF, rrd.FetchOptions{
+		Start: rrd.At(time.Unix(first-res, 0)),
+		End:   rrd.At(time.Unix(end, 0)),
+	})
+	if err != nil {
+		return err
+	}
+
+	if f.Step != time.Duration(res)*time.Second {
+		return fmt.Errorf("fetch returned step %v instead of %v", f.Step, time.Duration(res)*time.Second)
+	}
+
+	if len(f.Names) != len(d.DS) {
+		return fmt.Errorf("fetch returned %v data sources instead of %v", len(f.Names), len(d.DS))
+	}
+
+	for _, row := range f.Rows {
+		i := (row.Time.Unix() - first) / res
+		if i < 0 || i >= rows || row.Time.Unix()%res != 0 {
+			continue
+		}
+
+		for j, v := range row.Data {
+			if v != nil && j < len(d.DS) {
+				r.Database[i].Values[j] = Float(*v)
+			}
+		}
+	}
+
+	return nil
+}
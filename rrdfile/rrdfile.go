@@ -0,0 +1,416 @@
+// Package rrdfile reads and writes rrdtool's binary .rrd file format directly,
+// without the need for a running rrdcached.
+//
+// Files created on both 32 and 64-bit platforms of either endianness can be
+// read, with results shaped the same as those returned by rrd.Client. Files
+// are written using the layout they were read with, new files using the layout
+// of the current platform so they can be used by rrdtool.
+//
+// RRDs can also be converted to and from rrdtool's XML dump format, including
+// those only reachable over rrdcached using RemoteDump.
+package rrdfile
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math"
+	"time"
+
+	"github.com/multiplay/go-rrd"
+)
+
+// DS represents a data source definition and its PDP preparation state.
+type DS struct {
+	Name      string
+	Type      string
+	Heartbeat time.Duration
+	Min       float64
+	Max       float64
+
+	// LastDS is the last value supplied to the data source.
+	LastDS string
+
+	// Value is the accumulated value of the current primary data point.
+	Value float64
+
+	// UnknownSec is the number of unknown seconds in the current primary data point.
+	UnknownSec int
+
+	par     [parCount]unival
+	scratch [parCount]unival
+}
+
+// CDPPrep represents the consolidation state of a data source in an RRA.
+type CDPPrep struct {
+	Value             float64
+	UnknownDatapoints int
+
+	scratch [parCount]unival
+}
+
+// RRA represents a round robin archive definition and its data.
+type RRA struct {
+	CF        string
+	Rows      int
+	PDPPerRow int
+	XFF       float64
+
+	// CurRow is the index in Data of the most recently written row.
+	CurRow int
+
+	// CDPPrep is the consolidation state for each data source.
+	CDPPrep []*CDPPrep
+
+	// Data is the ring buffer of rows, each containing a value for each data source.
+	Data [][]float64
+
+	par [parCount]unival
+}
+
+// File represents the contents of an RRD file.
+type File struct {
+	Version    string
+	Step       time.Duration
+	LastUpdate time.Time
+	DS         []*DS
+	RRA        []*RRA
+
+	layout     layout
+	par        [parCount]unival
+	headerSize int
+}
+
+// Open reads the RRD file filename.
+func Open(filename string) (*File, error) {
+	b, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+
+	f, err := decode(b)
+	if err != nil {
+		return nil, fmt.Errorf("%v: %v", filename, err)
+	}
+
+	return f, nil
+}
+
+// Read reads an RRD file from r.
+func Read(r io.Reader) (*File, error) {
+	b, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+
+	return decode(b)
+}
+
+// standardCF returns true if cf is one of the standard consolidation functions, false otherwise.
+func standardCF(cf string) bool {
+	switch cf {
+	case rrd.Average, rrd.Min, rrd.Max, rrd.Last:
+		return true
+	}
+	return false
+}
+
+// decode decodes the RRD file data b.
+func decode(b []byte) (*File, error) {
+	l, version, err := detect(b)
+	if err != nil {
+		return nil, err
+	}
+
+	f := &File{Version: version, layout: l}
+	d := &decoder{layout: l, buf: b}
+	align := l.maxAlign()
+
+	// stat_head_t
+	d.begin()
+	d.next(len(cookie)+5, 1)
+	d.double()
+	dsCnt := d.count(dsNameSize + dstSize)
+	rraCnt := d.count(cfNameSize)
+	f.Step = time.Duration(d.uword()) * time.Second
+	f.par = d.univals()
+	d.end(align)
+	if d.err == nil && f.Step <= 0 {
+		return nil, fmt.Errorf("invalid step %v", f.Step)
+	}
+
+	// ds_def_t
+	f.DS = make([]*DS, dsCnt)
+	for i := range f.DS {
+		d.begin()
+		ds := &DS{
+			Name: d.str(dsNameSize),
+			Type: d.str(dstSize),
+			par:  d.univals(),
+		}
+		d.end(align)
+		if ds.Type != rrd.Compute {
+			ds.Heartbeat = time.Duration(l.cnt(ds.par[0])) * time.Second
+			ds.Min = l.val(ds.par[1])
+			ds.Max = l.val(ds.par[2])
+		}
+		f.DS[i] = ds
+	}
+
+	// rra_def_t
+	f.RRA = make([]*RRA, rraCnt)
+	for i := range f.RRA {
+		d.begin()
+		rra := &RRA{CF: d.str(cfNameSize)}
+		rra.Rows = d.count(8 * dsCnt)
+		rra.PDPPerRow = int(d.uword())
+		rra.par = d.univals()
+		d.end(align)
+		if standardCF(rra.CF) {
+			rra.XFF = l.val(rra.par[0])
+		}
+		f.RRA[i] = rra
+	}
+
+	// live_head_t
+	d.begin()
+	last := d.sword()
+	var usec int64
+	if version >= "0003" {
+		usec = d.sword()
+	}
+	d.end(l.word)
+	f.LastUpdate = time.Unix(last, usec*int64(time.Microsecond))
+
+	// pdp_prep_t
+	for _, ds := range f.DS {
+		d.begin()
+		ds.LastDS = d.str(lastDSSize)
+		ds.scratch = d.univals()
+		d.end(align)
+		ds.UnknownSec = int(l.cnt(ds.scratch[0]))
+		ds.Value = l.val(ds.scratch[1])
+	}
+
+	// cdp_prep_t
+	for _, rra := range f.RRA {
+		rra.CDPPrep = make([]*CDPPrep, dsCnt)
+		for i := range rra.CDPPrep {
+			d.begin()
+			cdp := &CDPPrep{scratch: d.univals()}
+			d.end(align)
+			cdp.Value = l.val(cdp.scratch[0])
+			cdp.UnknownDatapoints = int(l.cnt(cdp.scratch[1]))
+			rra.CDPPrep[i] = cdp
+		}
+	}
+
+	// rra_ptr_t
+	for _, rra := range f.RRA {
+		d.begin()
+		rra.CurRow = int(d.uword())
+		d.end(l.word)
+	}
+
+	if d.err != nil {
+		return nil, d.err
+	}
+	f.headerSize = d.off
+
+	// rrd_value_t data
+	for _, rra := range f.RRA {
+		if rra.Rows == 0 || rra.PDPPerRow == 0 {
+			return nil, fmt.Errorf("invalid %v RRA with %v rows and %v pdp per row", rra.CF, rra.Rows, rra.PDPPerRow)
+		} else if rra.CurRow >= rra.Rows {
+			return nil, fmt.Errorf("invalid current row %v for RRA with %v rows", rra.CurRow, rra.Rows)
+		}
+
+		rra.Data = make([][]float64, rra.Rows)
+		for i := range rra.Data {
+			row := make([]float64, dsCnt)
+			for j := range row {
+				row[j] = math.Float64frombits(l.order.Uint64(d.next(8, 1)))
+			}
+			rra.Data[i] = row
+		}
+
+		if d.err != nil {
+			return nil, d.err
+		}
+	}
+
+	return f, nil
+}
+
+// step returns the duration of each row in rra in seconds.
+func (f *File) step(rra *RRA) int64 {
+	return int64(f.Step/time.Second) * int64(rra.PDPPerRow)
+}
+
+// end returns the time of the most recently written row in rra as a unix timestamp.
+func (f *File) end(rra *RRA) int64 {
+	step := f.step(rra)
+	last := f.LastUpdate.Unix()
+	return last - last%step
+}
+
+// Last returns the time of the last update.
+func (f *File) Last() time.Time {
+	return time.Unix(f.LastUpdate.Unix(), 0)
+}
+
+// First returns the time of the first data point in the specified RRA.
+func (f *File) First(rra int) (time.Time, error) {
+	if rra < 0 || rra >= len(f.RRA) {
+		return time.Time{}, ErrInvalidRRA
+	}
+
+	r := f.RRA[rra]
+	return time.Unix(f.end(r)-int64(r.Rows-1)*f.step(r), 0), nil
+}
+
+// rraFor returns the RRA with the given cf which best covers start to end at
+// the resolution step, using the same selection rules as rrdtool.
+func (f *File) rraFor(cf string, start, end, step int64) *RRA {
+	var full, part *RRA
+	var fullDiff, partDiff, partMatch int64
+	for _, rra := range f.RRA {
+		if rra.CF != cf {
+			continue
+		}
+
+		rstep := f.step(rra)
+		calEnd := f.end(rra)
+		calStart := calEnd - rstep*int64(rra.Rows)
+		diff := step - rstep
+		if diff < 0 {
+			diff = -diff
+		}
+
+		if calEnd >= end && calStart <= start {
+			if full == nil || diff < fullDiff {
+				full, fullDiff = rra, diff
+			}
+			continue
+		}
+
+		match := end - start
+		if calStart > start {
+			match -= calStart - start
+		}
+		if calEnd < end {
+			match -= end - calEnd
+		}
+
+		if part == nil || partMatch < match || (partMatch == match && diff < partDiff) {
+			part, partMatch, partDiff = rra, match, diff
+		}
+	}
+
+	if full != nil {
+		return full
+	}
+
+	return part
+}
+
+// Fetch returns the data consolidated with cf between start and end,
+// using the RRA which best matches the range.
+func (f *File) Fetch(cf string, start, end time.Time) (*rrd.Fetch, error) {
+	if !start.Before(end) {
+		return nil, ErrInvalidRange
+	}
+
+	s, e := start.Unix(), end.Unix()
+	rra := f.rraFor(cf, s, e, int64(f.Step/time.Second))
+	if rra == nil {
+		return nil, ErrNoMatchingRRA
+	}
+
+	step := f.step(rra)
+	s -= s % step
+	if o := e % step; o != 0 {
+		e += step - o
+	}
+
+	names := make([]string, len(f.DS))
+	for i, ds := range f.DS {
+		names[i] = ds.Name
+	}
+
+	r := &rrd.Fetch{
+		FetchCommon: rrd.FetchCommon{
+			FlushVersion: 1,
+			Start:        time.Unix(s, 0),
+			End:          time.Unix(e, 0),
+			Step:         time.Duration(step) * time.Second,
+			Count:        len(f.DS),
+		},
+		Names: names,
+	}
+
+	rraEnd := f.end(rra)
+	rraStart := rraEnd - step*int64(rra.Rows-1)
+	for t := s + step; t <= e; t += step {
+		row := rrd.FetchRow{Time: time.Unix(t, 0), Data: make([]*float64, len(f.DS))}
+		if t >= rraStart && t <= rraEnd {
+			age := int((rraEnd - t) / step)
+			data := rra.Data[(rra.CurRow-age+rra.Rows)%rra.Rows]
+			for i, v := range data {
+				if !math.IsNaN(v) {
+					v := v
+					row.Data[i] = &v
+				}
+			}
+		}
+		r.Rows = append(r.Rows, row)
+	}
+
+	return r, nil
+}
+
+// Info returns the configuration information of the RRD, using the same keys as rrdtool info.
+func (f *File) Info() []*rrd.Info {
+	info := []*rrd.Info{
+		{Key: "rrd_version", Value: f.Version},
+		{Key: "step", Value: int64(f.Step / time.Second)},
+		{Key: "last_update", Value: f.LastUpdate.Unix()},
+		{Key: "header_size", Value: int64(f.headerSize)},
+	}
+
+	add := func(key string, val interface{}) {
+		info = append(info, &rrd.Info{Key: key, Value: val})
+	}
+
+	for i, ds := range f.DS {
+		p := fmt.Sprintf("ds[%v].", ds.Name)
+		add(p+"index", int64(i))
+		add(p+"type", ds.Type)
+		if ds.Type != rrd.Compute {
+			add(p+"minimal_heartbeat", int64(ds.Heartbeat/time.Second))
+			add(p+"min", ds.Min)
+			add(p+"max", ds.Max)
+		}
+		add(p+"last_ds", ds.LastDS)
+		add(p+"value", ds.Value)
+		add(p+"unknown_sec", int64(ds.UnknownSec))
+	}
+
+	for i, rra := range f.RRA {
+		p := fmt.Sprintf("rra[%v].", i)
+		add(p+"cf", rra.CF)
+		add(p+"rows", int64(rra.Rows))
+		add(p+"cur_row", int64(rra.CurRow))
+		add(p+"pdp_per_row", int64(rra.PDPPerRow))
+		if standardCF(rra.CF) {
+			add(p+"xff", rra.XFF)
+		}
+		for j, cdp := range rra.CDPPrep {
+			cp := fmt.Sprintf("%vcdp_prep[%v].", p, j)
+			add(cp+"value", cdp.Value)
+			add(cp+"unknown_datapoints", int64(cdp.UnknownDatapoints))
+		}
+	}
+
+	return info
+}
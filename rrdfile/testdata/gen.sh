@@ -0,0 +1,26 @@
+#!/bin/sh
+# gen.sh creates the rrdtool fixtures used by TestRRDToolFixtures for the
+# platform it's run on, named by the optional argument which defaults to the
+# machine hardware name. It requires rrdtool.
+#
+#   <name>.rrd          an RRD created and updated by rrdtool.
+#   <name>.xml          the rrdtool dump of <name>.rrd.
+#   <name>-updated.xml  the rrdtool dump of <name>.rrd after the updates in
+#                       updates.txt.
+set -e
+
+cd "$(dirname "$0")"
+name=${1:-$(uname -m)}
+tmp=$(mktemp)
+trap 'rm -f "$tmp"' EXIT
+
+rrdtool create "$name.rrd" --start 1500000000 --step 300 \
+	DS:g:GAUGE:600:U:U DS:c:COUNTER:600:0:U \
+	RRA:AVERAGE:0.5:1:10 RRA:AVERAGE:0.5:3:5 RRA:MIN:0.5:3:5 RRA:MAX:0.5:3:5 RRA:LAST:0.5:3:5
+rrdtool update "$name.rrd" 1500000300:10:100 1500000600:20:400 1500000900:U:1000 1500001200:40:1300 1500001350:45:1400
+rrdtool dump "$name.rrd" > "$name.xml"
+
+cp "$name.rrd" "$tmp"
+# shellcheck disable=SC2046
+rrdtool update "$tmp" $(cat updates.txt)
+rrdtool dump "$tmp" > "$name-updated.xml"
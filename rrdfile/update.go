@@ -0,0 +1,411 @@
+package rrdfile
+
+import (
+	"fmt"
+	"math"
+	"math/big"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/multiplay/go-rrd"
+)
+
+var (
+	// counterWrap32 and counterWrap64 are the values added to
+	// negative COUNTER differences to handle 32 and 64-bit wraps.
+	counterWrap32 = math.Pow(2, 32)
+	counterWrap64 = math.Pow(2, 64) - math.Pow(2, 32)
+)
+
+// UpdateFile applies the updates to the RRD file filename.
+func UpdateFile(filename string, updates ...rrd.Update) error {
+	f, err := Open(filename)
+	if err != nil {
+		return err
+	}
+
+	err = f.Update(updates...)
+	if werr := f.WriteFile(filename); err == nil {
+		err = werr
+	}
+
+	return err
+}
+
+// Update applies the updates to the RRD in order, consolidating the values
+// into the RRAs the same way as rrdtool update.
+//
+// Each update is applied completely or not at all. If an update fails an error
+// is returned and the remaining updates are not applied.
+//
+// RRDs with COMPUTE data sources or Holt-Winters RRAs can't be updated.
+func (f *File) Update(updates ...rrd.Update) error {
+	for _, ds := range f.DS {
+		if ds.Type == rrd.Compute {
+			return fmt.Errorf("updating %v data sources is not supported", ds.Type)
+		}
+	}
+
+	for _, rra := range f.RRA {
+		if !standardCF(rra.CF) {
+			return fmt.Errorf("updating %v RRAs is not supported", rra.CF)
+		}
+	}
+
+	for _, u := range updates {
+		if err := f.update(string(u)); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// parseUpdateTime parses the time of an update, which is either N for now
+// or a unix timestamp with optional fractional seconds.
+func parseUpdateTime(s string) (time.Time, error) {
+	if s == "N" {
+		return time.Now().Truncate(time.Microsecond), nil
+	}
+
+	parts := strings.SplitN(s, ".", 2)
+	sec, err := strconv.ParseInt(parts[0], 10, 64)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid update time %q", s)
+	}
+
+	var usec int64
+	if len(parts) == 2 {
+		frac := (parts[1] + "000000")[:6]
+		if usec, err = strconv.ParseInt(frac, 10, 64); err != nil || usec < 0 {
+			return time.Time{}, fmt.Errorf("invalid update time %q", s)
+		}
+	}
+
+	return time.Unix(sec, usec*int64(time.Microsecond)), nil
+}
+
+// seconds returns t as fractional unix seconds relative to base.
+func seconds(t time.Time, base int64) float64 {
+	return float64(t.Unix()-base) + float64(t.Nanosecond()/int(time.Microsecond))/1e6
+}
+
+// update applies the single update u.
+func (f *File) update(u string) error {
+	parts := strings.Split(u, ":")
+	if len(parts)-1 != len(f.DS) {
+		return fmt.Errorf("expected %v data source readings (got %v) from %v", len(f.DS), len(parts)-1, u)
+	}
+
+	t, err := parseUpdateTime(parts[0])
+	if err != nil {
+		return err
+	}
+
+	if !t.After(f.LastUpdate) {
+		return fmt.Errorf("illegal attempt to update using time %v when last update time is %v (minimum one second step)",
+			t.Unix(), f.LastUpdate.Unix())
+	}
+
+	step := int64(f.Step / time.Second)
+	last, cur := f.LastUpdate.Unix(), t.Unix()
+	interval := seconds(t, last) - seconds(f.LastUpdate, last)
+
+	// Calculate the new primary data point values before changing any state.
+	pdpNew := make([]float64, len(f.DS))
+	for i, ds := range f.DS {
+		if pdpNew[i], err = ds.pdp(parts[i+1], interval); err != nil {
+			return err
+		}
+	}
+
+	procPDPSt := last - last%step
+	occuPDPSt := cur - cur%step
+	elapsed := (occuPDPSt - procPDPSt) / step
+
+	if elapsed == 0 {
+		// Still within the current primary data point.
+		for i, ds := range f.DS {
+			switch {
+			case math.IsNaN(pdpNew[i]):
+				ds.UnknownSec += int(math.Floor(interval))
+			case math.IsNaN(ds.Value):
+				ds.Value = pdpNew[i]
+			default:
+				ds.Value += pdpNew[i]
+			}
+		}
+	} else {
+		preInt := seconds(time.Unix(occuPDPSt, 0), last) - seconds(f.LastUpdate, last)
+		postInt := seconds(t, occuPDPSt)
+		pdpTemp := f.processPDP(pdpNew, interval, preInt, postInt, float64(occuPDPSt-procPDPSt))
+		for _, rra := range f.RRA {
+			f.processCDP(rra, pdpTemp, procPDPSt/step, elapsed)
+		}
+	}
+
+	for i, ds := range f.DS {
+		v := parts[i+1]
+		if len(v) > lastDSSize-1 {
+			v = v[:lastDSSize-1]
+		}
+		ds.LastDS = v
+	}
+	f.LastUpdate = t
+
+	return nil
+}
+
+// pdp returns the value val contributes to the current primary data point over
+// interval seconds, or NaN if it's unknown, as determined by the data source type.
+func (ds *DS) pdp(val string, interval float64) (float64, error) {
+	if val == "U" || float64(ds.Heartbeat/time.Second) < interval {
+		return math.NaN(), nil
+	}
+
+	var pdp, rate float64
+	switch ds.Type {
+	case rrd.Counter, rrd.Derive:
+		v, ok := new(big.Int).SetString(val, 10)
+		if !ok || (ds.Type == rrd.Counter && v.Sign() < 0) || strings.HasPrefix(val, "+") {
+			kind := "unsigned"
+			if ds.Type == rrd.Derive {
+				kind = "signed"
+			}
+			return 0, fmt.Errorf("not a simple %v integer: '%v'", kind, val)
+		}
+
+		prev, ok := new(big.Int).SetString(ds.LastDS, 10)
+		if !ok {
+			return math.NaN(), nil
+		}
+
+		pdp, _ = new(big.Float).SetInt(v.Sub(v, prev)).Float64()
+		if ds.Type == rrd.Counter {
+			if pdp < 0 {
+				pdp += counterWrap32
+			}
+			if pdp < 0 {
+				pdp += counterWrap64
+			}
+		}
+		rate = pdp / interval
+	case rrd.DCounter, rrd.DDerive:
+		v, err := strconv.ParseFloat(val, 64)
+		if err != nil {
+			return 0, fmt.Errorf("conversion of '%v' to float not complete", val)
+		}
+
+		prev, err := strconv.ParseFloat(ds.LastDS, 64)
+		if err != nil {
+			return math.NaN(), nil
+		}
+
+		pdp = v - prev
+		if ds.Type == rrd.DCounter && pdp < 0 {
+			// Wraps can't be detected for floating point counters.
+			return math.NaN(), nil
+		}
+		rate = pdp / interval
+	case rrd.Absolute:
+		v, err := strconv.ParseFloat(val, 64)
+		if err != nil {
+			return 0, fmt.Errorf("conversion of '%v' to float not complete", val)
+		}
+		pdp = v
+		rate = pdp / interval
+	case rrd.Gauge:
+		v, err := strconv.ParseFloat(val, 64)
+		if err != nil {
+			return 0, fmt.Errorf("conversion of '%v' to float not complete", val)
+		}
+		pdp = v * interval
+		rate = v
+	default:
+		return 0, fmt.Errorf("unsupported DS type %v", ds.Type)
+	}
+
+	if !math.IsNaN(rate) && ((!math.IsNaN(ds.Max) && rate > ds.Max) || (!math.IsNaN(ds.Min) && rate < ds.Min)) {
+		return math.NaN(), nil
+	}
+
+	return pdp, nil
+}
+
+// processPDP completes the current primary data point of each data source,
+// returning their values and preparing the next primary data points.
+func (f *File) processPDP(pdpNew []float64, interval, preInt, postInt, diff float64) []float64 {
+	pdpTemp := make([]float64, len(f.DS))
+	half := float64(f.Step/time.Second) / 2
+	for i, ds := range f.DS {
+		var preUnknown float64
+		if math.IsNaN(pdpNew[i]) {
+			preUnknown = preInt
+		} else {
+			if math.IsNaN(ds.Value) {
+				ds.Value = 0
+			}
+			ds.Value += pdpNew[i] / interval * preInt
+		}
+
+		// If the interval exceeds the heartbeat or too much of the
+		// primary data point is unknown then it's unknown.
+		if interval > float64(ds.Heartbeat/time.Second) || half < float64(ds.UnknownSec) {
+			pdpTemp[i] = math.NaN()
+		} else {
+			pdpTemp[i] = ds.Value / (diff - float64(ds.UnknownSec) - preUnknown)
+		}
+
+		if math.IsNaN(pdpNew[i]) {
+			ds.UnknownSec = int(math.Floor(postInt))
+			ds.Value = math.NaN()
+		} else {
+			ds.UnknownSec = 0
+			ds.Value = pdpNew[i] / interval * postInt
+		}
+	}
+
+	return pdpTemp
+}
+
+// processCDP consolidates the elapsed primary data points pdpTemp into rra,
+// where procPDPCnt is the number of the primary data point which was in progress,
+// writing any completed rows.
+func (f *File) processCDP(rra *RRA, pdpTemp []float64, procPDPCnt, elapsed int64) {
+	pdpCnt := int64(rra.PDPPerRow)
+	start := pdpCnt - procPDPCnt%pdpCnt
+	var steps int64
+	if start <= elapsed {
+		steps = (elapsed-start)/pdpCnt + 1
+	}
+
+	primary := make([]float64, len(pdpTemp))
+	secondary := make([]float64, len(pdpTemp))
+	for i, cdp := range rra.CDPPrep {
+		if pdpCnt == 1 {
+			primary[i], secondary[i] = pdpTemp[i], pdpTemp[i]
+		} else {
+			primary[i], secondary[i] = cdp.update(rra, pdpTemp[i], elapsed, start, steps)
+		}
+		f.layout.setVal(&cdp.scratch[cdpPrimary], primary[i])
+		f.layout.setVal(&cdp.scratch[cdpSecondary], secondary[i])
+	}
+
+	if steps == 0 {
+		return
+	}
+
+	// Rows beyond the size of the RRA would be overwritten anyway.
+	var k int64
+	if skip := steps - int64(rra.Rows); skip > 0 {
+		rra.CurRow = int((int64(rra.CurRow) + skip) % int64(rra.Rows))
+		k = skip
+	}
+
+	for ; k < steps; k++ {
+		rra.CurRow = (rra.CurRow + 1) % rra.Rows
+		vals := secondary
+		if k == 0 {
+			vals = primary
+		}
+		copy(rra.Data[rra.CurRow], vals)
+	}
+}
+
+// ifNaN returns v or def if v is NaN.
+func ifNaN(v, def float64) float64 {
+	if math.IsNaN(v) {
+		return def
+	}
+	return v
+}
+
+// update consolidates the value pdp of elapsed primary data points, of which
+// the first start complete the current consolidated data point, returning
+// the values for the first and subsequent rows if steps rows are completed.
+func (cdp *CDPPrep) update(rra *RRA, pdp float64, elapsed, start, steps int64) (primary, secondary float64) {
+	pdpCnt := int64(rra.PDPPerRow)
+	if steps == 0 {
+		switch {
+		case math.IsNaN(pdp):
+			cdp.UnknownDatapoints += int(elapsed)
+		case math.IsNaN(cdp.Value) && rra.CF == rrd.Average:
+			cdp.Value = pdp * float64(elapsed)
+		case math.IsNaN(cdp.Value):
+			cdp.Value = pdp
+		default:
+			switch rra.CF {
+			case rrd.Average:
+				cdp.Value += pdp * float64(elapsed)
+			case rrd.Min:
+				cdp.Value = math.Min(cdp.Value, pdp)
+			case rrd.Max:
+				cdp.Value = math.Max(cdp.Value, pdp)
+			default:
+				cdp.Value = pdp
+			}
+		}
+		return math.NaN(), math.NaN()
+	}
+
+	secondary = pdp
+	if math.IsNaN(pdp) {
+		cdp.UnknownDatapoints += int(start)
+	}
+
+	if float64(cdp.UnknownDatapoints) > float64(pdpCnt)*rra.XFF {
+		primary = math.NaN()
+	} else {
+		switch rra.CF {
+		case rrd.Average:
+			primary = (ifNaN(cdp.Value, 0) + ifNaN(pdp, 0)*float64(start)) / float64(pdpCnt-int64(cdp.UnknownDatapoints))
+		case rrd.Min:
+			primary = math.Min(ifNaN(cdp.Value, math.Inf(1)), ifNaN(pdp, math.Inf(1)))
+			if math.IsInf(primary, 1) {
+				primary = math.NaN()
+			}
+		case rrd.Max:
+			primary = math.Max(ifNaN(cdp.Value, math.Inf(-1)), ifNaN(pdp, math.Inf(-1)))
+			if math.IsInf(primary, -1) {
+				primary = math.NaN()
+			}
+		default:
+			primary = pdp
+		}
+	}
+
+	// Carry over the primary data points which start the next consolidated data point.
+	post := (elapsed - start) % pdpCnt
+	cdp.Value = carryOver(rra.CF, pdp, post)
+	if math.IsNaN(pdp) {
+		cdp.UnknownDatapoints = int(post)
+	} else {
+		cdp.UnknownDatapoints = 0
+	}
+
+	return primary, secondary
+}
+
+// carryOver returns the initial value of the consolidated data point which
+// starts with post primary data points of value pdp, as rrdtool's
+// initialize_carry_over, so an empty AVERAGE is 0, MIN +Inf and MAX -Inf
+// while LAST is always pdp.
+func carryOver(cf string, pdp float64, post int64) float64 {
+	if post == 0 || math.IsNaN(pdp) {
+		switch cf {
+		case rrd.Average:
+			return 0
+		case rrd.Min:
+			return math.Inf(1)
+		case rrd.Max:
+			return math.Inf(-1)
+		}
+		return pdp
+	}
+
+	if cf == rrd.Average {
+		return pdp * float64(post)
+	}
+	return pdp
+}
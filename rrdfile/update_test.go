@@ -0,0 +1,239 @@
+package rrdfile
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	"github.com/multiplay/go-rrd"
+	"github.com/stretchr/testify/assert"
+)
+
+// fetchValues returns the values of the first data source fetched with cf
+// between start and end, with unknown values as NaN.
+func fetchValues(t *testing.T, f *File, cf string, start, end time.Time) []float64 {
+	r, err := f.Fetch(cf, start, end)
+	if !assert.NoError(t, err) {
+		return nil
+	}
+
+	vals := make([]float64, len(r.Rows))
+	for i, row := range r.Rows {
+		vals[i] = math.NaN()
+		if row.Data[0] != nil {
+			vals[i] = *row.Data[0]
+		}
+	}
+	return vals
+}
+
+// assertValues asserts that actual equals expected, treating NaNs as equal.
+func assertValues(t *testing.T, expected, actual []float64) {
+	if !assert.Len(t, actual, len(expected)) {
+		return
+	}
+
+	for i, v := range expected {
+		if math.IsNaN(v) {
+			assert.True(t, math.IsNaN(actual[i]), "value %v: expected NaN got %v", i, actual[i])
+		} else {
+			assert.Equal(t, v, actual[i], "value %v", i)
+		}
+	}
+}
+
+// at returns an update at offset seconds from testEnd.
+func at(offset int, val interface{}, vals ...interface{}) rrd.Update {
+	return rrd.NewUpdate(testEnd.Add(time.Second*time.Duration(offset)), val, vals...)
+}
+
+func TestUpdateGauge(t *testing.T) {
+	f, err := Create(
+		[]rrd.DS{rrd.NewDS("DS:g:GAUGE:600:U:U")},
+		[]rrd.RRA{rrd.NewAverage(0.5, 1, 20), rrd.NewAverage(0.5, 3, 10), rrd.NewMax(0.5, 3, 10)},
+		rrd.Start(testEnd),
+	)
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	err = f.Update(
+		at(300, 10), at(600, 20), at(900, 30), at(1200, 40),
+		// Exceeds the heartbeat so unknown.
+		at(2700, 50),
+		at(3000, 60),
+		// Partial steps.
+		at(3150, 10), at(3300, 20),
+		at(3600, 30),
+	)
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	nan := math.NaN()
+	end := testEnd.Add(time.Second * 3600)
+	assertValues(t, []float64{10, 20, 30, 40, nan, nan, nan, nan, nan, 60, 15, 30},
+		fetchValues(t, f, rrd.Average, testEnd, end))
+
+	// The first row has too many unknown primary data points from the creation
+	// start and the fourth includes two unknown from the heartbeat gap.
+	assertValues(t, []float64{nan, 40, nan, nan, nan}, fetchValues(t, f, rrd.Max, testEnd, end))
+
+	avg, max := f.RRA[1], f.RRA[2]
+	assert.Equal(t, 30.0, avg.Data[avg.CurRow-2][0])
+	assert.Equal(t, 45.0, avg.CDPPrep[0].Value)
+	assert.Equal(t, 0, avg.CDPPrep[0].UnknownDatapoints)
+	assert.Equal(t, 30.0, max.CDPPrep[0].Value)
+	assert.Equal(t, "30", f.DS[0].LastDS)
+	assert.Equal(t, end, f.LastUpdate)
+}
+
+func TestUpdateCarryOver(t *testing.T) {
+	f, err := Create(
+		[]rrd.DS{rrd.NewDS("DS:g:GAUGE:600:U:U")},
+		[]rrd.RRA{rrd.NewAverage(0.5, 3, 10), rrd.NewMin(0.5, 3, 10), rrd.NewMax(0.5, 3, 10), rrd.NewLast(0.5, 3, 10)},
+		rrd.Start(testEnd),
+	)
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	// As rrdtool, a consolidated data point which has no primary data points
+	// yet starts from the identity of its consolidation function, except LAST
+	// which keeps the last primary data point.
+	cdps := func() []float64 {
+		vals := make([]float64, len(f.RRA))
+		for i, rra := range f.RRA {
+			vals[i] = rra.CDPPrep[0].Value
+		}
+		return vals
+	}
+
+	// Completes a consolidated data point.
+	if !assert.NoError(t, f.Update(at(300, 10))) {
+		return
+	}
+	assertValues(t, []float64{0, math.Inf(1), math.Inf(-1), 10}, cdps())
+
+	if !assert.NoError(t, f.Update(at(600, 20), at(900, "U"), at(1200, 40))) {
+		return
+	}
+	end := testEnd.Add(time.Second * 1200)
+	assertValues(t, []float64{30}, fetchValues(t, f, rrd.Average, end.Add(-time.Second), end))
+	assertValues(t, []float64{20}, fetchValues(t, f, rrd.Min, end.Add(-time.Second), end))
+	assertValues(t, []float64{40}, fetchValues(t, f, rrd.Max, end.Add(-time.Second), end))
+	assertValues(t, []float64{0, math.Inf(1), math.Inf(-1), 40}, cdps())
+
+	// Part way into the next.
+	if !assert.NoError(t, f.Update(at(1500, 50))) {
+		return
+	}
+	assertValues(t, []float64{50, 50, 50, 50}, cdps())
+}
+
+func TestUpdateRates(t *testing.T) {
+	f, err := Create(
+		[]rrd.DS{
+			rrd.NewDS("DS:c:COUNTER:600:U:U"),
+			rrd.NewDS("DS:d:DERIVE:600:0:U"),
+			rrd.NewDS("DS:a:ABSOLUTE:600:U:U"),
+		},
+		[]rrd.RRA{rrd.NewAverage(0.5, 1, 10)},
+		rrd.Start(testEnd),
+	)
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	err = f.Update(
+		at(300, 4294967290, 100, 600),
+		// Counter wraps at 32-bits and derive goes below min.
+		at(600, 2994, 50, 300),
+		at(900, 5994, 200, "U"),
+	)
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	r, err := f.Fetch(rrd.Average, testEnd, testEnd.Add(time.Second*900))
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	val := func(v float64) *float64 { return &v }
+	assert.Equal(t, []rrd.FetchRow{
+		{Time: testEnd.Add(time.Second * 300), Data: []*float64{nil, nil, val(2)}},
+		{Time: testEnd.Add(time.Second * 600), Data: []*float64{val(10), nil, val(1)}},
+		{Time: testEnd.Add(time.Second * 900), Data: []*float64{val(10), val(0.5), nil}},
+	}, r.Rows)
+}
+
+func TestUpdateWrap(t *testing.T) {
+	f, err := Create(
+		[]rrd.DS{rrd.NewDS("DS:g:GAUGE:100000:U:U")},
+		[]rrd.RRA{rrd.NewAverage(0.5, 1, 5)},
+		rrd.Start(testEnd),
+	)
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	if !assert.NoError(t, f.Update(at(2400, 7))) {
+		return
+	}
+
+	rra := f.RRA[0]
+	assert.Equal(t, 2, rra.CurRow)
+	for _, row := range rra.Data {
+		assert.Equal(t, []float64{7}, row)
+	}
+}
+
+func TestUpdateErrors(t *testing.T) {
+	f, err := Create(
+		[]rrd.DS{rrd.NewDS("DS:c:COUNTER:600:U:U"), rrd.NewDS("DS:g:GAUGE:600:U:U")},
+		[]rrd.RRA{rrd.NewAverage(0.5, 1, 10)},
+		rrd.Start(testEnd),
+	)
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	if !assert.NoError(t, f.Update(at(300, 1, 1))) {
+		return
+	}
+
+	err = f.Update(at(300, 2, 2))
+	if assert.Error(t, err) {
+		assert.Contains(t, err.Error(), "illegal attempt to update using time")
+	}
+
+	for _, u := range []rrd.Update{
+		at(600, 1),
+		at(600, "1.5", 1),
+		at(600, -1, 1),
+		at(600, 1, "abc"),
+		"bogus:1:1",
+	} {
+		assert.Error(t, f.Update(u), string(u))
+	}
+
+	// Failed updates must not change the state.
+	assert.Equal(t, "1", f.DS[0].LastDS)
+	assert.Equal(t, testEnd.Add(time.Second*300), f.LastUpdate)
+}
+
+func TestParseUpdateTime(t *testing.T) {
+	v, err := parseUpdateTime("1500000000.25")
+	if assert.NoError(t, err) {
+		assert.Equal(t, time.Unix(1500000000, int64(time.Millisecond*250)), v)
+	}
+
+	v, err = parseUpdateTime("N")
+	if assert.NoError(t, err) {
+		assert.WithinDuration(t, time.Now(), v, time.Second)
+	}
+
+	_, err = parseUpdateTime("1500000000.x")
+	assert.Error(t, err)
+}
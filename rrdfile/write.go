@@ -0,0 +1,172 @@
+package rrdfile
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math"
+	"time"
+
+	"github.com/multiplay/go-rrd"
+)
+
+// header encodes everything but the RRA data of f into e.
+func (f *File) header(e *encoder) {
+	l := f.layout
+	align := l.maxAlign()
+
+	// stat_head_t
+	e.begin()
+	e.str(cookie, len(cookie))
+	e.str(f.Version, 5)
+	e.double(floatCookie)
+	e.uword(uint64(len(f.DS)))
+	e.uword(uint64(len(f.RRA)))
+	e.uword(uint64(f.Step / time.Second))
+	e.univals(f.par)
+	e.end(align)
+
+	// ds_def_t
+	for _, ds := range f.DS {
+		par := ds.par
+		if ds.Type != rrd.Compute {
+			l.setCnt(&par[0], uint64(ds.Heartbeat/time.Second))
+			l.setVal(&par[1], ds.Min)
+			l.setVal(&par[2], ds.Max)
+		}
+		e.begin()
+		e.str(ds.Name, dsNameSize)
+		e.str(ds.Type, dstSize)
+		e.univals(par)
+		e.end(align)
+	}
+
+	// rra_def_t
+	for _, rra := range f.RRA {
+		par := rra.par
+		if standardCF(rra.CF) {
+			l.setVal(&par[0], rra.XFF)
+		}
+		e.begin()
+		e.str(rra.CF, cfNameSize)
+		e.uword(uint64(rra.Rows))
+		e.uword(uint64(rra.PDPPerRow))
+		e.univals(par)
+		e.end(align)
+	}
+
+	// live_head_t
+	e.begin()
+	e.sword(f.LastUpdate.Unix())
+	if f.Version >= "0003" {
+		e.sword(int64(f.LastUpdate.Nanosecond()) / int64(time.Microsecond))
+	}
+	e.end(l.word)
+
+	// pdp_prep_t
+	for _, ds := range f.DS {
+		scratch := ds.scratch
+		l.setCnt(&scratch[0], uint64(ds.UnknownSec))
+		l.setVal(&scratch[1], ds.Value)
+		e.begin()
+		e.str(ds.LastDS, lastDSSize)
+		e.univals(scratch)
+		e.end(align)
+	}
+
+	// cdp_prep_t
+	for _, rra := range f.RRA {
+		for _, cdp := range rra.CDPPrep {
+			scratch := cdp.scratch
+			if standardCF(rra.CF) {
+				l.setVal(&scratch[0], cdp.Value)
+				l.setCnt(&scratch[1], uint64(cdp.UnknownDatapoints))
+			}
+			e.begin()
+			e.univals(scratch)
+			e.end(align)
+		}
+	}
+
+	// rra_ptr_t
+	for _, rra := range f.RRA {
+		e.begin()
+		e.uword(uint64(rra.CurRow))
+		e.end(l.word)
+	}
+}
+
+// validate checks that the dimensions of f are consistent, so it can be encoded.
+func (f *File) validate() error {
+	switch {
+	case f.Step < time.Second:
+		return fmt.Errorf("invalid step %v", f.Step)
+	case len(f.DS) == 0:
+		return fmt.Errorf("you must define at least one Data Source")
+	case len(f.RRA) == 0:
+		return fmt.Errorf("you must define at least one Round Robin Archive")
+	}
+
+	for _, rra := range f.RRA {
+		switch {
+		case rra.Rows < 1 || rra.PDPPerRow < 1:
+			return fmt.Errorf("invalid %v RRA with %v rows and %v pdp per row", rra.CF, rra.Rows, rra.PDPPerRow)
+		case rra.CurRow < 0 || rra.CurRow >= rra.Rows:
+			return fmt.Errorf("invalid current row %v for RRA with %v rows", rra.CurRow, rra.Rows)
+		case len(rra.CDPPrep) != len(f.DS):
+			return fmt.Errorf("invalid %v RRA with %v CDP preps for %v data sources", rra.CF, len(rra.CDPPrep), len(f.DS))
+		case len(rra.Data) != rra.Rows:
+			return fmt.Errorf("invalid %v RRA with %v data rows for %v rows", rra.CF, len(rra.Data), rra.Rows)
+		}
+
+		for _, row := range rra.Data {
+			if len(row) != len(f.DS) {
+				return fmt.Errorf("invalid %v RRA row with %v values for %v data sources", rra.CF, len(row), len(f.DS))
+			}
+		}
+	}
+
+	return nil
+}
+
+// encode returns the RRD file data of f using its original layout.
+func (f *File) encode() ([]byte, error) {
+	if err := f.validate(); err != nil {
+		return nil, err
+	}
+
+	e := &encoder{layout: f.layout}
+	f.header(e)
+
+	// rrd_value_t data
+	for _, rra := range f.RRA {
+		for _, row := range rra.Data {
+			for _, v := range row {
+				f.layout.order.PutUint64(e.next(8, 1), math.Float64bits(v))
+			}
+		}
+	}
+
+	return e.buf, nil
+}
+
+// WriteTo writes the RRD file data to w.
+func (f *File) WriteTo(w io.Writer) (int64, error) {
+	b, err := f.encode()
+	if err != nil {
+		return 0, err
+	}
+
+	n, err := w.Write(b)
+	return int64(n), err
+}
+
+// WriteFile writes the RRD to filename, creating it if it doesn't exist.
+func (f *File) WriteFile(filename string) error {
+	b, err := f.encode()
+	if err != nil {
+		return err
+	}
+
+	return ioutil.WriteFile(filename, b, 0644)
+}
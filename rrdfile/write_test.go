@@ -0,0 +1,65 @@
+package rrdfile
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWriteTo(t *testing.T) {
+	for _, arch := range testArchs {
+		t.Run(arch.name, func(t *testing.T) {
+			data := newTestFile(arch)
+			f, err := Read(bytes.NewReader(data))
+			if !assert.NoError(t, err) {
+				return
+			}
+
+			var buf bytes.Buffer
+			n, err := f.WriteTo(&buf)
+			if assert.NoError(t, err) {
+				assert.Equal(t, int64(len(data)), n)
+				assert.Equal(t, data, buf.Bytes())
+			}
+		})
+	}
+}
+
+func TestWriteToInvalid(t *testing.T) {
+	f, err := Read(bytes.NewReader(newTestFile(testArchs[0])))
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	f.RRA[0].Data = f.RRA[0].Data[1:]
+	_, err = f.WriteTo(ioutil.Discard)
+	assert.Error(t, err)
+}
+
+func TestWriteFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "rrdfile")
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer os.RemoveAll(dir) // nolint: errcheck
+
+	data := newTestFile(testArchs[1])
+	f, err := Read(bytes.NewReader(data))
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	filename := filepath.Join(dir, "test.rrd")
+	if !assert.NoError(t, f.WriteFile(filename)) {
+		return
+	}
+
+	b, err := ioutil.ReadFile(filename)
+	if assert.NoError(t, err) {
+		assert.Equal(t, data, b)
+	}
+}
@@ -0,0 +1,268 @@
+package rrd
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"time"
+)
+
+// SchemaChangeType is the type of a SchemaChange.
+type SchemaChangeType int
+
+// Schema change types.
+const (
+	// StepChanged indicates the base step of the RRD differs.
+	StepChanged SchemaChangeType = iota
+
+	// DSAdded indicates a data source is missing from the RRD.
+	DSAdded
+
+	// DSRemoved indicates a data source of the RRD is no longer defined.
+	DSRemoved
+
+	// DSRenamed indicates a data source is mapped from a differently named one in the RRD.
+	DSRenamed
+
+	// DSChanged indicates a field of a data source differs.
+	DSChanged
+
+	// RRAAdded indicates an RRA is missing from the RRD.
+	RRAAdded
+
+	// RRARemoved indicates an RRA of the RRD is no longer defined.
+	RRARemoved
+
+	// RRAResized indicates the number of rows of an RRA differs.
+	RRAResized
+
+	// RRAChanged indicates a field of an RRA, other than its rows, differs.
+	RRAChanged
+)
+
+var schemaChangeTypes = map[SchemaChangeType]string{
+	StepChanged: "step changed",
+	DSAdded:     "ds added",
+	DSRemoved:   "ds removed",
+	DSRenamed:   "ds renamed",
+	DSChanged:   "ds changed",
+	RRAAdded:    "rra added",
+	RRARemoved:  "rra removed",
+	RRAResized:  "rra resized",
+	RRAChanged:  "rra changed",
+}
+
+func (t SchemaChangeType) String() string {
+	if s, ok := schemaChangeTypes[t]; ok {
+		return s
+	}
+	return fmt.Sprintf("unknown change %d", int(t))
+}
+
+// SchemaChange represents a difference between a Schema and an existing RRD.
+type SchemaChange struct {
+	Type SchemaChangeType
+
+	// Name identifies the data source by name or the RRA as CF:steps.
+	Name string
+
+	// Field is the name of the changed field for DSChanged and RRAChanged.
+	Field string
+
+	// Old and New are the existing and desired values, if applicable.
+	Old interface{}
+	New interface{}
+}
+
+func (c *SchemaChange) String() string {
+	switch c.Type {
+	case StepChanged, RRAResized:
+		return fmt.Sprintf("%v %v: %v -> %v", c.Type, c.Name, c.Old, c.New)
+	case DSRenamed:
+		return fmt.Sprintf("%v: %v -> %v", c.Type, c.Old, c.Name)
+	case DSChanged, RRAChanged:
+		return fmt.Sprintf("%v %v: %v %v -> %v", c.Type, c.Name, c.Field, c.Old, c.New)
+	}
+	return fmt.Sprintf("%v %v", c.Type, c.Name)
+}
+
+// Schema represents the desired definition of an RRD.
+type Schema struct {
+	// Step is the base step, if zero the existing step is kept.
+	Step time.Duration
+	DS   []DS
+	RRA  []RRA
+}
+
+// rraKey returns the identifier of the RRA used to match it with an existing one.
+func rraKey(cf string, steps int) string {
+	return fmt.Sprintf("%v:%v", cf, steps)
+}
+
+// floatsEqual returns true if a and b are equal or both NaN.
+func floatsEqual(a, b float64) bool {
+	return a == b || (math.IsNaN(a) && math.IsNaN(b))
+}
+
+// Diff returns the changes needed to migrate the existing RRD described by info to s.
+//
+// Data sources are matched by name, or if there's no data source of that name
+// by mapped name if given, and RRAs by consolidation function and steps.
+func (s *Schema) Diff(info *RRDInfo) ([]*SchemaChange, error) {
+	var changes []*SchemaChange
+	add := func(t SchemaChangeType, name, field string, old, new interface{}) {
+		changes = append(changes, &SchemaChange{Type: t, Name: name, Field: field, Old: old, New: new})
+	}
+
+	if s.Step != 0 && s.Step != info.Step {
+		add(StepChanged, "step", "", info.Step, s.Step)
+	}
+
+	used := make(map[string]bool)
+	for _, d := range s.DS {
+		ds, err := ParseDS(d)
+		if err != nil {
+			return nil, err
+		}
+
+		src := ds.Name
+		old := info.DSNamed(src)
+		if old == nil && ds.MappedName != "" {
+			// Not yet renamed.
+			src = ds.MappedName
+			old = info.DSNamed(src)
+		}
+
+		if old == nil {
+			add(DSAdded, ds.Name, "", nil, nil)
+			continue
+		}
+		used[src] = true
+
+		if src != ds.Name {
+			add(DSRenamed, ds.Name, "", src, nil)
+		}
+
+		if old.Type != ds.Type {
+			add(DSChanged, ds.Name, "type", old.Type, ds.Type)
+		}
+
+		if ds.Type == Compute {
+			if old.CDEF != ds.CDEF {
+				add(DSChanged, ds.Name, "cdef", old.CDEF, ds.CDEF)
+			}
+			continue
+		}
+
+		if old.Heartbeat != ds.Heartbeat {
+			add(DSChanged, ds.Name, "heartbeat", old.Heartbeat, ds.Heartbeat)
+		}
+		if !floatsEqual(old.Min, ds.Min) {
+			add(DSChanged, ds.Name, "min", old.Min, ds.Min)
+		}
+		if !floatsEqual(old.Max, ds.Max) {
+			add(DSChanged, ds.Name, "max", old.Max, ds.Max)
+		}
+	}
+
+	for _, ds := range info.DS {
+		if !used[ds.Name] {
+			add(DSRemoved, ds.Name, "", nil, nil)
+		}
+	}
+
+	matched := make([]bool, len(info.RRA))
+	for _, r := range s.RRA {
+		rra, err := ParseRRA(r)
+		if err != nil {
+			return nil, err
+		}
+		key := rraKey(rra.CF, rra.Steps)
+
+		var old *RRAInfo
+		for i, o := range info.RRA {
+			if !matched[i] && o.CF == rra.CF && o.PDPPerRow == rra.Steps {
+				matched[i] = true
+				old = o
+				break
+			}
+		}
+
+		if old == nil {
+			add(RRAAdded, key, "", nil, rra.Rows)
+			continue
+		}
+
+		if old.Rows != rra.Rows {
+			add(RRAResized, key, "", old.Rows, rra.Rows)
+		}
+		if !floatsEqual(old.XFF, rra.XFF) {
+			add(RRAChanged, key, "xff", old.XFF, rra.XFF)
+		}
+	}
+
+	for i, o := range info.RRA {
+		if !matched[i] {
+			add(RRARemoved, rraKey(o.CF, o.PDPPerRow), "", o.Rows, nil)
+		}
+	}
+
+	return changes, nil
+}
+
+// Migrate migrates the RRD filename to schema if it differs, returning the
+// changes which were made.
+//
+// The RRD is flushed and then recreated using itself as the Source, so rrdtool
+// preserves the existing data of matching data sources and RRAs.
+func (c *Client) Migrate(filename string, schema *Schema) ([]*SchemaChange, error) {
+	return c.MigrateContext(context.Background(), filename, schema)
+}
+
+// MigrateContext migrates the RRD filename to schema if it differs, returning the
+// changes which were made.
+//
+// The RRD is flushed and then recreated using itself as the Source, so rrdtool
+// preserves the existing data of matching data sources and RRAs.
+func (c *Client) MigrateContext(ctx context.Context, filename string, schema *Schema) ([]*SchemaChange, error) {
+	info, err := c.RRDInfoContext(ctx, filename)
+	if err != nil {
+		return nil, err
+	}
+
+	changes, err := schema.Diff(info)
+	if err != nil || len(changes) == 0 {
+		return nil, err
+	}
+
+	if err = c.FlushContext(ctx, filename); err != nil {
+		return nil, err
+	}
+
+	step := schema.Step
+	if step == 0 {
+		step = info.Step
+	}
+	options := []CreateOption{Start(info.LastUpdate), Source(filename), Step(step)}
+
+	if err = c.CreateContext(ctx, filename, migrateDS(schema.DS, info), schema.RRA, options...); err != nil {
+		return nil, err
+	}
+
+	return changes, nil
+}
+
+// migrateDS returns dss with the mappings of data sources which have already
+// been renamed in the RRD described by info removed, so their data is copied
+// by name rather than from a source which no longer exists.
+func migrateDS(dss []DS, info *RRDInfo) []DS {
+	res := make([]DS, len(dss))
+	for i, d := range dss {
+		res[i] = d
+		if def, err := ParseDS(d); err == nil && def.MappedName != "" && info.DSNamed(def.Name) != nil {
+			def.MappedName = ""
+			res[i] = def.DS()
+		}
+	}
+	return res
+}
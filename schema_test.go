@@ -0,0 +1,142 @@
+package rrd
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSchemaDiff(t *testing.T) {
+	info := &RRDInfo{
+		Step: time.Minute * 5,
+		DS: []*DSInfo{
+			{Name: "watts", Type: Gauge, Heartbeat: time.Minute * 5, Min: 0, Max: 24000},
+			{Name: "amps", Type: Gauge, Heartbeat: time.Minute * 5, Min: 0, Max: math.NaN()},
+			{Name: "volts", Type: Gauge, Heartbeat: time.Minute * 5, Min: math.NaN(), Max: math.NaN()},
+			{Name: "old", Type: Counter, Heartbeat: time.Minute * 10, Min: math.NaN(), Max: math.NaN()},
+		},
+		RRA: []*RRAInfo{
+			{CF: Average, PDPPerRow: 1, Rows: 100, XFF: 0.5},
+			{CF: Max, PDPPerRow: 12, Rows: 100, XFF: 0.5},
+			{CF: Min, PDPPerRow: 1, Rows: 100, XFF: 0.5},
+		},
+	}
+
+	s := &Schema{
+		DS: []DS{
+			NewGauge("watts", time.Minute*5, 0, 24000),
+			NewDS("DS:amps:GAUGE:600:0:U"),
+			NewDS("DS:new=old:COUNTER:600:U:U"),
+			NewDS("DS:hertz:GAUGE:300:U:U"),
+		},
+		RRA: []RRA{
+			NewAverage(0.5, 1, 200),
+			NewMax(0.25, 12, 100),
+			NewLast(0.5, 1, 100),
+		},
+	}
+
+	changes, err := s.Diff(info)
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	expected := []*SchemaChange{
+		{Type: DSChanged, Name: "amps", Field: "heartbeat", Old: time.Minute * 5, New: time.Minute * 10},
+		{Type: DSRenamed, Name: "new", Old: "old"},
+		{Type: DSAdded, Name: "hertz"},
+		{Type: DSRemoved, Name: "volts"},
+		{Type: RRAResized, Name: "AVERAGE:1", Old: 100, New: 200},
+		{Type: RRAChanged, Name: "MAX:12", Field: "xff", Old: 0.5, New: 0.25},
+		{Type: RRAAdded, Name: "LAST:1", New: 100},
+		{Type: RRARemoved, Name: "MIN:1", Old: 100},
+	}
+	assert.Equal(t, expected, changes)
+
+	assert.Equal(t, "ds changed amps: heartbeat 5m0s -> 10m0s", changes[0].String())
+	assert.Equal(t, "ds renamed: old -> new", changes[1].String())
+	assert.Equal(t, "ds added hertz", changes[2].String())
+	assert.Equal(t, "rra resized AVERAGE:1: 100 -> 200", changes[4].String())
+
+	s = &Schema{
+		Step: time.Minute,
+		DS:   []DS{NewGauge("watts", time.Minute*5, 0, 24000)},
+		RRA:  []RRA{NewAverage(0.5, 1, 100)},
+	}
+	changes, err = s.Diff(&RRDInfo{Step: time.Minute * 5, DS: info.DS[:1], RRA: info.RRA[:1]})
+	if assert.NoError(t, err) {
+		assert.Equal(t, []*SchemaChange{
+			{Type: StepChanged, Name: "step", Old: time.Minute * 5, New: time.Minute},
+		}, changes)
+	}
+
+	s.Step = 0
+	changes, err = s.Diff(&RRDInfo{Step: time.Minute * 5, DS: info.DS[:1], RRA: info.RRA[:1]})
+	if assert.NoError(t, err) {
+		assert.Empty(t, changes)
+	}
+
+	// Once renamed the mapping is no longer a change.
+	s.DS = []DS{NewDS("DS:new=old:COUNTER:600:U:U")}
+	renamed := &RRDInfo{
+		Step: time.Minute * 5,
+		DS:   []*DSInfo{{Name: "new", Type: Counter, Heartbeat: time.Minute * 10, Min: math.NaN(), Max: math.NaN()}},
+		RRA:  info.RRA[:1],
+	}
+	changes, err = s.Diff(renamed)
+	if assert.NoError(t, err) {
+		assert.Empty(t, changes)
+	}
+	assert.Equal(t, []DS{"DS:new:COUNTER:600:U:U"}, migrateDS(s.DS, renamed))
+	assert.Equal(t, s.DS, migrateDS(s.DS, info))
+}
+
+func TestSchemaDiffInvalid(t *testing.T) {
+	info := &RRDInfo{}
+	for _, s := range []*Schema{
+		{DS: []DS{NewDS("DS:watts:GAUGE")}},
+		{DS: []DS{NewDS("DS:watts:GAUGE:x:U:U")}},
+		{DS: []DS{NewDS("DS:watts:GAUGE:300:x:U")}},
+		{RRA: []RRA{NewRRA("RRA:AVERAGE:0.5:1")}},
+		{RRA: []RRA{NewRRA("RRA:BOGUS:0.5:1:1")}},
+		{RRA: []RRA{NewRRA("RRA:HWPREDICT:x:0.1:0.1:288")}},
+	} {
+		_, err := s.Diff(info)
+		assert.Error(t, err, "%v %v", s.DS, s.RRA)
+	}
+}
+
+func TestMigrate(t *testing.T) {
+	s := newServer(t)
+	if s == nil {
+		return
+	}
+	defer func() {
+		assert.NoError(t, s.Close())
+	}()
+
+	c, err := NewClient(s.Addr, Timeout(time.Second*2))
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer func() {
+		assert.NoError(t, c.Close())
+	}()
+
+	schema := &Schema{
+		DS:  []DS{NewDS("DS:watts:GAUGE:300:0:24000")},
+		RRA: []RRA{NewAverage(0.5, 1, 100)},
+	}
+	changes, err := c.Migrate("test.rrd", schema)
+	if assert.NoError(t, err) {
+		assert.Equal(t, []*SchemaChange{{Type: RRAAdded, Name: "AVERAGE:1", New: 100}}, changes)
+	}
+
+	schema.RRA = nil
+	changes, err = c.Migrate("test.rrd", schema)
+	if assert.NoError(t, err) {
+		assert.Empty(t, changes)
+	}
+}
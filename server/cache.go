@@ -0,0 +1,224 @@
+package server
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/multiplay/go-rrd"
+)
+
+// entry represents a cached file.
+type entry struct {
+	values []string
+	last   float64
+	queued time.Time
+}
+
+// cache caches updates in memory until they are written to the Store.
+type cache struct {
+	store Store
+	files map[string]*entry
+	stats rrd.Stats
+	mtx   sync.Mutex
+}
+
+// newCache returns a new cache which writes to store.
+func newCache(store Store) *cache {
+	return &cache{store: store, files: make(map[string]*entry)}
+}
+
+// parseStamp parses the timestamp of update value v, replacing N with now.
+// It returns the timestamp and v with the timestamp normalised.
+func parseStamp(v string, now time.Time) (float64, string, error) {
+	parts := strings.SplitN(v, ":", 2)
+	if len(parts) != 2 {
+		return 0, "", fmt.Errorf("invalid update value: %v", v)
+	}
+
+	if parts[0] == "N" {
+		ts := float64(now.UnixNano()) / float64(time.Second)
+		return ts, strconv.FormatFloat(ts, 'f', -1, 64) + ":" + parts[1], nil
+	}
+
+	ts, err := strconv.ParseFloat(parts[0], 64)
+	if err != nil || math.IsNaN(ts) || math.IsInf(ts, 0) {
+		return 0, "", fmt.Errorf("invalid timestamp: %v", parts[0])
+	}
+
+	return ts, v, nil
+}
+
+// update queues values for filename returning the number enqueued.
+func (c *cache) update(filename string, values []string) (int, error) {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+
+	e, ok := c.files[filename]
+	if !ok {
+		last, err := c.store.Last(filename)
+		if err != nil {
+			return 0, err
+		}
+		e = &entry{last: float64(last.Unix())}
+		c.files[filename] = e
+	}
+
+	now := time.Now()
+	for i, v := range values {
+		ts, v, err := parseStamp(v, now)
+		if err != nil {
+			return i, err
+		}
+
+		if ts <= e.last {
+			return i, fmt.Errorf("illegal attempt to update using time %f when last update time is %f (minimum one second step)", ts, e.last)
+		}
+
+		if len(e.values) == 0 {
+			e.queued = now
+		}
+		e.values = append(e.values, v)
+		e.last = ts
+		c.stats.UpdatesReceived++
+	}
+
+	return len(values), nil
+}
+
+// take removes and returns the pending values for filename.
+func (c *cache) take(filename string) []string {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+
+	e, ok := c.files[filename]
+	if !ok || len(e.values) == 0 {
+		return nil
+	}
+
+	values := e.values
+	e.values = nil
+	return values
+}
+
+// flush writes the pending values for filename to the store.
+// It returns false if there were no pending values.
+func (c *cache) flush(filename string) (bool, error) {
+	values := c.take(filename)
+	if len(values) == 0 {
+		return false, nil
+	}
+
+	err := c.store.Update(filename, values)
+
+	c.mtx.Lock()
+	c.stats.UpdatesWritten++
+	c.stats.DataSetsWritten += int64(len(values))
+	c.mtx.Unlock()
+
+	return true, err
+}
+
+// older returns the files with values queued at or before t.
+func (c *cache) older(t time.Time) []string {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+
+	var files []string
+	for f, e := range c.files {
+		if len(e.values) > 0 && !e.queued.After(t) {
+			files = append(files, f)
+		}
+	}
+	sort.Strings(files)
+
+	return files
+}
+
+// flushOlder writes the pending values of all files queued at or before t,
+// returning the first error encountered if any.
+func (c *cache) flushOlder(t time.Time) error {
+	var err error
+	for _, f := range c.older(t) {
+		if _, err2 := c.flush(f); err2 != nil && err == nil {
+			err = err2
+		}
+	}
+
+	return err
+}
+
+// pending returns the pending values for filename.
+func (c *cache) pending(filename string) ([]string, bool) {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+
+	e, ok := c.files[filename]
+	if !ok {
+		return nil, false
+	}
+
+	return append([]string(nil), e.values...), true
+}
+
+// forget removes filename from the cache, discarding any pending values.
+func (c *cache) forget(filename string) bool {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+
+	_, ok := c.files[filename]
+	delete(c.files, filename)
+	return ok
+}
+
+// queue returns the files with pending values, oldest first.
+func (c *cache) queue() []*rrd.Queue {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+
+	var q []*rrd.Queue
+	for f, e := range c.files {
+		if len(e.values) > 0 {
+			q = append(q, &rrd.Queue{Size: int64(len(e.values)), File: f})
+		}
+	}
+	sort.Slice(q, func(i, j int) bool {
+		ei, ej := c.files[q[i].File], c.files[q[j].File]
+		if ei.queued.Equal(ej.queued) {
+			return q[i].File < q[j].File
+		}
+		return ei.queued.Before(ej.queued)
+	})
+
+	return q
+}
+
+// flushReceived records the receipt of a flush request.
+func (c *cache) flushReceived() {
+	c.mtx.Lock()
+	c.stats.FlushesReceived++
+	c.mtx.Unlock()
+}
+
+// statistics returns the current cache statistics.
+func (c *cache) statistics() *rrd.Stats {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+
+	s := c.stats
+	s.TreeNodesNumber = int64(len(c.files))
+	for _, e := range c.files {
+		if len(e.values) > 0 {
+			s.QueueLength++
+		}
+	}
+	for n := s.TreeNodesNumber; n > 0; n >>= 1 {
+		s.TreeDepth++
+	}
+
+	return &s
+}
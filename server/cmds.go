@@ -0,0 +1,563 @@
+package server
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/multiplay/go-rrd"
+)
+
+const (
+	cmdQuit  = "quit"
+	cmdBatch = "batch"
+)
+
+// response represents a response to a command.
+type response struct {
+	status int
+	msg    string
+	lines  []string
+}
+
+// ok returns a successful response with msg and lines.
+func ok(msg string, lines ...string) *response {
+	return &response{status: len(lines), msg: msg, lines: lines}
+}
+
+// errorf returns an error response with the formatted message.
+func errorf(format string, args ...interface{}) *response {
+	return &response{status: -1, msg: fmt.Sprintf(format, args...)}
+}
+
+// fileError returns the rrdcached compatible response for err which occurred processing filename.
+func fileError(filename string, err error) *response {
+	switch err {
+	case ErrNotExist:
+		return errorf("No such file: %v", filename)
+	case ErrExist:
+		return errorf("RRD Error: creating '%v': File exists", filename)
+	}
+
+	return errorf("%v", err)
+}
+
+// write writes the response to w.
+func (r *response) write(w io.Writer) error {
+	if _, err := fmt.Fprintf(w, "%v %v\n", r.status, r.msg); err != nil {
+		return err
+	}
+
+	for _, l := range r.lines {
+		if _, err := io.WriteString(w, l+"\n"); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// batch represents the state of a batch of commands.
+type batch struct {
+	cmds   int
+	errors []string
+}
+
+// exec executes the batched command args recording any error.
+func (b *batch) exec(s *Server, args []string) {
+	b.cmds++
+	cmd := strings.ToLower(args[0])
+	var r *response
+	if h, ok := handlers[cmd]; !ok {
+		r = errorf("Unknown command: %v", args[0])
+	} else if !batchCmds[cmd] {
+		r = errorf("Can't use '%v' here.", args[0])
+	} else {
+		r = h(s, args[1:])
+	}
+
+	if r.status < 0 {
+		b.errors = append(b.errors, fmt.Sprintf("%v %v", b.cmds, r.msg))
+	}
+}
+
+// response returns the response to the completed batch.
+func (b *batch) response() *response {
+	return ok("errors", b.errors...)
+}
+
+// handler processes a command with args returning the response.
+type handler func(s *Server, args []string) *response
+
+var (
+	handlers map[string]handler
+
+	// batchCmds are the commands permitted in a batch.
+	batchCmds = map[string]bool{
+		"update": true,
+		"flush":  true,
+		"forget": true,
+		"create": true,
+	}
+
+	// usages are the usages of the commands.
+	usages = map[string]string{
+		"batch":    "BATCH",
+		"create":   "CREATE <filename> [-b start] [-s step] [-O] [-r source] [-t template] <DS definitions> <RRA definitions>",
+		"fetch":    "FETCH <file> <CF> [<start> [<end>] [<column>...]]",
+		"fetchbin": "FETCHBIN <file> <CF> [<start> [<end>] [<column>...]]",
+		"first":    "FIRST <filename> <rra index>",
+		"flush":    "FLUSH <filename>",
+		"flushall": "FLUSHALL",
+		"forget":   "FORGET <filename>",
+		"help":     "HELP [<command>]",
+		"info":     "INFO <filename>",
+		"last":     "LAST <filename>",
+		"pending":  "PENDING <filename>",
+		"ping":     "PING",
+		"queue":    "QUEUE",
+		"quit":     "QUIT",
+		"stats":    "STATS",
+		"update":   "UPDATE <filename> <values> [<values> ...]",
+		"wrote":    "WROTE <filename>",
+	}
+
+	// descriptions are the descriptions of the commands.
+	descriptions = map[string]string{
+		"batch":    "Adds multiple commands in one go, ending with a dot '.' on its own line.",
+		"create":   "Creates a new RRD.",
+		"fetch":    "Returns the consolidated data for the given file.",
+		"fetchbin": "Returns the consolidated data for the given file in binary form.",
+		"first":    "Returns the timestamp of the first CDP of the given RRA.",
+		"flush":    "Writes all pending updates for the given file to disk.",
+		"flushall": "Writes all pending updates to disk.",
+		"forget":   "Removes the file from the cache, any pending updates WILL BE LOST.",
+		"help":     "Shows help for the given command or a command overview.",
+		"info":     "Returns the configuration information of the given file.",
+		"last":     "Returns the timestamp of the last update to the given file.",
+		"pending":  "Shows any pending updates for the given file, in order.",
+		"ping":     "Returns PONG.",
+		"queue":    "Shows the files which have pending updates.",
+		"quit":     "Disconnect from rrdcached.",
+		"stats":    "Returns statistics about the daemon.",
+		"update":   "Adds the given values to the cache for the given file.",
+		"wrote":    "Used internally by the journal.",
+	}
+)
+
+func init() {
+	handlers = map[string]handler{
+		"batch":    handleBatch,
+		"create":   handleCreate,
+		"fetch":    handleFetch,
+		"fetchbin": handleFetchBin,
+		"first":    handleFirst,
+		"flush":    handleFlush,
+		"flushall": handleFlushAll,
+		"forget":   handleForget,
+		"help":     handleHelp,
+		"info":     handleInfo,
+		"last":     handleLast,
+		"pending":  handlePending,
+		"ping":     handlePing,
+		"queue":    handleQueue,
+		"stats":    handleStats,
+		"update":   handleUpdate,
+		"wrote":    handleWrote,
+	}
+}
+
+// usage returns the usage error response for cmd.
+func usage(cmd string) *response {
+	return errorf("Usage: %v", usages[cmd])
+}
+
+func handlePing(s *Server, args []string) *response {
+	return ok("PONG")
+}
+
+func handleBatch(s *Server, args []string) *response {
+	return ok("Go ahead.  End with dot '.' on its own line.")
+}
+
+func handleWrote(s *Server, args []string) *response {
+	return errorf("Can't use 'wrote' here.")
+}
+
+func handleHelp(s *Server, args []string) *response {
+	switch len(args) {
+	case 0:
+		cmds := make([]string, 0, len(usages))
+		for _, u := range usages {
+			cmds = append(cmds, u)
+		}
+		sort.Strings(cmds)
+		return ok("Command overview", cmds...)
+	case 1:
+		cmd := strings.ToLower(args[0])
+		u, ok2 := usages[cmd]
+		if !ok2 {
+			return errorf("Unknown command: %v", args[0])
+		}
+		return ok("Help for "+strings.ToUpper(cmd), "Usage: "+u, "", descriptions[cmd], "")
+	default:
+		return usage("help")
+	}
+}
+
+func handleUpdate(s *Server, args []string) *response {
+	if len(args) < 2 {
+		return usage("update")
+	}
+
+	n, err := s.cache.update(args[0], args[1:])
+	if err != nil {
+		return fileError(args[0], err)
+	}
+
+	return ok(fmt.Sprintf("errors, enqueued %v value(s).", n))
+}
+
+func handleFlush(s *Server, args []string) *response {
+	if len(args) != 1 {
+		return usage("flush")
+	}
+
+	s.cache.flushReceived()
+	flushed, err := s.cache.flush(args[0])
+	switch {
+	case err != nil:
+		return fileError(args[0], err)
+	case flushed:
+		return ok(fmt.Sprintf("Successfully flushed %v.", args[0]))
+	default:
+		return ok(fmt.Sprintf("Nothing to flush: %v.", args[0]))
+	}
+}
+
+func handleFlushAll(s *Server, args []string) *response {
+	if len(args) != 0 {
+		return usage("flushall")
+	}
+
+	s.cache.flushReceived()
+	if err := s.cache.flushOlder(time.Now()); err != nil {
+		return errorf("%v", err)
+	}
+
+	return ok("Started flush.")
+}
+
+func handlePending(s *Server, args []string) *response {
+	if len(args) != 1 {
+		return usage("pending")
+	}
+
+	values, found := s.cache.pending(args[0])
+	if !found {
+		return errorf("No such file or directory")
+	}
+
+	return ok("updates pending", values...)
+}
+
+func handleForget(s *Server, args []string) *response {
+	if len(args) != 1 {
+		return usage("forget")
+	}
+
+	if !s.cache.forget(args[0]) {
+		return errorf("No such file or directory")
+	}
+
+	return ok("Gone!")
+}
+
+func handleQueue(s *Server, args []string) *response {
+	q := s.cache.queue()
+	lines := make([]string, len(q))
+	for i, v := range q {
+		lines[i] = fmt.Sprintf("%v %v", v.Size, v.File)
+	}
+
+	return ok("in queue.", lines...)
+}
+
+func handleStats(s *Server, args []string) *response {
+	st := s.cache.statistics()
+	return ok("Statistics follow",
+		fmt.Sprintf("QueueLength: %v", st.QueueLength),
+		fmt.Sprintf("UpdatesReceived: %v", st.UpdatesReceived),
+		fmt.Sprintf("FlushesReceived: %v", st.FlushesReceived),
+		fmt.Sprintf("UpdatesWritten: %v", st.UpdatesWritten),
+		fmt.Sprintf("DataSetsWritten: %v", st.DataSetsWritten),
+		fmt.Sprintf("TreeNodesNumber: %v", st.TreeNodesNumber),
+		fmt.Sprintf("TreeDepth: %v", st.TreeDepth),
+		fmt.Sprintf("JournalBytes: %v", st.JournalBytes),
+		fmt.Sprintf("JournalRotate: %v", st.JournalRotate),
+	)
+}
+
+// flushed writes any pending values for filename, so the store is up to date.
+func (s *Server) flushed(filename string) *response {
+	if _, err := s.cache.flush(filename); err != nil {
+		return fileError(filename, err)
+	}
+
+	return nil
+}
+
+func handleFirst(s *Server, args []string) *response {
+	if len(args) < 1 || len(args) > 2 {
+		return usage("first")
+	}
+
+	var idx int
+	if len(args) == 2 {
+		var err error
+		if idx, err = strconv.Atoi(args[1]); err != nil || idx < 0 {
+			return errorf("Invalid RRA index: %v", args[1])
+		}
+	}
+
+	if r := s.flushed(args[0]); r != nil {
+		return r
+	}
+
+	t, err := s.store.First(args[0], idx)
+	if err != nil {
+		return fileError(args[0], err)
+	}
+
+	return ok(strconv.FormatInt(t.Unix(), 10))
+}
+
+func handleLast(s *Server, args []string) *response {
+	if len(args) != 1 {
+		return usage("last")
+	}
+
+	if r := s.flushed(args[0]); r != nil {
+		return r
+	}
+
+	t, err := s.store.Last(args[0])
+	if err != nil {
+		return fileError(args[0], err)
+	}
+
+	return ok(strconv.FormatInt(t.Unix(), 10))
+}
+
+func handleInfo(s *Server, args []string) *response {
+	if len(args) != 1 {
+		return usage("info")
+	}
+
+	if r := s.flushed(args[0]); r != nil {
+		return r
+	}
+
+	info, err := s.store.Info(args[0])
+	if err != nil {
+		return fileError(args[0], err)
+	}
+
+	lines := make([]string, len(info))
+	for i, v := range info {
+		switch val := v.Value.(type) {
+		case int64:
+			lines[i] = fmt.Sprintf("%v 1 %v", v.Key, val)
+		case float64:
+			lines[i] = fmt.Sprintf("%v 0 %v", v.Key, formatFloat(val, 10))
+		default:
+			lines[i] = fmt.Sprintf("%v 2 %v", v.Key, val)
+		}
+	}
+
+	return ok(fmt.Sprintf("Info for %v follows", args[0]), lines...)
+}
+
+// formatFloat formats f in exponent format with prec digits after the decimal point.
+func formatFloat(f float64, prec int) string {
+	switch {
+	case math.IsNaN(f):
+		return "nan"
+	case math.IsInf(f, 1):
+		return "inf"
+	case math.IsInf(f, -1):
+		return "-inf"
+	}
+
+	return strconv.FormatFloat(f, 'e', prec, 64)
+}
+
+// parseCreate parses the arguments of a create command.
+func parseCreate(args []string) (*CreateRequest, error) {
+	req := &CreateRequest{}
+	for i := 0; i < len(args); i++ {
+		a := args[i]
+		switch {
+		case a == "-O":
+			req.NoOverwrite = true
+			continue
+		case strings.HasPrefix(a, "DS:"):
+			req.DS = append(req.DS, rrd.NewDS(a))
+			continue
+		case strings.HasPrefix(a, "RRA:"):
+			req.RRA = append(req.RRA, rrd.NewRRA(a))
+			continue
+		case len(a) != 2 || a[0] != '-' || i+1 == len(args):
+			return nil, fmt.Errorf("invalid argument: %v", a)
+		}
+
+		i++
+		v := args[i]
+		switch a {
+		case "-b":
+			t, err := parseTime(v, map[string]time.Time{"now": time.Now()})
+			if err != nil {
+				return nil, err
+			}
+			req.Start = t
+		case "-s":
+			n, err := strconv.Atoi(v)
+			if err != nil || n <= 0 {
+				return nil, fmt.Errorf("invalid step: %v", v)
+			}
+			req.Step = time.Duration(n) * time.Second
+		case "-r":
+			req.Sources = append(req.Sources, v)
+		case "-t":
+			req.Template = v
+		default:
+			return nil, fmt.Errorf("invalid argument: %v", a)
+		}
+	}
+
+	return req, nil
+}
+
+func handleCreate(s *Server, args []string) *response {
+	if len(args) < 1 {
+		return usage("create")
+	}
+
+	req, err := parseCreate(args[1:])
+	if err != nil {
+		return errorf("%v", err)
+	}
+
+	if err := s.store.Create(args[0], req); err != nil {
+		return fileError(args[0], err)
+	}
+
+	// Any cached state is now stale.
+	s.cache.forget(args[0])
+
+	return ok("RRD created OK")
+}
+
+// fetch performs the common processing of fetch and fetchbin.
+func (s *Server) fetch(cmd string, args []string) (*rrd.Fetch, *response) {
+	if len(args) < 2 {
+		return nil, usage(cmd)
+	}
+
+	now := time.Now()
+	req := &FetchRequest{CF: strings.ToUpper(args[1]), End: now, Start: now.Add(-time.Hour * 24)}
+	var err error
+	if len(args) > 3 {
+		if req.End, err = parseTime(args[3], map[string]time.Time{"now": now}); err != nil {
+			return nil, errorf("%v", err)
+		}
+	}
+	if len(args) > 2 {
+		bases := map[string]time.Time{"now": now, "end": req.End}
+		if req.Start, err = parseTime(args[2], bases); err != nil {
+			return nil, errorf("%v", err)
+		}
+	}
+	if !req.Start.Before(req.End) {
+		return nil, errorf("start (%v) should be less than end (%v)", req.Start.Unix(), req.End.Unix())
+	}
+	if len(args) > 4 {
+		req.Names = args[4:]
+	}
+
+	if r := s.flushed(args[0]); r != nil {
+		return nil, r
+	}
+
+	f, err := s.store.Fetch(args[0], req)
+	if err != nil {
+		return nil, fileError(args[0], err)
+	}
+
+	return f, nil
+}
+
+// fetchHeader returns the header lines common to fetch and fetchbin.
+func fetchHeader(f *rrd.Fetch) []string {
+	return []string{
+		fmt.Sprintf("FlushVersion: %v", f.FlushVersion),
+		fmt.Sprintf("Start: %v", f.Start.Unix()),
+		fmt.Sprintf("End: %v", f.End.Unix()),
+		fmt.Sprintf("Step: %v", int64(f.Step/time.Second)),
+		fmt.Sprintf("DSCount: %v", f.Count),
+	}
+}
+
+func handleFetch(s *Server, args []string) *response {
+	f, r := s.fetch("fetch", args)
+	if r != nil {
+		return r
+	}
+
+	lines := append(fetchHeader(f), "DSName: "+strings.Join(f.Names, " "))
+	vals := make([]string, len(f.Names))
+	for _, row := range f.Rows {
+		for i, v := range row.Data {
+			if v == nil {
+				vals[i] = "nan"
+			} else {
+				vals[i] = formatFloat(*v, 17)
+			}
+		}
+		lines = append(lines, fmt.Sprintf("%v: %v", row.Time.Unix(), strings.Join(vals, " ")))
+	}
+
+	return ok("Success", lines...)
+}
+
+func handleFetchBin(s *Server, args []string) *response {
+	f, r := s.fetch("fetchbin", args)
+	if r != nil {
+		return r
+	}
+
+	lines := fetchHeader(f)
+	status := len(lines) + len(f.Names)
+	var buf bytes.Buffer
+	for i, name := range f.Names {
+		lines = append(lines, fmt.Sprintf("DSName-%v: BinaryData %v 8 LITTLE", name, len(f.Rows)))
+		buf.Reset()
+		for _, row := range f.Rows {
+			v := math.NaN()
+			if row.Data[i] != nil {
+				v = *row.Data[i]
+			}
+			binary.Write(&buf, binary.LittleEndian, v) // nolint: errcheck
+		}
+		lines = append(lines, buf.String())
+	}
+
+	// The status only counts the text lines, as rrdcached does.
+	return &response{status: status, msg: "Success", lines: lines}
+}
@@ -0,0 +1,13 @@
+package server
+
+import (
+	"errors"
+)
+
+var (
+	// ErrNilOption is returned by New if an option is nil.
+	ErrNilOption = errors.New("nil option")
+
+	// ErrServerClosed is returned by Serve and Close after Close has been called.
+	ErrServerClosed = errors.New("server closed")
+)
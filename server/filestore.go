@@ -0,0 +1,211 @@
+package server
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/multiplay/go-rrd"
+	"github.com/multiplay/go-rrd/internal/ingest"
+	"github.com/multiplay/go-rrd/rrdfile"
+)
+
+// FileStore is a Store which keeps RRDs as rrdtool compatible files in a base
+// directory, read and written using the rrdfile package.
+//
+// Filenames, including those of templates and sources, are relative to the
+// base directory and may not refer to files outside of it. The limitations of
+// the rrdfile package apply, so COMPUTE data sources and Holt-Winters RRAs are
+// not supported.
+type FileStore struct {
+	dir string
+	mtx sync.RWMutex
+}
+
+// NewFileStore returns a new FileStore which keeps RRDs in the directory dir.
+func NewFileStore(dir string) *FileStore {
+	return &FileStore{dir: dir}
+}
+
+// path returns the path of filename within the base directory.
+func (s *FileStore) path(filename string) (string, error) {
+	if !ingest.ValidFilename(filename) {
+		return "", fmt.Errorf("invalid filename %q", filename)
+	}
+	return filepath.Join(s.dir, filepath.FromSlash(filename)), nil
+}
+
+// fileErr returns the Store error for err returned accessing a file.
+func fileErr(err error) error {
+	switch {
+	case os.IsNotExist(err):
+		return ErrNotExist
+	case os.IsExist(err):
+		return ErrExist
+	}
+	return err
+}
+
+// open reads the RRD filename.
+func (s *FileStore) open(filename string) (*rrdfile.File, error) {
+	p, err := s.path(filename)
+	if err != nil {
+		return nil, err
+	}
+
+	f, err := rrdfile.Open(p)
+	if err != nil {
+		return nil, fileErr(err)
+	}
+
+	return f, nil
+}
+
+// Create implements Store.
+func (s *FileStore) Create(filename string, req *CreateRequest) error {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+
+	p, err := s.path(filename)
+	if err != nil {
+		return err
+	}
+
+	var options []rrd.CreateOption
+	if req.Step != 0 {
+		options = append(options, rrd.Step(req.Step))
+	}
+	if !req.Start.IsZero() {
+		options = append(options, rrd.Start(req.Start))
+	}
+	if req.NoOverwrite {
+		options = append(options, rrd.NoOverwrite())
+	}
+	if req.Template != "" {
+		t, err := s.path(req.Template)
+		if err != nil {
+			return err
+		}
+		if _, err := os.Stat(t); err != nil {
+			return fmt.Errorf("template %v: %v", req.Template, fileErr(err))
+		}
+		options = append(options, rrd.Template(t))
+	}
+	for _, f := range req.Sources {
+		src, err := s.path(f)
+		if err != nil {
+			return err
+		}
+		if _, err := os.Stat(src); err != nil {
+			return fmt.Errorf("source %v: %v", f, fileErr(err))
+		}
+		options = append(options, rrd.Source(src))
+	}
+
+	if err := os.MkdirAll(filepath.Dir(p), 0755); err != nil {
+		return err
+	}
+
+	return fileErr(rrdfile.CreateFile(p, req.DS, req.RRA, options...))
+}
+
+// Update implements Store.
+func (s *FileStore) Update(filename string, values []string) error {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+
+	p, err := s.path(filename)
+	if err != nil {
+		return err
+	}
+
+	updates := make([]rrd.Update, len(values))
+	for i, v := range values {
+		updates[i] = rrd.Update(v)
+	}
+
+	return fileErr(rrdfile.UpdateFile(p, updates...))
+}
+
+// Fetch implements Store.
+func (s *FileStore) Fetch(filename string, req *FetchRequest) (*rrd.Fetch, error) {
+	s.mtx.RLock()
+	defer s.mtx.RUnlock()
+
+	f, err := s.open(filename)
+	if err != nil {
+		return nil, err
+	}
+
+	r, err := f.Fetch(req.CF, req.Start, req.End)
+	if err != nil || len(req.Names) == 0 {
+		return r, err
+	}
+
+	idx := make([]int, len(req.Names))
+	for i, n := range req.Names {
+		idx[i] = -1
+		for j, name := range r.Names {
+			if name == n {
+				idx[i] = j
+				break
+			}
+		}
+		if idx[i] == -1 {
+			return nil, fmt.Errorf("No such DS: %v", n)
+		}
+	}
+
+	for i, row := range r.Rows {
+		data := make([]*float64, len(idx))
+		for j, k := range idx {
+			data[j] = row.Data[k]
+		}
+		r.Rows[i].Data = data
+	}
+	r.Names = req.Names
+	r.Count = len(idx)
+
+	return r, nil
+}
+
+// Info implements Store.
+func (s *FileStore) Info(filename string) ([]*rrd.Info, error) {
+	s.mtx.RLock()
+	defer s.mtx.RUnlock()
+
+	f, err := s.open(filename)
+	if err != nil {
+		return nil, err
+	}
+
+	return append([]*rrd.Info{{Key: "filename", Value: filename}}, f.Info()...), nil
+}
+
+// First implements Store.
+func (s *FileStore) First(filename string, rra int) (time.Time, error) {
+	s.mtx.RLock()
+	defer s.mtx.RUnlock()
+
+	f, err := s.open(filename)
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	return f.First(rra)
+}
+
+// Last implements Store.
+func (s *FileStore) Last(filename string) (time.Time, error) {
+	s.mtx.RLock()
+	defer s.mtx.RUnlock()
+
+	f, err := s.open(filename)
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	return f.Last(), nil
+}
@@ -0,0 +1,152 @@
+package server
+
+import (
+	"context"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/multiplay/go-rrd"
+	"github.com/multiplay/go-rrd/rrdfile"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFileStore(t *testing.T) {
+	dir, err := ioutil.TempDir("", "go-rrd")
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer os.RemoveAll(dir) // nolint: errcheck
+
+	s := NewFileStore(dir)
+	if !assert.NoError(t, s.Create(testFile, newTestRequest())) {
+		return
+	}
+
+	req := newTestRequest()
+	req.NoOverwrite = true
+	assert.Equal(t, ErrExist, s.Create(testFile, req))
+
+	for i := 1; i <= 6; i++ {
+		v := testStart.Add(time.Second * time.Duration(i*10)).Unix()
+		assert.NoError(t, s.Update(testFile, []string{string(rrd.NewUpdate(time.Unix(v, 0), i*10))}))
+	}
+
+	last, err := s.Last(testFile)
+	if assert.NoError(t, err) {
+		assert.Equal(t, testStart.Add(time.Minute).Unix(), last.Unix())
+	}
+
+	// Updates must be strictly increasing in time.
+	assert.Error(t, s.Update(testFile, []string{string(rrd.NewUpdate(last, 1))}))
+
+	f, err := s.Fetch(testFile, &FetchRequest{CF: rrd.Average, Start: testStart, End: last, Names: []string{"val"}})
+	if assert.NoError(t, err) {
+		assert.Equal(t, []string{"val"}, f.Names)
+		assert.Equal(t, time.Second*10, f.Step)
+		if assert.NotEmpty(t, f.Rows) {
+			r := f.Rows[len(f.Rows)-1]
+			assert.Equal(t, last.Unix(), r.Time.Unix())
+			if assert.Len(t, r.Data, 1) && assert.NotNil(t, r.Data[0]) {
+				assert.Equal(t, float64(60), *r.Data[0])
+			}
+		}
+	}
+
+	_, err = s.Fetch(testFile, &FetchRequest{CF: rrd.Average, Start: testStart, End: last, Names: []string{"bogus"}})
+	assert.Error(t, err)
+
+	info, err := s.Info(testFile)
+	if assert.NoError(t, err) {
+		assert.Equal(t, &rrd.Info{Key: "filename", Value: testFile}, info[0])
+	}
+
+	first, err := s.First(testFile, 0)
+	if assert.NoError(t, err) {
+		assert.True(t, first.Before(last))
+	}
+
+	// Sources are read from the base directory.
+	req = newTestRequest()
+	req.Start = last
+	req.Sources = []string{testFile}
+	assert.NoError(t, s.Create("sub/copy.rrd", req))
+	f, err = s.Fetch("sub/copy.rrd", &FetchRequest{CF: rrd.Average, Start: testStart, End: last})
+	if assert.NoError(t, err) && assert.NotEmpty(t, f.Rows) {
+		r := f.Rows[len(f.Rows)-1]
+		if assert.Len(t, r.Data, 1) && assert.NotNil(t, r.Data[0]) {
+			assert.Equal(t, float64(60), *r.Data[0])
+		}
+	}
+
+	req.Sources = []string{"missing.rrd"}
+	assert.Error(t, s.Create("other.rrd", req))
+
+	_, err = s.Last("missing.rrd")
+	assert.Equal(t, ErrNotExist, err)
+	assert.Equal(t, ErrNotExist, s.Update("missing.rrd", []string{"N:1"}))
+
+	// Files outside the base directory can't be accessed.
+	assert.Error(t, s.Create("../escape.rrd", newTestRequest()))
+	_, err = s.Info("/etc/passwd")
+	assert.Error(t, err)
+}
+
+func TestFileStorePending(t *testing.T) {
+	dir, err := ioutil.TempDir("", "go-rrd")
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer os.RemoveAll(dir) // nolint: errcheck
+
+	s, err := New(NewFileStore(dir))
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer func() {
+		assert.NoError(t, s.Close())
+	}()
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if !assert.NoError(t, err) {
+		return
+	}
+	go s.Serve(l) // nolint: errcheck
+
+	c, err := rrd.NewClient(l.Addr().String(), rrd.Timeout(time.Second*2))
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer func() {
+		assert.NoError(t, c.Close())
+	}()
+
+	req := newTestRequest()
+	if !assert.NoError(t, c.Create(testFile, req.DS, req.RRA, rrd.Step(req.Step), rrd.Start(testStart))) {
+		return
+	}
+
+	// The updates are cached by the server, not yet written to the file.
+	last := testStart.Add(time.Second * 30)
+	err = c.Update(testFile,
+		rrd.NewUpdate(testStart.Add(time.Second*10), 10),
+		rrd.NewUpdate(testStart.Add(time.Second*20), 20),
+		rrd.NewUpdate(last, 30),
+	)
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	f, err := rrdfile.FetchWithPending(context.Background(), c, testFile, filepath.Join(dir, testFile), rrd.Average, testStart, last)
+	if assert.NoError(t, err) && assert.NotEmpty(t, f.Rows) {
+		r := f.Rows[len(f.Rows)-1]
+		assert.Equal(t, last.Unix(), r.Time.Unix())
+		assert.True(t, r.Estimated)
+		if assert.NotNil(t, r.Data[0]) {
+			assert.Equal(t, float64(30), *r.Data[0])
+		}
+	}
+}
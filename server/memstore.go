@@ -0,0 +1,552 @@
+package server
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/multiplay/go-rrd"
+)
+
+var (
+	// DefaultStep is the default step of RRDs created without a step.
+	DefaultStep = time.Second * 300
+)
+
+// memDS represents a data source of an in-memory RRD.
+type memDS struct {
+	name      string
+	dst       string
+	heartbeat float64
+	min       float64
+	max       float64
+	lastDS    string
+	prev      float64
+}
+
+// memRRA represents a round robin archive of an in-memory RRD.
+type memRRA struct {
+	cf    string
+	xff   float64
+	steps int
+	rows  int
+}
+
+// memSample represents the rates of all data sources for the interval (from, t].
+type memSample struct {
+	from float64
+	t    float64
+	v    []float64
+}
+
+// memRRD represents an in-memory RRD.
+type memRRD struct {
+	step    float64
+	last    float64
+	ds      []*memDS
+	rra     []*memRRA
+	samples []memSample
+}
+
+// MemStore is an in-memory Store.
+//
+// It retains the rates of each update for the period covered by the longest
+// RRA and consolidates them when fetched, supporting the AVERAGE, MIN, MAX and
+// LAST consolidation functions. COMPUTE data sources always have unknown values.
+// All data is lost when the process exits.
+type MemStore struct {
+	files map[string]*memRRD
+	mtx   sync.RWMutex
+}
+
+// NewMemStore returns a new empty MemStore.
+func NewMemStore() *MemStore {
+	return &MemStore{files: make(map[string]*memRRD)}
+}
+
+// parseMemDS parses the DS definition d.
+func parseMemDS(d rrd.DS) (*memDS, error) {
+	def, err := rrd.ParseDS(d)
+	if err != nil {
+		return nil, err
+	}
+
+	ds := &memDS{name: def.Name, dst: def.Type, lastDS: "U", prev: math.NaN()}
+	if def.Type == rrd.Compute {
+		return ds, nil
+	}
+
+	if def.Heartbeat < time.Second {
+		return nil, fmt.Errorf("invalid DS heartbeat: %v", d)
+	}
+	ds.heartbeat = def.Heartbeat.Seconds()
+	ds.min, ds.max = def.Min, def.Max
+
+	return ds, nil
+}
+
+// parseMemRRA parses the RRA definition r.
+func parseMemRRA(r rrd.RRA) (*memRRA, error) {
+	def, err := rrd.ParseRRA(r)
+	if err != nil {
+		return nil, err
+	}
+
+	switch def.CF {
+	case rrd.Average, rrd.Min, rrd.Max, rrd.Last:
+	default:
+		return nil, fmt.Errorf("unsupported RRA consolidation function %v: %v", def.CF, r)
+	}
+
+	switch {
+	case def.XFF < 0 || def.XFF >= 1:
+		return nil, fmt.Errorf("invalid RRA xff: %v", r)
+	case def.Steps <= 0:
+		return nil, fmt.Errorf("invalid RRA steps: %v", r)
+	case def.Rows <= 0:
+		return nil, fmt.Errorf("invalid RRA rows: %v", r)
+	}
+
+	return &memRRA{cf: def.CF, xff: def.XFF, steps: def.Steps, rows: def.Rows}, nil
+}
+
+// newMemRRD returns a new in-memory RRD as defined by req, using tmpl as a template if non-nil.
+func newMemRRD(req *CreateRequest, tmpl *memRRD) (*memRRD, error) {
+	m := &memRRD{step: DefaultStep.Seconds()}
+	if tmpl != nil {
+		m.step = tmpl.step
+		for _, d := range tmpl.ds {
+			ds := *d
+			ds.lastDS, ds.prev = "U", math.NaN()
+			m.ds = append(m.ds, &ds)
+		}
+		m.rra = tmpl.rra
+	}
+
+	if req.Step > 0 {
+		m.step = req.Step.Seconds()
+	}
+
+	for _, d := range req.DS {
+		ds, err := parseMemDS(d)
+		if err != nil {
+			return nil, err
+		}
+		if i := m.index(ds.name); i != -1 {
+			m.ds[i] = ds
+		} else {
+			m.ds = append(m.ds, ds)
+		}
+	}
+
+	if len(req.RRA) > 0 {
+		m.rra = nil
+		for _, r := range req.RRA {
+			rra, err := parseMemRRA(r)
+			if err != nil {
+				return nil, err
+			}
+			m.rra = append(m.rra, rra)
+		}
+	}
+
+	switch {
+	case len(m.ds) == 0:
+		return nil, fmt.Errorf("you must define at least one Data Source")
+	case len(m.rra) == 0:
+		return nil, fmt.Errorf("you must define at least one Round Robin Archive")
+	}
+
+	start := req.Start
+	if start.IsZero() {
+		start = time.Now().Add(-time.Second * 10)
+	}
+	m.last = float64(start.Unix())
+
+	return m, nil
+}
+
+// index returns the index of the DS name or -1 if not found.
+func (m *memRRD) index(name string) int {
+	for i, ds := range m.ds {
+		if ds.name == name {
+			return i
+		}
+	}
+	return -1
+}
+
+// retention returns the number of seconds covered by the longest RRA.
+func (m *memRRD) retention() float64 {
+	var r float64
+	for _, rra := range m.rra {
+		if v := float64(rra.steps*rra.rows) * m.step; v > r {
+			r = v
+		}
+	}
+	return r
+}
+
+// prefill copies the samples of the data sources of src with matching names.
+func (m *memRRD) prefill(src *memRRD) {
+	idx := make([]int, len(m.ds))
+	for i, ds := range m.ds {
+		idx[i] = src.index(ds.name)
+	}
+
+	for _, s := range src.samples {
+		v := make([]float64, len(m.ds))
+		for i, j := range idx {
+			v[i] = math.NaN()
+			if j != -1 {
+				v[i] = s.v[j]
+			}
+		}
+		m.samples = append(m.samples, memSample{from: s.from, t: s.t, v: v})
+	}
+
+	if src.last > m.last {
+		m.last = src.last
+	}
+}
+
+// Create implements Store.
+func (s *MemStore) Create(filename string, req *CreateRequest) error {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+
+	if _, ok := s.files[filename]; ok && req.NoOverwrite {
+		return ErrExist
+	}
+
+	var tmpl *memRRD
+	if req.Template != "" {
+		if tmpl = s.files[req.Template]; tmpl == nil {
+			return fmt.Errorf("template %v: %v", req.Template, ErrNotExist)
+		}
+	}
+
+	m, err := newMemRRD(req, tmpl)
+	if err != nil {
+		return err
+	}
+
+	for _, f := range req.Sources {
+		src, ok := s.files[f]
+		if !ok {
+			return fmt.Errorf("source %v: %v", f, ErrNotExist)
+		}
+		m.prefill(src)
+	}
+	sort.SliceStable(m.samples, func(i, j int) bool { return m.samples[i].t < m.samples[j].t })
+
+	s.files[filename] = m
+
+	return nil
+}
+
+// rate returns the rate of ds for the interval dt ending with the reading val.
+func (ds *memDS) rate(val string, dt float64) (float64, error) {
+	if ds.dst == rrd.Compute {
+		return math.NaN(), nil
+	}
+
+	v := math.NaN()
+	if val != "U" {
+		var err error
+		if v, err = strconv.ParseFloat(val, 64); err != nil {
+			return 0, fmt.Errorf("conversion of '%v' to float not complete", val)
+		}
+	}
+
+	prev := ds.prev
+	ds.prev, ds.lastDS = v, val
+
+	var r float64
+	switch ds.dst {
+	case rrd.Gauge:
+		r = v
+	case rrd.Absolute:
+		r = v / dt
+	case rrd.Counter, rrd.DCounter:
+		diff := v - prev
+		if diff < 0 {
+			// Counter wrap.
+			diff += math.Pow(2, 32)
+			if diff < 0 {
+				diff += math.Pow(2, 64) - math.Pow(2, 32)
+			}
+		}
+		r = diff / dt
+	case rrd.Derive, rrd.DDerive:
+		r = (v - prev) / dt
+	}
+
+	if dt > ds.heartbeat || r < ds.min || r > ds.max {
+		return math.NaN(), nil
+	}
+
+	return r, nil
+}
+
+// update applies the update value v.
+func (m *memRRD) update(v string) error {
+	parts := strings.Split(v, ":")
+	ts, err := strconv.ParseFloat(parts[0], 64)
+	if err != nil {
+		return fmt.Errorf("invalid timestamp: %v", parts[0])
+	}
+
+	if ts <= m.last {
+		return fmt.Errorf("illegal attempt to update using time %f when last update time is %f (minimum one second step)", ts, m.last)
+	}
+
+	if len(parts)-1 != len(m.ds) {
+		return fmt.Errorf("expected %v data source readings (got %v) from %v", len(m.ds), len(parts)-1, v)
+	}
+
+	s := memSample{from: m.last, t: ts, v: make([]float64, len(m.ds))}
+	dt := ts - m.last
+	for i, ds := range m.ds {
+		if s.v[i], err = ds.rate(parts[i+1], dt); err != nil {
+			return err
+		}
+	}
+
+	m.samples = append(m.samples, s)
+	m.last = ts
+
+	return nil
+}
+
+// Update implements Store.
+func (s *MemStore) Update(filename string, values []string) error {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+
+	m, ok := s.files[filename]
+	if !ok {
+		return ErrNotExist
+	}
+
+	for _, v := range values {
+		if err := m.update(v); err != nil {
+			return err
+		}
+	}
+
+	// Discard samples which are no longer needed.
+	min := m.last - m.retention()
+	i := sort.Search(len(m.samples), func(i int) bool { return m.samples[i].t > min })
+	if i > 0 {
+		m.samples = append(m.samples[:0], m.samples[i:]...)
+	}
+
+	return nil
+}
+
+// rraFor returns the RRA which best serves a fetch with cf from start, that is
+// the highest resolution RRA which covers start or failing that the one
+// which covers the longest period.
+func (m *memRRD) rraFor(cf string, start float64) *memRRA {
+	var best *memRRA
+	var bestRes, bestCover float64
+	var bestCovers bool
+	for _, rra := range m.rra {
+		if rra.cf != cf {
+			continue
+		}
+
+		res := float64(rra.steps) * m.step
+		cover := float64(rra.rows) * res
+		covers := m.last-cover <= start
+		switch {
+		case best == nil:
+		case covers && !bestCovers:
+		case covers && bestCovers && res < bestRes:
+		case !covers && !bestCovers && cover > bestCover:
+		default:
+			continue
+		}
+		best, bestRes, bestCover, bestCovers = rra, res, cover, covers
+	}
+
+	return best
+}
+
+// consolidate returns the value of ds, consolidated using rra, for the interval (from, to].
+func (m *memRRD) consolidate(rra *memRRA, ds int, from, to float64) *float64 {
+	i := sort.Search(len(m.samples), func(i int) bool { return m.samples[i].t > from })
+
+	var sum, known float64
+	val := math.NaN()
+	for ; i < len(m.samples) && m.samples[i].from < to; i++ {
+		s := m.samples[i]
+		overlap := math.Min(s.t, to) - math.Max(s.from, from)
+		v := s.v[ds]
+		if math.IsNaN(v) || overlap <= 0 {
+			continue
+		}
+
+		known += overlap
+		sum += v * overlap
+		switch {
+		case math.IsNaN(val), rra.cf == rrd.Last:
+			val = v
+		case rra.cf == rrd.Min:
+			val = math.Min(val, v)
+		case rra.cf == rrd.Max:
+			val = math.Max(val, v)
+		}
+	}
+
+	if known == 0 || 1-known/(to-from) > rra.xff {
+		return nil
+	}
+
+	if rra.cf == rrd.Average {
+		val = sum / known
+	}
+
+	return &val
+}
+
+// Fetch implements Store.
+func (s *MemStore) Fetch(filename string, req *FetchRequest) (*rrd.Fetch, error) {
+	s.mtx.RLock()
+	defer s.mtx.RUnlock()
+
+	m, ok := s.files[filename]
+	if !ok {
+		return nil, ErrNotExist
+	}
+
+	rra := m.rraFor(req.CF, float64(req.Start.Unix()))
+	if rra == nil {
+		return nil, fmt.Errorf("the RRD does not contain an RRA matching the chosen CF")
+	}
+
+	idx := make([]int, 0, len(m.ds))
+	names := req.Names
+	if len(names) == 0 {
+		for i, ds := range m.ds {
+			idx = append(idx, i)
+			names = append(names, ds.name)
+		}
+	} else {
+		for _, n := range names {
+			i := m.index(n)
+			if i == -1 {
+				return nil, fmt.Errorf("No such DS: %v", n)
+			}
+			idx = append(idx, i)
+		}
+	}
+
+	res := int64(rra.steps) * int64(m.step)
+	start := req.Start.Unix() / res * res
+	end := (req.End.Unix() + res - 1) / res * res
+	f := &rrd.Fetch{
+		FetchCommon: rrd.FetchCommon{
+			FlushVersion: 1,
+			Start:        time.Unix(start, 0),
+			End:          time.Unix(end, 0),
+			Step:         time.Duration(res) * time.Second,
+			Count:        len(idx),
+		},
+		Names: names,
+	}
+
+	for t := start + res; t <= end; t += res {
+		row := rrd.FetchRow{Time: time.Unix(t, 0), Data: make([]*float64, len(idx))}
+		for i, j := range idx {
+			row.Data[i] = m.consolidate(rra, j, float64(t-res), float64(t))
+		}
+		f.Rows = append(f.Rows, row)
+	}
+
+	return f, nil
+}
+
+// Info implements Store.
+func (s *MemStore) Info(filename string) ([]*rrd.Info, error) {
+	s.mtx.RLock()
+	defer s.mtx.RUnlock()
+
+	m, ok := s.files[filename]
+	if !ok {
+		return nil, ErrNotExist
+	}
+
+	info := []*rrd.Info{
+		{Key: "filename", Value: filename},
+		{Key: "rrd_version", Value: "0003"},
+		{Key: "step", Value: int64(m.step)},
+		{Key: "last_update", Value: int64(m.last)},
+	}
+
+	add := func(key string, val interface{}) {
+		info = append(info, &rrd.Info{Key: key, Value: val})
+	}
+
+	for i, ds := range m.ds {
+		p := fmt.Sprintf("ds[%v].", ds.name)
+		add(p+"index", int64(i))
+		add(p+"type", ds.dst)
+		if ds.dst == rrd.Compute {
+			continue
+		}
+		add(p+"minimal_heartbeat", int64(ds.heartbeat))
+		add(p+"min", ds.min)
+		add(p+"max", ds.max)
+		add(p+"last_ds", ds.lastDS)
+	}
+
+	for i, rra := range m.rra {
+		p := fmt.Sprintf("rra[%v].", i)
+		add(p+"cf", rra.cf)
+		add(p+"rows", int64(rra.rows))
+		add(p+"pdp_per_row", int64(rra.steps))
+		add(p+"xff", rra.xff)
+	}
+
+	return info, nil
+}
+
+// First implements Store.
+func (s *MemStore) First(filename string, rra int) (time.Time, error) {
+	s.mtx.RLock()
+	defer s.mtx.RUnlock()
+
+	m, ok := s.files[filename]
+	if !ok {
+		return time.Time{}, ErrNotExist
+	}
+
+	if rra < 0 || rra >= len(m.rra) {
+		return time.Time{}, fmt.Errorf("invalid rra index %v", rra)
+	}
+
+	r := m.rra[rra]
+	res := int64(r.steps) * int64(m.step)
+	last := int64(m.last) / res * res
+
+	return time.Unix(last-int64(r.rows-1)*res, 0), nil
+}
+
+// Last implements Store.
+func (s *MemStore) Last(filename string) (time.Time, error) {
+	s.mtx.RLock()
+	defer s.mtx.RUnlock()
+
+	m, ok := s.files[filename]
+	if !ok {
+		return time.Time{}, ErrNotExist
+	}
+
+	return time.Unix(int64(m.last), 0), nil
+}
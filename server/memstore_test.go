@@ -0,0 +1,96 @@
+package server
+
+import (
+	"testing"
+	"time"
+
+	"github.com/multiplay/go-rrd"
+	"github.com/stretchr/testify/assert"
+)
+
+func newTestRequest() *CreateRequest {
+	return &CreateRequest{
+		Step:  time.Second * 10,
+		Start: testStart,
+		DS:    []rrd.DS{rrd.NewGauge("val", time.Minute, 0, 1000)},
+		RRA:   []rrd.RRA{rrd.NewAverage(0.5, 1, 100), rrd.NewMax(0.5, 6, 10)},
+	}
+}
+
+func TestMemStore(t *testing.T) {
+	s := NewMemStore()
+
+	if !assert.NoError(t, s.Create(testFile, newTestRequest())) {
+		return
+	}
+
+	req := newTestRequest()
+	req.NoOverwrite = true
+	assert.Equal(t, ErrExist, s.Create(testFile, req))
+
+	for i := 1; i <= 6; i++ {
+		v := testStart.Add(time.Second * time.Duration(i*10)).Unix()
+		assert.NoError(t, s.Update(testFile, []string{string(rrd.NewUpdate(time.Unix(v, 0), i*10))}))
+	}
+
+	last, err := s.Last(testFile)
+	if assert.NoError(t, err) {
+		assert.Equal(t, testStart.Add(time.Minute).Unix(), last.Unix())
+	}
+
+	// Updates must be strictly increasing in time.
+	assert.Error(t, s.Update(testFile, []string{string(rrd.NewUpdate(last, 1))}))
+
+	f, err := s.Fetch(testFile, &FetchRequest{CF: rrd.Average, Start: testStart, End: last})
+	if assert.NoError(t, err) {
+		assert.Equal(t, []string{"val"}, f.Names)
+		assert.Equal(t, time.Second*10, f.Step)
+		if assert.NotEmpty(t, f.Rows) {
+			r := f.Rows[len(f.Rows)-1]
+			assert.Equal(t, last.Unix(), r.Time.Unix())
+			if assert.Len(t, r.Data, 1) && assert.NotNil(t, r.Data[0]) {
+				assert.Equal(t, float64(60), *r.Data[0])
+			}
+		}
+	}
+
+	_, err = s.Fetch(testFile, &FetchRequest{CF: "BOGUS", Start: testStart, End: last})
+	assert.Error(t, err)
+
+	info, err := s.Info(testFile)
+	if assert.NoError(t, err) {
+		assert.NotEmpty(t, info)
+	}
+
+	first, err := s.First(testFile, 0)
+	if assert.NoError(t, err) {
+		assert.True(t, first.Before(last))
+	}
+
+	_, err = s.Last("missing.rrd")
+	assert.Equal(t, ErrNotExist, err)
+	assert.Equal(t, ErrNotExist, s.Update("missing.rrd", []string{"N:1"}))
+}
+
+func TestMemStoreRate(t *testing.T) {
+	s := NewMemStore()
+	req := newTestRequest()
+	req.DS = []rrd.DS{rrd.NewCounter("val", time.Minute, 0, 1000)}
+	if !assert.NoError(t, s.Create(testFile, req)) {
+		return
+	}
+
+	for i := 1; i <= 3; i++ {
+		ts := testStart.Add(time.Second * time.Duration(i*10))
+		assert.NoError(t, s.Update(testFile, []string{string(rrd.NewUpdate(ts, i*100))}))
+	}
+
+	end := testStart.Add(time.Second * 30)
+	f, err := s.Fetch(testFile, &FetchRequest{CF: rrd.Average, Start: end.Add(-time.Second * 10), End: end})
+	if assert.NoError(t, err) && assert.NotEmpty(t, f.Rows) {
+		r := f.Rows[len(f.Rows)-1]
+		if assert.NotNil(t, r.Data[0]) {
+			assert.Equal(t, float64(10), *r.Data[0])
+		}
+	}
+}
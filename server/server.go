@@ -0,0 +1,244 @@
+// Package server provides a native rrdcached compatible server.
+//
+// It speaks rrdcached's line protocol over TCP and UNIX sockets, caching
+// updates in memory and periodically writing them to a Store. FileStore keeps
+// RRDs as rrdtool compatible files, MemStore keeps them in memory for tests.
+package server
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+	"sync"
+	"time"
+)
+
+// maxLineLen is the maximum length of a request line, including the newline,
+// the same as rrdcached's RRD_CMD_MAX.
+const maxLineLen = 4096
+
+var (
+	// DefaultWriteInterval is the default maximum duration updates are cached before being written.
+	DefaultWriteInterval = time.Minute * 5
+)
+
+// Server is a rrdcached compatible server.
+type Server struct {
+	store         Store
+	cache         *cache
+	writeInterval time.Duration
+
+	closers map[io.Closer]struct{}
+	done    chan struct{}
+	wg      sync.WaitGroup
+	mtx     sync.Mutex
+}
+
+// WriteInterval sets the maximum duration updates are cached before being written to the Store.
+func WriteInterval(d time.Duration) func(*Server) error {
+	return func(s *Server) error {
+		if d <= 0 {
+			return fmt.Errorf("invalid write interval %v", d)
+		}
+		s.writeInterval = d
+		return nil
+	}
+}
+
+// New returns a new Server which stores data in store.
+func New(store Store, options ...func(s *Server) error) (*Server, error) {
+	s := &Server{
+		store:         store,
+		cache:         newCache(store),
+		writeInterval: DefaultWriteInterval,
+		closers:       make(map[io.Closer]struct{}),
+		done:          make(chan struct{}),
+	}
+	for _, f := range options {
+		if f == nil {
+			return nil, ErrNilOption
+		}
+		if err := f(s); err != nil {
+			return nil, err
+		}
+	}
+
+	s.wg.Add(1)
+	go s.writer()
+
+	return s, nil
+}
+
+// writer writes cached updates to the store once they exceed the write interval.
+func (s *Server) writer() {
+	defer s.wg.Done()
+
+	t := time.NewTicker(s.writeInterval / 2)
+	defer t.Stop()
+	for {
+		select {
+		case <-t.C:
+			s.cache.flushOlder(time.Now().Add(-s.writeInterval)) // nolint: errcheck
+		case <-s.done:
+			return
+		}
+	}
+}
+
+// ListenAndServe listens on the network address addr and then calls Serve.
+// Network must be a stream network such as "tcp" or "unix".
+func (s *Server) ListenAndServe(network, addr string) error {
+	l, err := net.Listen(network, addr)
+	if err != nil {
+		return err
+	}
+
+	return s.Serve(l)
+}
+
+// Serve accepts connections on l, processing their requests until the Server is closed.
+// It always returns a non-nil error, ErrServerClosed after Close.
+func (s *Server) Serve(l net.Listener) error {
+	if !s.track(l) {
+		l.Close() // nolint: errcheck
+		return ErrServerClosed
+	}
+	defer s.untrack(l)
+
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			if !s.running() {
+				return ErrServerClosed
+			}
+			return err
+		}
+
+		if !s.track(conn) {
+			conn.Close() // nolint: errcheck
+			return ErrServerClosed
+		}
+
+		s.wg.Add(1)
+		go s.handle(conn)
+	}
+}
+
+// track records c so it's closed by Close, returning false if the server is already closed.
+func (s *Server) track(c io.Closer) bool {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+
+	if !s.running() {
+		return false
+	}
+	s.closers[c] = struct{}{}
+
+	return true
+}
+
+// untrack removes c from the tracked closers.
+func (s *Server) untrack(c io.Closer) {
+	s.mtx.Lock()
+	delete(s.closers, c)
+	s.mtx.Unlock()
+}
+
+// running returns true unless Close has been called, false otherwise.
+func (s *Server) running() bool {
+	select {
+	case <-s.done:
+		return false
+	default:
+		return true
+	}
+}
+
+// handle processes the requests of a client connection.
+func (s *Server) handle(conn net.Conn) {
+	defer func() {
+		conn.Close() // nolint: errcheck
+		s.untrack(conn)
+		s.wg.Done()
+	}()
+
+	sc := bufio.NewScanner(conn)
+	sc.Buffer(make([]byte, maxLineLen), maxLineLen)
+	w := bufio.NewWriter(conn)
+	var b *batch
+	for sc.Scan() {
+		l := strings.TrimSpace(sc.Text())
+		if l == "" {
+			continue
+		}
+
+		args := strings.Fields(l)
+		cmd := strings.ToLower(args[0])
+		if b != nil {
+			if cmd != "." {
+				b.exec(s, args)
+				continue
+			}
+			if err := b.response().write(w); err != nil {
+				return
+			}
+			b = nil
+		} else {
+			if cmd == cmdQuit {
+				return
+			}
+
+			r := s.exec(args)
+			if cmd == cmdBatch && r.status == 0 {
+				b = &batch{}
+			}
+			if err := r.write(w); err != nil {
+				return
+			}
+		}
+
+		if err := w.Flush(); err != nil {
+			return
+		}
+	}
+
+	if sc.Err() == bufio.ErrTooLong {
+		// The rest of the line can't be skipped reliably, so the connection is closed.
+		if errorf("Line too long, the maximum is %v bytes", maxLineLen).write(w) == nil {
+			w.Flush() // nolint: errcheck
+		}
+	}
+}
+
+// exec executes the command args, returning its response.
+func (s *Server) exec(args []string) *response {
+	cmd := strings.ToLower(args[0])
+	h, ok := handlers[cmd]
+	if !ok {
+		return errorf("Unknown command: %v", args[0])
+	}
+
+	return h(s, args[1:])
+}
+
+// Close stops the server, closing all listeners and connections and writing all cached updates.
+// It returns the first error encountered writing updates, if any.
+func (s *Server) Close() error {
+	s.mtx.Lock()
+	if !s.running() {
+		s.mtx.Unlock()
+		return ErrServerClosed
+	}
+	close(s.done)
+
+	for c := range s.closers {
+		c.Close() // nolint: errcheck
+	}
+	s.mtx.Unlock()
+
+	s.wg.Wait()
+
+	return s.cache.flushOlder(time.Now())
+}
@@ -0,0 +1,530 @@
+package server
+
+import (
+	"bufio"
+	"encoding/binary"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/multiplay/go-rrd"
+	"github.com/stretchr/testify/assert"
+)
+
+const (
+	testFile = "test.rrd"
+)
+
+var (
+	testStart = time.Unix(1500000000, 0)
+)
+
+// newTestServer returns a running server listening on a local TCP port and its address.
+func newTestServer(t *testing.T, options ...func(s *Server) error) (*Server, string) {
+	s, err := New(NewMemStore(), options...)
+	if !assert.NoError(t, err) {
+		return nil, ""
+	}
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if !assert.NoError(t, err) {
+		return nil, ""
+	}
+
+	go s.Serve(l) // nolint: errcheck
+
+	return s, l.Addr().String()
+}
+
+func TestServer(t *testing.T) {
+	s, addr := newTestServer(t)
+	if s == nil {
+		return
+	}
+	defer func() {
+		assert.NoError(t, s.Close())
+	}()
+
+	c, err := rrd.NewClient(addr, rrd.Timeout(time.Second*2))
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer func() {
+		assert.NoError(t, c.Close())
+	}()
+
+	ping := func(t *testing.T) {
+		assert.NoError(t, c.Ping())
+	}
+
+	invalid := func(t *testing.T) {
+		_, err := c.Exec("invalid")
+		assert.Error(t, err)
+	}
+
+	create := func(t *testing.T) {
+		err := c.Create(
+			testFile,
+			[]rrd.DS{rrd.NewGauge("watts", time.Minute*2, 0, 24000), rrd.NewCounter("bytes", time.Minute*2, 0, 1000)},
+			[]rrd.RRA{rrd.NewAverage(0.5, 1, 100), rrd.NewMax(0.5, 5, 10)},
+			rrd.Step(time.Minute),
+			rrd.Start(testStart),
+		)
+		assert.NoError(t, err)
+
+		err = c.Create(
+			testFile,
+			[]rrd.DS{rrd.NewGauge("watts", time.Minute*2, 0, 24000)},
+			[]rrd.RRA{rrd.NewAverage(0.5, 1, 100)},
+			rrd.NoOverwrite(),
+		)
+		assert.True(t, rrd.IsExist(err), "%v", err)
+	}
+
+	update := func(t *testing.T) {
+		assert.NoError(t, c.Update(testFile,
+			rrd.NewUpdate(testStart.Add(time.Minute), 10, 0),
+			rrd.NewUpdate(testStart.Add(time.Minute*2), 20, 600),
+			rrd.NewUpdate(testStart.Add(time.Minute*3), 30, 1200),
+		))
+
+		err := c.Update(testFile, rrd.NewUpdate(testStart, 1, 1))
+		assert.True(t, rrd.IsIllegalUpdate(err), "%v", err)
+
+		err = c.Update("missing.rrd", rrd.NewUpdate(testStart, 1))
+		assert.True(t, rrd.IsNotExist(err), "%v", err)
+	}
+
+	pending := func(t *testing.T) {
+		p, err := c.Pending(testFile)
+		if !assert.NoError(t, err) {
+			return
+		}
+		f := func(v float64) *float64 { return &v }
+		assert.Equal(t, []*rrd.PendingUpdate{
+			{Time: testStart.Add(time.Minute), Data: []*float64{f(10), f(0)}},
+			{Time: testStart.Add(time.Minute * 2), Data: []*float64{f(20), f(600)}},
+			{Time: testStart.Add(time.Minute * 3), Data: []*float64{f(30), f(1200)}},
+		}, p)
+
+		_, err = c.Pending("missing.rrd")
+		assert.Error(t, err)
+	}
+
+	queue := func(t *testing.T) {
+		q, err := c.Queue("")
+		if !assert.NoError(t, err) {
+			return
+		}
+		assert.Equal(t, []*rrd.Queue{{Size: 3, File: testFile}}, q)
+	}
+
+	flush := func(t *testing.T) {
+		assert.NoError(t, c.Flush(testFile))
+		assert.NoError(t, c.FlushAll())
+
+		p, err := c.Pending(testFile)
+		if assert.NoError(t, err) {
+			assert.Empty(t, p)
+		}
+
+		q, err := c.Queue("")
+		if assert.NoError(t, err) {
+			assert.Empty(t, q)
+		}
+	}
+
+	last := func(t *testing.T) {
+		ts, err := c.Last(testFile)
+		if assert.NoError(t, err) {
+			assert.Equal(t, testStart.Add(time.Minute*3), ts)
+		}
+	}
+
+	first := func(t *testing.T) {
+		ts, err := c.First(testFile, 0)
+		if assert.NoError(t, err) {
+			assert.Equal(t, testStart.Add(time.Minute*3-time.Minute*99), ts)
+		}
+
+		_, err = c.First(testFile, 2)
+		assert.Error(t, err)
+	}
+
+	info := func(t *testing.T) {
+		i, err := c.Info(testFile)
+		if !assert.NoError(t, err) {
+			return
+		}
+		expected := []*rrd.Info{
+			{Key: "filename", Value: testFile},
+			{Key: "rrd_version", Value: "0003"},
+			{Key: "step", Value: int64(60)},
+			{Key: "last_update", Value: int64(1500000180)},
+			{Key: "ds[watts].index", Value: int64(0)},
+			{Key: "ds[watts].type", Value: "GAUGE"},
+			{Key: "ds[watts].minimal_heartbeat", Value: int64(120)},
+			{Key: "ds[watts].min", Value: float64(0)},
+			{Key: "ds[watts].max", Value: float64(24000)},
+			{Key: "ds[watts].last_ds", Value: "30"},
+			{Key: "ds[bytes].index", Value: int64(1)},
+			{Key: "ds[bytes].type", Value: "COUNTER"},
+			{Key: "ds[bytes].minimal_heartbeat", Value: int64(120)},
+			{Key: "ds[bytes].min", Value: float64(0)},
+			{Key: "ds[bytes].max", Value: float64(1000)},
+			{Key: "ds[bytes].last_ds", Value: "1200"},
+			{Key: "rra[0].cf", Value: "AVERAGE"},
+			{Key: "rra[0].rows", Value: int64(100)},
+			{Key: "rra[0].pdp_per_row", Value: int64(1)},
+			{Key: "rra[0].xff", Value: 0.5},
+			{Key: "rra[1].cf", Value: "MAX"},
+			{Key: "rra[1].rows", Value: int64(10)},
+			{Key: "rra[1].pdp_per_row", Value: int64(5)},
+			{Key: "rra[1].xff", Value: 0.5},
+		}
+		assert.Equal(t, expected, i)
+	}
+
+	fetch := func(t *testing.T) {
+		f, err := c.Fetch(testFile, rrd.Average, testStart.Unix(), testStart.Add(time.Minute*4).Unix())
+		if !assert.NoError(t, err) {
+			return
+		}
+		f10, f20, f30, f10b := float64(10), float64(20), float64(30), float64(10)
+		expected := &rrd.Fetch{
+			FetchCommon: rrd.FetchCommon{
+				FlushVersion: 1,
+				Start:        testStart,
+				End:          testStart.Add(time.Minute * 4),
+				Step:         time.Minute,
+				Count:        2,
+			},
+			Names: []string{"watts", "bytes"},
+			Rows: []rrd.FetchRow{
+				{Time: testStart.Add(time.Minute), Data: []*float64{&f10, nil}},
+				{Time: testStart.Add(time.Minute * 2), Data: []*float64{&f20, &f10b}},
+				{Time: testStart.Add(time.Minute * 3), Data: []*float64{&f30, &f10b}},
+				{Time: testStart.Add(time.Minute * 4), Data: []*float64{nil, nil}},
+			},
+		}
+		assert.Equal(t, expected, f)
+
+		f, err = c.Fetch(testFile, rrd.Max, "end-5min", testStart.Add(time.Minute*5).Unix(), "watts")
+		if !assert.NoError(t, err) {
+			return
+		}
+		assert.Equal(t, []string{"watts"}, f.Names)
+		assert.Equal(t, time.Minute*5, f.Step)
+		if assert.Len(t, f.Rows, 1) && assert.NotNil(t, f.Rows[0].Data[0]) {
+			assert.Equal(t, float64(30), *f.Rows[0].Data[0])
+		}
+
+		_, err = c.Fetch(testFile, rrd.Last)
+		assert.Error(t, err)
+	}
+
+	fetchbin := func(t *testing.T) {
+		f, err := c.FetchBin(testFile, rrd.Average, testStart.Unix(), testStart.Add(time.Minute*2).Unix(), "watts")
+		if !assert.NoError(t, err) {
+			return
+		}
+		expected := []*rrd.FetchBinDS{
+			{
+				Name:    "watts",
+				Records: 2,
+				Size:    8,
+				Endian:  binary.LittleEndian,
+				Data:    []float64{10, 20},
+			},
+		}
+		assert.Equal(t, expected, f.DS)
+
+		// The conversion matches the text fetch.
+		text, err := c.Fetch(testFile, rrd.Average, testStart.Unix(), testStart.Add(time.Minute*2).Unix(), "watts")
+		if assert.NoError(t, err) {
+			assert.Equal(t, text, f.Fetch())
+		}
+	}
+
+	help := func(t *testing.T) {
+		h, err := c.Help("quit")
+		if assert.NoError(t, err) {
+			assert.Equal(t, []string{"Usage: QUIT", "", "Disconnect from rrdcached.", ""}, h)
+		}
+
+		h, err = c.Help()
+		if assert.NoError(t, err) {
+			assert.Len(t, h, len(usages))
+		}
+	}
+
+	wrote := func(t *testing.T) {
+		assert.Error(t, c.Wrote(testFile))
+	}
+
+	batch := func(t *testing.T) {
+		cmds := []*rrd.Cmd{
+			rrd.NewCmd("update").WithArgs(testFile, rrd.NewUpdate(testStart.Add(time.Minute*4), 40, 1800)),
+			rrd.NewCmd("ping"),
+			rrd.NewCmd("update").WithArgs("missing.rrd", rrd.NewUpdate(testStart, 1)),
+		}
+		r, err := c.ExecBatch(cmds...)
+		if !assert.NoError(t, err) {
+			return
+		}
+		expected := []*rrd.BatchError{
+			{Index: 1, Cmd: cmds[1], Msg: "Can't use 'ping' here."},
+			{Index: 2, Cmd: cmds[2], Msg: "No such file: missing.rrd"},
+		}
+		assert.Equal(t, expected, r.Errors)
+	}
+
+	stats := func(t *testing.T) {
+		st, err := c.Stats()
+		if !assert.NoError(t, err) {
+			return
+		}
+		expected := &rrd.Stats{
+			QueueLength:     1,
+			UpdatesReceived: 4,
+			FlushesReceived: 2,
+			UpdatesWritten:  1,
+			DataSetsWritten: 3,
+			TreeNodesNumber: 1,
+			TreeDepth:       1,
+		}
+		assert.Equal(t, expected, st)
+	}
+
+	forget := func(t *testing.T) {
+		assert.NoError(t, c.Forget(testFile))
+		assert.Error(t, c.Forget(testFile))
+	}
+
+	tests := []struct {
+		name string
+		f    func(t *testing.T)
+	}{
+		{"ping", ping},
+		{"invalid", invalid},
+		{"create", create},
+		{"update", update},
+		{"pending", pending},
+		{"queue", queue},
+		{"flush", flush},
+		{"last", last},
+		{"first", first},
+		{"info", info},
+		{"fetch", fetch},
+		{"fetchbin", fetchbin},
+		{"help", help},
+		{"wrote", wrote},
+		{"batch", batch},
+		{"stats", stats},
+		{"forget", forget},
+		{"ping", ping},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, tc.f)
+	}
+}
+
+func TestServerMigrate(t *testing.T) {
+	s, addr := newTestServer(t)
+	if s == nil {
+		return
+	}
+	defer func() {
+		assert.NoError(t, s.Close())
+	}()
+
+	c, err := rrd.NewClient(addr, rrd.Timeout(time.Second*2))
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer func() {
+		assert.NoError(t, c.Close())
+	}()
+
+	schema := &rrd.Schema{
+		Step: time.Minute,
+		DS:   []rrd.DS{rrd.NewGauge("watts", time.Minute*2, 0, 24000)},
+		RRA:  []rrd.RRA{rrd.NewAverage(0.5, 1, 100)},
+	}
+	if !assert.NoError(t, c.Create(testFile, schema.DS, schema.RRA, rrd.Step(schema.Step), rrd.Start(testStart))) {
+		return
+	}
+	if !assert.NoError(t, c.Update(testFile,
+		rrd.NewUpdate(testStart.Add(time.Minute), 10),
+		rrd.NewUpdate(testStart.Add(time.Minute*2), 20),
+	)) {
+		return
+	}
+
+	schema.DS = append(schema.DS, rrd.NewGauge("amps", time.Minute*2, 0, 100))
+	schema.RRA = []rrd.RRA{rrd.NewAverage(0.5, 1, 200)}
+	changes, err := c.Migrate(testFile, schema)
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.Equal(t, []*rrd.SchemaChange{
+		{Type: rrd.DSAdded, Name: "amps"},
+		{Type: rrd.RRAResized, Name: "AVERAGE:1", Old: 100, New: 200},
+	}, changes)
+
+	i, err := c.RRDInfo(testFile)
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.Len(t, i.DS, 2)
+	if assert.Len(t, i.RRA, 1) {
+		assert.Equal(t, 200, i.RRA[0].Rows)
+	}
+	assert.Equal(t, testStart.Add(time.Minute*2), i.LastUpdate)
+
+	// Existing data is preserved.
+	f, err := c.Fetch(testFile, rrd.Average, testStart.Unix(), testStart.Add(time.Minute*2).Unix())
+	if assert.NoError(t, err) && assert.Len(t, f.Rows, 2) {
+		assert.Equal(t, float64(20), *f.Rows[1].Data[0])
+		assert.Nil(t, f.Rows[1].Data[1])
+	}
+
+	changes, err = c.Migrate(testFile, schema)
+	if assert.NoError(t, err) {
+		assert.Empty(t, changes)
+	}
+
+	// The existing step is kept if the schema doesn't set one and a data
+	// source only needs renaming once.
+	schema.Step = 0
+	schema.DS[0] = rrd.NewDS("DS:power=watts:GAUGE:120:0:24000")
+	changes, err = c.Migrate(testFile, schema)
+	if assert.NoError(t, err) {
+		assert.Equal(t, []*rrd.SchemaChange{{Type: rrd.DSRenamed, Name: "power", Old: "watts"}}, changes)
+	}
+
+	i, err = c.RRDInfo(testFile)
+	if assert.NoError(t, err) {
+		assert.Equal(t, time.Minute, i.Step)
+		assert.NotNil(t, i.DSNamed("power"))
+	}
+
+	changes, err = c.Migrate(testFile, schema)
+	if assert.NoError(t, err) {
+		assert.Empty(t, changes)
+	}
+}
+
+func TestServerUnix(t *testing.T) {
+	dir, err := ioutil.TempDir("", "go-rrd")
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer os.RemoveAll(dir) // nolint: errcheck
+
+	s, err := New(NewMemStore())
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	sock := filepath.Join(dir, "rrdcached.sock")
+	l, err := net.Listen("unix", sock)
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	done := make(chan error)
+	go func() {
+		done <- s.Serve(l)
+	}()
+
+	c, err := rrd.NewClient(sock, rrd.Unix)
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	assert.NoError(t, c.Ping())
+	assert.NoError(t, c.Close())
+	assert.NoError(t, s.Close())
+	assert.Equal(t, ErrServerClosed, <-done)
+	assert.Equal(t, ErrServerClosed, s.Close())
+}
+
+func TestServerLineTooLong(t *testing.T) {
+	s, addr := newTestServer(t)
+	if s == nil {
+		return
+	}
+	defer func() {
+		assert.NoError(t, s.Close())
+	}()
+
+	conn, err := net.Dial("tcp", addr)
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer conn.Close() // nolint: errcheck
+
+	assert.NoError(t, conn.SetDeadline(time.Now().Add(time.Second*2)))
+	_, err = conn.Write([]byte("update " + strings.Repeat("a", maxLineLen) + "\n"))
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	l, err := bufio.NewReader(conn).ReadString('\n')
+	if assert.NoError(t, err) {
+		assert.Equal(t, "-1 Line too long, the maximum is 4096 bytes\n", l)
+	}
+}
+
+func TestServerWriteInterval(t *testing.T) {
+	s, addr := newTestServer(t, WriteInterval(time.Millisecond*20))
+	if s == nil {
+		return
+	}
+	defer func() {
+		assert.NoError(t, s.Close())
+	}()
+
+	c, err := rrd.NewClient(addr, rrd.Timeout(time.Second*2))
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer func() {
+		assert.NoError(t, c.Close())
+	}()
+
+	err = c.Create(testFile, []rrd.DS{rrd.NewGauge("watts", time.Minute*2, 0, 24000)}, []rrd.RRA{rrd.NewAverage(0.5, 1, 100)})
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	if !assert.NoError(t, c.Update(testFile, rrd.NewUpdateNow(10))) {
+		return
+	}
+
+	var st *rrd.Stats
+	for i := 0; i < 100; i++ {
+		if st, err = c.Stats(); err != nil || st.QueueLength == 0 {
+			break
+		}
+		time.Sleep(time.Millisecond * 10)
+	}
+	if assert.NoError(t, err) {
+		assert.Equal(t, int64(0), st.QueueLength)
+		assert.Equal(t, int64(1), st.DataSetsWritten)
+	}
+}
+
+func TestServerOptions(t *testing.T) {
+	_, err := New(NewMemStore(), nil)
+	assert.Equal(t, ErrNilOption, err)
+
+	_, err = New(NewMemStore(), WriteInterval(0))
+	assert.Error(t, err)
+}
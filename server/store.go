@@ -0,0 +1,60 @@
+package server
+
+import (
+	"errors"
+	"time"
+
+	"github.com/multiplay/go-rrd"
+)
+
+var (
+	// ErrNotExist is returned by a Store if the requested file doesn't exist.
+	ErrNotExist = errors.New("file does not exist")
+
+	// ErrExist is returned by a Store if a file being created already exists.
+	ErrExist = errors.New("file exists")
+)
+
+// CreateRequest represents the parameters of a create command.
+type CreateRequest struct {
+	Step        time.Duration
+	Start       time.Time
+	NoOverwrite bool
+	Sources     []string
+	Template    string
+	DS          []rrd.DS
+	RRA         []rrd.RRA
+}
+
+// FetchRequest represents the parameters of a fetch or fetchbin command.
+type FetchRequest struct {
+	CF    string
+	Start time.Time
+	End   time.Time
+	Names []string
+}
+
+// Store is the interface implemented by the RRD storage used by a Server.
+//
+// Implementations must be goroutine safe and return ErrNotExist for
+// operations on files which don't exist.
+type Store interface {
+	// Create creates filename as defined by req.
+	// It returns ErrExist if the file exists and req.NoOverwrite is set.
+	Create(filename string, req *CreateRequest) error
+
+	// Update applies values, in the form timestamp:value[:value...], to filename.
+	Update(filename string, values []string) error
+
+	// Fetch returns the consolidated data from filename as requested by req.
+	Fetch(filename string, req *FetchRequest) (*rrd.Fetch, error)
+
+	// Info returns the configuration information of filename.
+	Info(filename string) ([]*rrd.Info, error)
+
+	// First returns the timestamp of the first CDP for the given RRA of filename.
+	First(filename string, rra int) (time.Time, error)
+
+	// Last returns the timestamp of the last update to filename.
+	Last(filename string) (time.Time, error)
+}
@@ -0,0 +1,115 @@
+package server
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// timeUnits maps AT-style unit names to the function which applies an offset of n units.
+var timeUnits = map[string]func(t time.Time, n int) time.Time{}
+
+func init() {
+	addUnit := func(d time.Duration, names ...string) {
+		for _, name := range names {
+			timeUnits[name] = func(t time.Time, n int) time.Time {
+				return t.Add(d * time.Duration(n))
+			}
+		}
+	}
+	addUnit(time.Second, "s", "sec", "secs", "second", "seconds")
+	addUnit(time.Minute, "m", "min", "mins", "minute", "minutes")
+	addUnit(time.Hour, "h", "hour", "hours")
+	addUnit(time.Hour*24, "d", "day", "days")
+	addUnit(time.Hour*24*7, "w", "week", "weeks")
+	for _, name := range []string{"mon", "month", "months"} {
+		timeUnits[name] = func(t time.Time, n int) time.Time { return t.AddDate(0, n, 0) }
+	}
+	for _, name := range []string{"y", "year", "years"} {
+		timeUnits[name] = func(t time.Time, n int) time.Time { return t.AddDate(n, 0, 0) }
+	}
+}
+
+// parseTime parses spec which is either a unix timestamp or a subset of AT-style
+// time specifications, consisting of an optional base of now, start or end
+// followed by offsets, for example now-1d, end-6h or -1h30min.
+//
+// Base times are looked up in bases, offsets without a base are relative to now.
+func parseTime(spec string, bases map[string]time.Time) (time.Time, error) {
+	if i, err := strconv.ParseInt(spec, 10, 64); err == nil {
+		return time.Unix(i, 0), nil
+	}
+
+	i := strings.IndexAny(spec, "+-")
+	if i == -1 {
+		i = len(spec)
+	}
+
+	base := strings.ToLower(spec[:i])
+	switch base {
+	case "", "n":
+		base = "now"
+	case "s":
+		base = "start"
+	case "e":
+		base = "end"
+	}
+
+	t, ok := bases[base]
+	if !ok {
+		return t, fmt.Errorf("invalid time base %q in %q", spec[:i], spec)
+	}
+
+	for rest, sign := spec[i:], 1; rest != ""; {
+		var err error
+		if t, rest, sign, err = parseOffset(t, rest, sign); err != nil {
+			return t, fmt.Errorf("invalid time %q: %v", spec, err)
+		}
+	}
+
+	return t, nil
+}
+
+// parseOffset applies the first offset, such as -1d, in s to t returning the result,
+// the remainder of s and the sign of the offset, which applies to subsequent offsets
+// without an explicit sign.
+func parseOffset(t time.Time, s string, sign int) (time.Time, string, int, error) {
+	switch s[0] {
+	case '-':
+		sign = -1
+		s = s[1:]
+	case '+':
+		sign = 1
+		s = s[1:]
+	}
+
+	i := strings.IndexFunc(s, func(r rune) bool { return r < '0' || r > '9' })
+	if i == -1 {
+		i = len(s)
+	} else if i == 0 {
+		return t, "", sign, fmt.Errorf("missing number in offset")
+	}
+
+	n, err := strconv.Atoi(s[:i])
+	if err != nil {
+		return t, "", sign, err
+	}
+	s = s[i:]
+
+	i = strings.IndexAny(s, "+-0123456789")
+	if i == -1 {
+		i = len(s)
+	}
+	unit := strings.ToLower(s[:i])
+	if unit == "" {
+		unit = "s"
+	}
+
+	f, ok := timeUnits[unit]
+	if !ok {
+		return t, "", sign, fmt.Errorf("unknown unit %q", unit)
+	}
+
+	return f(t, sign*n), s[i:], sign, nil
+}
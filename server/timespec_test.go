@@ -0,0 +1,50 @@
+package server
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseTime(t *testing.T) {
+	now := time.Unix(1500000000, 0)
+	bases := map[string]time.Time{
+		"now": now,
+		"end": now.Add(-time.Hour),
+	}
+
+	tests := []struct {
+		spec     string
+		expected time.Time
+		err      bool
+	}{
+		{spec: "1400000000", expected: time.Unix(1400000000, 0)},
+		{spec: "now", expected: now},
+		{spec: "N", expected: now},
+		{spec: "now-1d", expected: now.Add(-time.Hour * 24)},
+		{spec: "-1h30min", expected: now.Add(-time.Hour - time.Minute*30)},
+		{spec: "-1h+30min", expected: now.Add(-time.Minute * 30)},
+		{spec: "e-6h", expected: now.Add(-time.Hour * 7)},
+		{spec: "end-30", expected: now.Add(-time.Hour - time.Second*30)},
+		{spec: "now-1mon", expected: now.AddDate(0, -1, 0)},
+		{spec: "now+1y", expected: now.AddDate(1, 0, 0)},
+		{spec: "start-1h", err: true},
+		{spec: "bogus", err: true},
+		{spec: "now-1fortnight", err: true},
+		{spec: "now-h", err: true},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.spec, func(t *testing.T) {
+			v, err := parseTime(tc.spec, bases)
+			if tc.err {
+				assert.Error(t, err)
+				return
+			}
+			if assert.NoError(t, err) {
+				assert.True(t, tc.expected.Equal(v), "expected %v got %v", tc.expected, v)
+			}
+		})
+	}
+}
@@ -0,0 +1,707 @@
+// Package statsd provides a StatsD compatible gateway which aggregates the
+// metrics it receives over UDP and writes them to RRDs through rrdcached.
+//
+// Every flush interval each metric is written to its own RRD, which is created
+// on demand with a step of the flush interval:
+//
+//   - Counters use an ABSOLUTE data source called count, so the RRD stores
+//     the rate per second. COUNTER isn't used as the gateway only holds the
+//     counts of the current interval, any total would restart from zero with
+//     the gateway which rrdtool would treat as a wrap.
+//   - Gauges use a GAUGE data source called value.
+//   - Sets use a GAUGE data source called count, the number of unique values.
+//   - Timers use an ABSOLUTE data source called count and GAUGE data sources
+//     called mean, lower, upper and one for each percentile, such as p90 or
+//     p99_9 for 99.9, which is the upper value of that percentile.
+package statsd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/multiplay/go-rrd"
+	"github.com/multiplay/go-rrd/internal/ingest"
+)
+
+var (
+	// DefaultFlushInterval is the default interval at which aggregated metrics are written.
+	DefaultFlushInterval = time.Second * 10
+
+	// DefaultPercentiles are the default percentiles calculated for timers.
+	DefaultPercentiles = []float64{90}
+
+	// DefaultTimeout is the default maximum duration of a flush.
+	DefaultTimeout = time.Second * 30
+
+	// ErrNilOption is returned by New if an option is nil.
+	ErrNilOption = errors.New("nil option")
+
+	// ErrGatewayClosed is returned by Serve and Close after Close has been called.
+	ErrGatewayClosed = errors.New("gateway closed")
+)
+
+// maxPacketSize is the maximum size of a UDP packet.
+const maxPacketSize = 65535
+
+// Kind is the kind of a StatsD metric.
+type Kind string
+
+// Metric kinds.
+const (
+	Counter Kind = "counter"
+	Gauge   Kind = "gauge"
+	Timer   Kind = "timer"
+	Set     Kind = "set"
+)
+
+// kinds maps the StatsD metric types to their Kind.
+var kinds = map[string]Kind{
+	"c":  Counter,
+	"g":  Gauge,
+	"ms": Timer,
+	"h":  Timer,
+	"s":  Set,
+}
+
+// Client is the interface implemented by rrd.Client and rrd.Pool which
+// provides the commands used by a Gateway.
+type Client interface {
+	rrd.Batcher
+	CreateContext(ctx context.Context, filename string, ds []rrd.DS, rra []rrd.RRA, options ...rrd.CreateOption) error
+}
+
+// DefaultFilename returns the RRD filename of the metric name of kind k,
+// which is in a directory for each kind with the dots of name replaced by
+// slashes e.g. counters/app/requests.rrd for the counter app.requests.
+func DefaultFilename(k Kind, name string) string {
+	return fmt.Sprintf("%vs/%v.rrd", k, strings.Replace(name, ".", "/", -1))
+}
+
+// LineError represents a line which couldn't be processed.
+type LineError = ingest.LineError
+
+// CreateError represents the failure to create the RRD of a metric, whose
+// Metric is the kind and name of the metric e.g. "counter app.requests".
+type CreateError = ingest.CreateError
+
+// key identifies an aggregated metric.
+type key struct {
+	kind Kind
+	name string
+}
+
+// metric returns the description of the metric used in errors.
+func (k key) metric() string {
+	return fmt.Sprintf("%v %v", k.kind, k.name)
+}
+
+// timer is the state of an aggregated timer.
+type timer struct {
+	count  float64
+	values []float64
+}
+
+// Gateway is a StatsD compatible server which aggregates metrics and writes
+// them to rrdcached using batches. It's goroutine safe.
+//
+// Metrics which have been seen are written every flush, with counters and
+// sets reset to zero and gauges retaining their last value. Timers which
+// received no values have a count of zero and unknown statistics.
+type Gateway struct {
+	c           Client
+	interval    time.Duration
+	percentiles []float64
+	timeout     time.Duration
+	onError     func(err error)
+	filename    func(k Kind, name string) string
+	schemas     map[Kind]*rrd.Schema
+
+	counters map[string]float64
+	gauges   map[string]float64
+	timers   map[string]*timer
+	sets     map[string]map[string]struct{}
+	mtx      sync.Mutex
+
+	creator *ingest.Creator
+
+	// flushMtx ensures flushes are written in order.
+	flushMtx sync.Mutex
+
+	// last is the time of the last flush, protected by flushMtx.
+	last time.Time
+
+	closers  map[io.Closer]struct{}
+	closeMtx sync.Mutex
+	done     chan struct{}
+	wg       sync.WaitGroup
+}
+
+// FlushInterval sets the interval at which a Gateway writes aggregated
+// metrics, which is also the step of the RRDs it creates.
+// It must be a whole number of seconds.
+func FlushInterval(d time.Duration) func(*Gateway) error {
+	return func(g *Gateway) error {
+		if d < time.Second || d%time.Second != 0 {
+			return fmt.Errorf("invalid flush interval %v", d)
+		}
+		g.interval = d
+		return nil
+	}
+}
+
+// Percentiles sets the percentiles calculated for timers, defaulting to DefaultPercentiles.
+func Percentiles(percentiles ...float64) func(*Gateway) error {
+	return func(g *Gateway) error {
+		names := make(map[string]bool)
+		for _, p := range percentiles {
+			n := percentileName(p)
+			if !(p > 0 && p < 100) || len(n) > 19 || names[n] {
+				return fmt.Errorf("invalid percentile %v", p)
+			}
+			names[n] = true
+		}
+		g.percentiles = percentiles
+		return nil
+	}
+}
+
+// Timeout sets the maximum duration of a flush, defaulting to DefaultTimeout.
+func Timeout(timeout time.Duration) func(*Gateway) error {
+	return func(g *Gateway) error {
+		if timeout <= 0 {
+			return fmt.Errorf("invalid timeout %v", timeout)
+		}
+		g.timeout = timeout
+		return nil
+	}
+}
+
+// OnError sets the handler a Gateway calls for each failure. The error is a
+// *LineError for invalid lines, a *CreateError if the RRD of a metric couldn't
+// be created or a *rrd.WriteError if its update failed. It's called from the
+// receiving and flushing goroutines so should not block.
+func OnError(f func(err error)) func(*Gateway) error {
+	return func(g *Gateway) error {
+		g.onError = f
+		return nil
+	}
+}
+
+// Filename sets the function which returns the RRD filename, relative to the
+// base directory of rrdcached, of a metric, defaulting to DefaultFilename.
+// Names only contain the characters [a-zA-Z0-9_.-].
+func Filename(f func(k Kind, name string) string) func(*Gateway) error {
+	return func(g *Gateway) error {
+		if f == nil {
+			return errors.New("invalid filename func: nil")
+		}
+		g.filename = f
+		return nil
+	}
+}
+
+// New returns a new Gateway which writes metrics using c.
+func New(c Client, options ...func(g *Gateway) error) (*Gateway, error) {
+	g := &Gateway{
+		c:           c,
+		interval:    DefaultFlushInterval,
+		percentiles: DefaultPercentiles,
+		timeout:     DefaultTimeout,
+		filename:    DefaultFilename,
+		counters:    make(map[string]float64),
+		gauges:      make(map[string]float64),
+		timers:      make(map[string]*timer),
+		sets:        make(map[string]map[string]struct{}),
+		creator:     ingest.NewCreator(c),
+		closers:     make(map[io.Closer]struct{}),
+		done:        make(chan struct{}),
+	}
+	for _, f := range options {
+		if f == nil {
+			return nil, ErrNilOption
+		}
+		if err := f(g); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := g.initSchemas(); err != nil {
+		return nil, err
+	}
+
+	g.wg.Add(1)
+	go g.run()
+
+	return g, nil
+}
+
+// initSchemas creates the schema of each kind of metric.
+func (g *Gateway) initSchemas() error {
+	hb := g.interval * 2
+	count, err := rrd.NewBoundedDS(rrd.Absolute, "count", hb, rrd.Bound(0), rrd.Unbounded)
+	if err != nil {
+		return err
+	}
+	value, err := rrd.NewBoundedDS(rrd.Gauge, "value", hb, rrd.Unbounded, rrd.Unbounded)
+	if err != nil {
+		return err
+	}
+	unique, err := rrd.NewBoundedDS(rrd.Gauge, "count", hb, rrd.Bound(0), rrd.Unbounded)
+	if err != nil {
+		return err
+	}
+
+	timerDS := []rrd.DS{count}
+	for _, n := range g.timerStats() {
+		ds, err := rrd.NewBoundedDS(rrd.Gauge, n, hb, rrd.Unbounded, rrd.Unbounded)
+		if err != nil {
+			return err
+		}
+		timerDS = append(timerDS, ds)
+	}
+
+	rra := rras(g.interval)
+	g.schemas = map[Kind]*rrd.Schema{
+		Counter: {Step: g.interval, DS: []rrd.DS{count}, RRA: rra},
+		Gauge:   {Step: g.interval, DS: []rrd.DS{value}, RRA: rra},
+		Set:     {Step: g.interval, DS: []rrd.DS{unique}, RRA: rra},
+		Timer:   {Step: g.interval, DS: timerDS, RRA: rra},
+	}
+
+	return nil
+}
+
+// timerStats returns the names of the data sources of a timer after count.
+func (g *Gateway) timerStats() []string {
+	names := []string{"mean", "lower", "upper"}
+	for _, p := range g.percentiles {
+		names = append(names, percentileName(p))
+	}
+	return names
+}
+
+// percentileName returns the data source name of the percentile p.
+func percentileName(p float64) string {
+	return "p" + strings.Replace(strconv.FormatFloat(p, 'f', -1, 64), ".", "_", 1)
+}
+
+// rras returns the RRAs which store averages for a day at step, a week at
+// five minutes and a year at one hour, as well as the hourly maximum for a year.
+func rras(step time.Duration) []rrd.RRA {
+	steps := func(d time.Duration) int {
+		if n := int(d / step); n > 1 {
+			return n
+		}
+		return 1
+	}
+	rows := func(d, res time.Duration) int {
+		return int(d / (time.Duration(steps(res)) * step))
+	}
+
+	day, week, year := time.Hour*24, time.Hour*24*7, time.Hour*24*365
+	return []rrd.RRA{
+		rrd.NewAverage(0.5, 1, rows(day, step)),
+		rrd.NewAverage(0.5, steps(time.Minute*5), rows(week, time.Minute*5)),
+		rrd.NewAverage(0.5, steps(time.Hour), rows(year, time.Hour)),
+		rrd.NewMax(0.5, steps(time.Hour), rows(year, time.Hour)),
+	}
+}
+
+// run flushes the aggregated metrics every interval until closed.
+func (g *Gateway) run() {
+	defer g.wg.Done()
+
+	t := time.NewTicker(g.interval)
+	defer t.Stop()
+	for {
+		select {
+		case <-t.C:
+			g.Flush() // nolint: errcheck
+		case <-g.done:
+			return
+		}
+	}
+}
+
+// ListenAndServe listens on the UDP network address addr and then calls Serve.
+func (g *Gateway) ListenAndServe(addr string) error {
+	pc, err := net.ListenPacket("udp", addr)
+	if err != nil {
+		return err
+	}
+
+	return g.Serve(pc)
+}
+
+// Serve processes the packets received on pc until the Gateway is closed.
+// It always returns a non-nil error, ErrGatewayClosed after Close.
+func (g *Gateway) Serve(pc net.PacketConn) error {
+	if !g.track(pc) {
+		pc.Close() // nolint: errcheck
+		return ErrGatewayClosed
+	}
+	defer g.untrack(pc)
+
+	buf := make([]byte, maxPacketSize)
+	for {
+		n, _, err := pc.ReadFrom(buf)
+		if err != nil {
+			if !g.running() {
+				return ErrGatewayClosed
+			}
+			return err
+		}
+
+		g.Process(buf[:n])
+	}
+}
+
+// track records c so it's closed by Close, returning false if the gateway is already closed.
+func (g *Gateway) track(c io.Closer) bool {
+	g.closeMtx.Lock()
+	defer g.closeMtx.Unlock()
+
+	if !g.running() {
+		return false
+	}
+	g.closers[c] = struct{}{}
+
+	return true
+}
+
+// untrack removes c from the tracked closers.
+func (g *Gateway) untrack(c io.Closer) {
+	g.closeMtx.Lock()
+	delete(g.closers, c)
+	g.closeMtx.Unlock()
+}
+
+// running returns true unless Close has been called, false otherwise.
+func (g *Gateway) running() bool {
+	select {
+	case <-g.done:
+		return false
+	default:
+		return true
+	}
+}
+
+// report calls the OnError handler, if set, with err.
+func (g *Gateway) report(err error) {
+	if g.onError != nil {
+		g.onError(err)
+	}
+}
+
+// Process aggregates the metrics in packet, which contains StatsD lines
+// separated by new lines. Invalid lines are reported to the OnError handler.
+func (g *Gateway) Process(packet []byte) {
+	for _, l := range strings.Split(string(packet), "\n") {
+		l = strings.TrimSpace(l)
+		if l == "" {
+			continue
+		}
+
+		if err := g.processLine(l); err != nil {
+			g.report(err)
+		}
+	}
+}
+
+// sample is a parsed StatsD line.
+type sample struct {
+	name  string
+	kind  Kind
+	value string
+	rate  float64
+}
+
+// parseLine parses a StatsD line of the form name:value|type[|@rate][|#tags].
+// Tags are ignored.
+func parseLine(line string) (*sample, error) {
+	i := strings.Index(line, ":")
+	if i < 1 {
+		return nil, &LineError{Line: line, Msg: "missing value"}
+	}
+
+	name := sanitize(line[:i])
+	for _, p := range strings.Split(name, ".") {
+		if p == "" {
+			return nil, &LineError{Line: line, Msg: "invalid name"}
+		}
+	}
+
+	fields := strings.Split(line[i+1:], "|")
+	if len(fields) < 2 {
+		return nil, &LineError{Line: line, Msg: "missing type"}
+	}
+
+	kind, ok := kinds[fields[1]]
+	if !ok {
+		return nil, &LineError{Line: line, Msg: "invalid type"}
+	}
+
+	s := &sample{name: name, kind: kind, value: fields[0], rate: 1}
+	for _, f := range fields[2:] {
+		switch {
+		case strings.HasPrefix(f, "@"):
+			r, err := strconv.ParseFloat(f[1:], 64)
+			if err != nil || !(r > 0 && r <= 1) {
+				return nil, &LineError{Line: line, Msg: "invalid sample rate"}
+			}
+			s.rate = r
+		case strings.HasPrefix(f, "#"):
+		default:
+			return nil, &LineError{Line: line, Msg: "invalid field"}
+		}
+	}
+
+	if s.value == "" {
+		return nil, &LineError{Line: line, Msg: "missing value"}
+	}
+
+	return s, nil
+}
+
+// sanitize returns name with white space replaced by _, / by - and any
+// other characters not in [a-zA-Z0-9_.-] removed, as done by StatsD.
+func sanitize(name string) string {
+	return strings.Map(func(r rune) rune {
+		switch {
+		case r == ' ' || r == '\t':
+			return '_'
+		case r == '/':
+			return '-'
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9', r == '_', r == '.', r == '-':
+			return r
+		}
+		return -1
+	}, name)
+}
+
+// processLine aggregates the metric in line.
+func (g *Gateway) processLine(line string) error {
+	s, err := parseLine(line)
+	if err != nil {
+		return err
+	}
+
+	if s.kind == Set {
+		g.mtx.Lock()
+		set, ok := g.sets[s.name]
+		if !ok {
+			set = make(map[string]struct{})
+			g.sets[s.name] = set
+		}
+		set[s.value] = struct{}{}
+		g.mtx.Unlock()
+		return nil
+	}
+
+	v, err := strconv.ParseFloat(s.value, 64)
+	if err != nil || math.IsNaN(v) || math.IsInf(v, 0) {
+		return &LineError{Line: line, Msg: "invalid value"}
+	}
+
+	g.mtx.Lock()
+	defer g.mtx.Unlock()
+
+	switch s.kind {
+	case Counter:
+		g.counters[s.name] += v / s.rate
+	case Gauge:
+		if s.value[0] == '+' || s.value[0] == '-' {
+			g.gauges[s.name] += v
+		} else {
+			g.gauges[s.name] = v
+		}
+	case Timer:
+		t, ok := g.timers[s.name]
+		if !ok {
+			t = &timer{}
+			g.timers[s.name] = t
+		}
+		t.count += 1 / s.rate
+		t.values = append(t.values, v)
+	}
+
+	return nil
+}
+
+// point is the aggregated value of a metric for a flush.
+type point struct {
+	key
+	values []interface{}
+}
+
+// take returns the aggregated metrics, resetting them for the next interval.
+func (g *Gateway) take() []point {
+	g.mtx.Lock()
+	defer g.mtx.Unlock()
+
+	var points []point
+	for n, v := range g.counters {
+		points = append(points, point{key{Counter, n}, []interface{}{v}})
+		g.counters[n] = 0
+	}
+	for n, v := range g.gauges {
+		points = append(points, point{key{Gauge, n}, []interface{}{v}})
+	}
+	for n, s := range g.sets {
+		points = append(points, point{key{Set, n}, []interface{}{len(s)}})
+		if len(s) > 0 {
+			g.sets[n] = make(map[string]struct{})
+		}
+	}
+	for n, t := range g.timers {
+		points = append(points, point{key{Timer, n}, timerValues(t, g.percentiles)})
+		g.timers[n] = &timer{}
+	}
+
+	sort.Slice(points, func(i, j int) bool {
+		if points[i].kind != points[j].kind {
+			return points[i].kind < points[j].kind
+		}
+		return points[i].name < points[j].name
+	})
+
+	return points
+}
+
+// timerValues returns the values of the data sources of a timer's RRD.
+// Percentiles are calculated as by StatsD, nil values are unknown.
+func timerValues(t *timer, percentiles []float64) []interface{} {
+	vals := make([]interface{}, 0, len(percentiles)+4)
+	vals = append(vals, t.count)
+	n := len(t.values)
+	if n == 0 {
+		for i := 0; i < len(percentiles)+3; i++ {
+			vals = append(vals, nil)
+		}
+		return vals
+	}
+
+	sort.Float64s(t.values)
+	var sum float64
+	for _, v := range t.values {
+		sum += v
+	}
+	vals = append(vals, sum/float64(n), t.values[0], t.values[n-1])
+
+	for _, p := range percentiles {
+		i := n
+		if n > 1 {
+			i = int(math.Floor(p/100*float64(n) + 0.5))
+		}
+		if i == 0 {
+			vals = append(vals, nil)
+			continue
+		}
+		vals = append(vals, t.values[i-1])
+	}
+
+	return vals
+}
+
+// Flush writes the aggregated metrics to rrdcached.
+func (g *Gateway) Flush() error {
+	ctx, cancel := context.WithTimeout(context.Background(), g.timeout)
+	defer cancel()
+
+	return g.FlushContext(ctx)
+}
+
+// FlushContext writes the aggregated metrics to rrdcached, timestamped with
+// the current time. Failures for individual metrics are reported to the
+// OnError handler, in addition if the batch as a whole failed its error is returned.
+//
+// RRDs can only be updated once a second, so if the last flush was in the same
+// second nothing is written and the metrics are kept for the next flush.
+func (g *Gateway) FlushContext(ctx context.Context) error {
+	return g.flush(ctx, time.Now())
+}
+
+// flush writes the aggregated metrics to rrdcached, timestamped with ts.
+func (g *Gateway) flush(ctx context.Context, ts time.Time) error {
+	g.flushMtx.Lock()
+	defer g.flushMtx.Unlock()
+
+	if ts.Unix() == g.last.Unix() {
+		return nil
+	}
+	g.last = ts
+
+	var files []string
+	var updates []rrd.Update
+	var cmds []*rrd.Cmd
+	for _, p := range g.take() {
+		f := g.filename(p.kind, p.name)
+		if !ingest.ValidFilename(f) {
+			g.report(&CreateError{Metric: p.metric(), Filename: f, Err: errors.New("invalid filename")})
+			continue
+		}
+
+		if err := g.creator.Create(ctx, f, g.schemas[p.kind], ts); err != nil {
+			g.report(&CreateError{Metric: p.metric(), Filename: f, Err: err})
+			continue
+		}
+
+		u, err := rrd.NewUpdateBuilder().Update(ts, p.values...)
+		if err != nil {
+			g.report(&rrd.WriteError{Filename: f, Err: err})
+			continue
+		}
+
+		files = append(files, f)
+		updates = append(updates, u)
+		cmds = append(cmds, rrd.NewCmd("update").WithArgs(f, u))
+	}
+
+	if len(cmds) == 0 {
+		return nil
+	}
+
+	r, err := g.c.ExecBatchContext(ctx, cmds...)
+	if err != nil {
+		for i, f := range files {
+			g.report(&rrd.WriteError{Filename: f, Updates: updates[i : i+1], Err: err})
+		}
+		return err
+	}
+
+	for _, e := range r.Errors {
+		g.report(&rrd.WriteError{Filename: files[e.Index], Updates: updates[e.Index : e.Index+1], Err: e})
+	}
+
+	return nil
+}
+
+// Close stops the gateway, closing all listeners and writing the aggregated
+// metrics, unless the last flush was in the same second as described by
+// FlushContext. It doesn't close the underlying Client.
+func (g *Gateway) Close() error {
+	g.closeMtx.Lock()
+	if !g.running() {
+		g.closeMtx.Unlock()
+		return ErrGatewayClosed
+	}
+	close(g.done)
+
+	for c := range g.closers {
+		c.Close() // nolint: errcheck
+	}
+	g.closeMtx.Unlock()
+
+	g.wg.Wait()
+
+	return g.Flush()
+}
@@ -0,0 +1,286 @@
+package statsd
+
+import (
+	"context"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/multiplay/go-rrd"
+	"github.com/multiplay/go-rrd/internal/testserver"
+	"github.com/stretchr/testify/assert"
+)
+
+var testStart = time.Unix(1500000000, 0)
+
+// newTestGateway returns a new Gateway writing to a running in-tree server and a client connected to it.
+func newTestGateway(t *testing.T, options ...func(g *Gateway) error) (*Gateway, *rrd.Client, func()) {
+	t.Helper()
+
+	p, c, cleanup := testserver.Start(t)
+	g, err := New(p, options...)
+	if err != nil {
+		cleanup()
+		t.Fatal(err)
+	}
+
+	return g, c, func() {
+		g.Close() // nolint: errcheck
+		cleanup()
+	}
+}
+
+func TestParseLine(t *testing.T) {
+	tests := []struct {
+		line   string
+		sample *sample
+	}{
+		{"app.requests:1|c", &sample{name: "app.requests", kind: Counter, value: "1", rate: 1}},
+		{"app.requests:2|c|@0.5", &sample{name: "app.requests", kind: Counter, value: "2", rate: 0.5}},
+		{"app.load:-1.5|g|#env:prod", &sample{name: "app.load", kind: Gauge, value: "-1.5", rate: 1}},
+		{"app.time:320|ms", &sample{name: "app.time", kind: Timer, value: "320", rate: 1}},
+		{"app.size:10|h|@0.1|#a:b", &sample{name: "app.size", kind: Timer, value: "10", rate: 0.1}},
+		{"app.users:bob|s", &sample{name: "app.users", kind: Set, value: "bob", rate: 1}},
+		{"my app/x$:1|c", &sample{name: "my_app-x", kind: Counter, value: "1", rate: 1}},
+		{"app", nil},
+		{":1|c", nil},
+		{"a..b:1|c", nil},
+		{"app:1", nil},
+		{"app:|c", nil},
+		{"app:1|x", nil},
+		{"app:1|c|@2", nil},
+		{"app:1|c|@x", nil},
+		{"app:1|c|x", nil},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.line, func(t *testing.T) {
+			s, err := parseLine(tc.line)
+			if tc.sample == nil {
+				assert.IsType(t, &LineError{}, err)
+				return
+			}
+			if assert.NoError(t, err) {
+				assert.Equal(t, tc.sample, s)
+			}
+		})
+	}
+}
+
+func TestTimerValues(t *testing.T) {
+	tests := []struct {
+		name        string
+		timer       *timer
+		percentiles []float64
+		expected    []interface{}
+	}{
+		{
+			name:        "empty",
+			timer:       &timer{},
+			percentiles: []float64{90},
+			expected:    []interface{}{0.0, nil, nil, nil, nil},
+		},
+		{
+			name:        "single",
+			timer:       &timer{count: 1, values: []float64{5}},
+			percentiles: []float64{50, 90},
+			expected:    []interface{}{1.0, 5.0, 5.0, 5.0, 5.0, 5.0},
+		},
+		{
+			name:        "many",
+			timer:       &timer{count: 20, values: []float64{10, 2, 8, 4, 6, 1, 3, 5, 7, 9}},
+			percentiles: []float64{50, 90, 1},
+			expected:    []interface{}{20.0, 5.5, 1.0, 10.0, 5.0, 9.0, nil},
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.Equal(t, tc.expected, timerValues(tc.timer, tc.percentiles))
+		})
+	}
+}
+
+func TestRRAs(t *testing.T) {
+	expected := []rrd.RRA{
+		rrd.NewAverage(0.5, 1, 8640),
+		rrd.NewAverage(0.5, 30, 2016),
+		rrd.NewAverage(0.5, 360, 8760),
+		rrd.NewMax(0.5, 360, 8760),
+	}
+	assert.Equal(t, expected, rras(time.Second*10))
+
+	expected = []rrd.RRA{
+		rrd.NewAverage(0.5, 1, 144),
+		rrd.NewAverage(0.5, 1, 1008),
+		rrd.NewAverage(0.5, 6, 8760),
+		rrd.NewMax(0.5, 6, 8760),
+	}
+	assert.Equal(t, expected, rras(time.Minute*10))
+}
+
+func TestNew(t *testing.T) {
+	tests := map[string]func(g *Gateway) error{
+		"nil":                  nil,
+		"flush-interval-short": FlushInterval(time.Millisecond),
+		"flush-interval-frac":  FlushInterval(time.Millisecond * 1500),
+		"percentile-zero":      Percentiles(0),
+		"percentile-100":       Percentiles(100),
+		"percentile-duplicate": Percentiles(90, 90.0),
+		"percentile-long-name": Percentiles(0.00001234567890123),
+		"timeout":              Timeout(0),
+		"filename":             Filename(nil),
+	}
+
+	for name, f := range tests {
+		_, err := New(nil, f)
+		assert.Error(t, err, name)
+	}
+
+	g, err := New(nil, Percentiles(50, 99.9))
+	if assert.NoError(t, err) {
+		assert.Len(t, g.schemas[Timer].DS, 6)
+		assert.Equal(t, rrd.DS("DS:p99_9:GAUGE:20:U:U"), g.schemas[Timer].DS[5])
+		assert.Equal(t, rrd.DS("DS:count:ABSOLUTE:20:0:U"), g.schemas[Counter].DS[0])
+		assert.NoError(t, g.Close())
+		assert.Equal(t, ErrGatewayClosed, g.Close())
+	}
+}
+
+func TestGateway(t *testing.T) {
+	var mtx sync.Mutex
+	var errs []error
+	onError := OnError(func(err error) {
+		mtx.Lock()
+		errs = append(errs, err)
+		mtx.Unlock()
+	})
+
+	g, c, cleanup := newTestGateway(t, onError, FlushInterval(time.Minute))
+	defer cleanup()
+
+	g.Process([]byte("app.requests:1|c\napp.requests:2|c|@0.5\n\napp.load:5|g\napp.load:-2|g\n" +
+		"app.users:bob|s\napp.users:alice|s\napp.users:bob|s\napp.time:10|ms\napp.time:30|ms\ninvalid"))
+
+	ctx := context.Background()
+	if !assert.NoError(t, g.flush(ctx, testStart)) {
+		return
+	}
+
+	mtx.Lock()
+	if assert.Len(t, errs, 1) {
+		assert.IsType(t, &LineError{}, errs[0])
+	}
+	errs = nil
+	mtx.Unlock()
+
+	lastDS := func(filename string) map[string]string {
+		info, err := c.RRDInfo(filename)
+		if !assert.NoError(t, err, filename) {
+			return nil
+		}
+		assert.Equal(t, time.Minute, info.Step, filename)
+		assert.True(t, testStart.Equal(info.LastUpdate), filename)
+
+		vals := make(map[string]string)
+		for _, ds := range info.DS {
+			vals[ds.Name+" "+ds.Type] = ds.LastDS
+		}
+		return vals
+	}
+
+	assert.Equal(t, map[string]string{"count ABSOLUTE": "5"}, lastDS("counters/app/requests.rrd"))
+	assert.Equal(t, map[string]string{"value GAUGE": "3"}, lastDS("gauges/app/load.rrd"))
+	assert.Equal(t, map[string]string{"count GAUGE": "2"}, lastDS("sets/app/users.rrd"))
+	assert.Equal(t, map[string]string{
+		"count ABSOLUTE": "2",
+		"mean GAUGE":     "20",
+		"lower GAUGE":    "10",
+		"upper GAUGE":    "30",
+		"p90 GAUGE":      "30",
+	}, lastDS("timers/app/time.rrd"))
+
+	// Idle metrics are written with counters and sets reset and gauges retained.
+	ts := testStart.Add(time.Minute)
+	if !assert.NoError(t, g.flush(ctx, ts)) {
+		return
+	}
+
+	info, err := c.RRDInfo("counters/app/requests.rrd")
+	if assert.NoError(t, err) {
+		assert.True(t, ts.Equal(info.LastUpdate))
+		assert.Equal(t, "0", info.DS[0].LastDS)
+	}
+	info, err = c.RRDInfo("gauges/app/load.rrd")
+	if assert.NoError(t, err) {
+		assert.Equal(t, "3", info.DS[0].LastDS)
+	}
+	info, err = c.RRDInfo("timers/app/time.rrd")
+	if assert.NoError(t, err) {
+		assert.Equal(t, "0", info.DS[0].LastDS)
+		assert.Equal(t, "U", info.DS[1].LastDS)
+	}
+
+	// A flush in the same second is skipped, keeping the metrics.
+	g.Process([]byte("app.requests:1|c"))
+	assert.NoError(t, g.flush(ctx, ts.Add(time.Millisecond*500)))
+	mtx.Lock()
+	assert.Empty(t, errs)
+	mtx.Unlock()
+	g.mtx.Lock()
+	assert.Equal(t, float64(1), g.counters["app.requests"])
+	g.mtx.Unlock()
+
+	// A failed update is reported.
+	assert.NoError(t, g.flush(ctx, ts.Add(-time.Second*30)))
+
+	mtx.Lock()
+	if assert.Len(t, errs, 4) {
+		assert.IsType(t, &rrd.WriteError{}, errs[0])
+	}
+	mtx.Unlock()
+}
+
+func TestGatewayServe(t *testing.T) {
+	g, c, cleanup := newTestGateway(t)
+	defer cleanup()
+
+	pc, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if !assert.NoError(t, err) {
+		return
+	}
+	go g.Serve(pc) // nolint: errcheck
+
+	conn, err := net.Dial("udp", pc.LocalAddr().String())
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer conn.Close() // nolint: errcheck
+
+	// Packets are processed asynchronously and may be dropped.
+	deadline := time.Now().Add(time.Second * 5)
+	for {
+		_, err = conn.Write([]byte("app.requests:1|c"))
+		assert.NoError(t, err)
+		time.Sleep(time.Millisecond * 10)
+
+		g.mtx.Lock()
+		n := g.counters["app.requests"]
+		g.mtx.Unlock()
+		if n > 0 {
+			break
+		}
+		if time.Now().After(deadline) {
+			assert.Fail(t, "packet not processed")
+			return
+		}
+	}
+
+	if !assert.NoError(t, g.Flush()) {
+		return
+	}
+
+	_, err = c.Last("counters/app/requests.rrd")
+	assert.NoError(t, err)
+}
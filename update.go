@@ -2,6 +2,9 @@ package rrd
 
 import (
 	"fmt"
+	"math"
+	"reflect"
+	"strconv"
 	"strings"
 	"time"
 )
@@ -32,3 +35,146 @@ func NewUpdate(ts time.Time, val interface{}, values ...interface{}) Update {
 	}
 	return NewUpdateRaw(fmt.Sprintf("%v:%v", ts.Unix(), strings.Join(parts, ":")))
 }
+
+// UpdateBuilder builds Updates from typed values, mapping nil and NaN values
+// to U (unknown).
+//
+// Values may be float64, float32, any integer type or a pointer to one of
+// those, where a nil pointer is unknown.
+type UpdateBuilder struct {
+	names        []string
+	index        map[string]int
+	milliseconds bool
+}
+
+// NewUpdateBuilder returns a new UpdateBuilder.
+func NewUpdateBuilder() *UpdateBuilder {
+	return &UpdateBuilder{}
+}
+
+// WithNames sets the names of the data sources of the RRD in order, as
+// required by UpdateNamed, and returns the UpdateBuilder.
+func (b *UpdateBuilder) WithNames(names ...string) *UpdateBuilder {
+	b.names = names
+	b.index = make(map[string]int, len(names))
+	for i, n := range names {
+		b.index[n] = i
+	}
+	return b
+}
+
+// WithMilliseconds sets the UpdateBuilder to use timestamps with millisecond
+// precision, as fractional seconds, and returns the UpdateBuilder.
+func (b *UpdateBuilder) WithMilliseconds() *UpdateBuilder {
+	b.milliseconds = true
+	return b
+}
+
+// Update returns a new Update with the given ts, the current time if zero,
+// for values in data source order.
+func (b *UpdateBuilder) Update(ts time.Time, values ...interface{}) (Update, error) {
+	if len(values) == 0 {
+		return "", fmt.Errorf("update: no values")
+	}
+
+	if b.names != nil && len(values) != len(b.names) {
+		return "", fmt.Errorf("update: %v values for %v data sources", len(values), len(b.names))
+	}
+
+	parts := make([]string, len(values)+1)
+	parts[0] = b.timestamp(ts)
+	for i, v := range values {
+		s, err := updateValue(v)
+		if err != nil {
+			return "", fmt.Errorf("update: value %v: %v", i, err)
+		}
+		parts[i+1] = s
+	}
+
+	return Update(strings.Join(parts, ":")), nil
+}
+
+// UpdateNamed returns a new Update with the given ts, the current time if zero,
+// for values keyed by data source name. The names must have been set with
+// WithNames, data sources without a value are unknown.
+func (b *UpdateBuilder) UpdateNamed(ts time.Time, values map[string]interface{}) (Update, error) {
+	if b.names == nil {
+		return "", fmt.Errorf("update: no data source names")
+	}
+
+	vals := make([]interface{}, len(b.names))
+	for n, v := range values {
+		i, ok := b.index[n]
+		if !ok {
+			return "", fmt.Errorf("update: unknown data source %q", n)
+		}
+		vals[i] = v
+	}
+
+	return b.Update(ts, vals...)
+}
+
+// timestamp returns the update timestamp for ts.
+func (b *UpdateBuilder) timestamp(ts time.Time) string {
+	if ts.IsZero() {
+		ts = time.Now()
+	}
+
+	if b.milliseconds {
+		return fmt.Sprintf("%d.%03d", ts.Unix(), ts.Nanosecond()/int(time.Millisecond))
+	}
+	return strconv.FormatInt(ts.Unix(), 10)
+}
+
+// updateValue returns v formatted as an update value.
+func updateValue(v interface{}) (string, error) {
+	switch v := v.(type) {
+	case nil:
+		return "U", nil
+	case float64:
+		return updateFloat(v), nil
+	case float32:
+		return updateFloat(float64(v)), nil
+	case int:
+		return strconv.FormatInt(int64(v), 10), nil
+	case int8:
+		return strconv.FormatInt(int64(v), 10), nil
+	case int16:
+		return strconv.FormatInt(int64(v), 10), nil
+	case int32:
+		return strconv.FormatInt(int64(v), 10), nil
+	case int64:
+		return strconv.FormatInt(v, 10), nil
+	case uint:
+		return strconv.FormatUint(uint64(v), 10), nil
+	case uint8:
+		return strconv.FormatUint(uint64(v), 10), nil
+	case uint16:
+		return strconv.FormatUint(uint64(v), 10), nil
+	case uint32:
+		return strconv.FormatUint(uint64(v), 10), nil
+	case uint64:
+		return strconv.FormatUint(v, 10), nil
+	}
+
+	// Pointers are unknown if nil, otherwise the value they point to.
+	rv := reflect.ValueOf(v)
+	if rv.Kind() == reflect.Ptr {
+		if rv.IsNil() {
+			return "U", nil
+		}
+		if s, err := updateValue(rv.Elem().Interface()); err == nil {
+			return s, nil
+		}
+	}
+
+	return "", fmt.Errorf("unsupported type %T", v)
+}
+
+// updateFloat returns v formatted as an update value, NaN is unknown.
+func updateFloat(v float64) string {
+	if math.IsNaN(v) {
+		return "U"
+	}
+	return strconv.FormatFloat(v, 'f', -1, 64)
+}
@@ -1,6 +1,7 @@
 package rrd
 
 import (
+	"math"
 	"strconv"
 	"strings"
 	"testing"
@@ -47,3 +48,68 @@ func TestUpdate(t *testing.T) {
 		})
 	}
 }
+
+func TestUpdateBuilder(t *testing.T) {
+	ts := time.Unix(1499995020, 123456789)
+	f := 1.5
+	i := int64(7)
+	var nilf *float64
+
+	tests := []struct {
+		name   string
+		b      *UpdateBuilder
+		values []interface{}
+		expect Update
+	}{
+		{"floats", NewUpdateBuilder(), []interface{}{0.3, float32(0.5), f}, "1499995020:0.3:0.5:1.5"},
+		{"ints", NewUpdateBuilder(), []interface{}{10, int8(-1), int32(3), uint(4), uint64(5)}, "1499995020:10:-1:3:4:5"},
+		{"unknown", NewUpdateBuilder(), []interface{}{math.NaN(), nil, nilf, float32(math.NaN())}, "1499995020:U:U:U:U"},
+		{"pointers", NewUpdateBuilder(), []interface{}{&f, &i}, "1499995020:1.5:7"},
+		{"large", NewUpdateBuilder(), []interface{}{1e21}, "1499995020:1000000000000000000000"},
+		{"milliseconds", NewUpdateBuilder().WithMilliseconds(), []interface{}{1}, "1499995020.123:1"},
+		{"names", NewUpdateBuilder().WithNames("a", "b"), []interface{}{1, 2}, "1499995020:1:2"},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			u, err := tc.b.Update(ts, tc.values...)
+			if assert.NoError(t, err) {
+				assert.Equal(t, tc.expect, u)
+			}
+		})
+	}
+
+	now := time.Now().Unix()
+	u, err := NewUpdateBuilder().Update(time.Time{}, 1)
+	if assert.NoError(t, err) {
+		parts := strings.Split(string(u), ":")
+		v, err := strconv.ParseInt(parts[0], 10, 64)
+		assert.NoError(t, err)
+		assert.True(t, v >= now)
+	}
+
+	_, err = NewUpdateBuilder().Update(ts)
+	assert.Error(t, err)
+
+	_, err = NewUpdateBuilder().Update(ts, "1")
+	assert.Error(t, err)
+
+	_, err = NewUpdateBuilder().WithNames("a", "b").Update(ts, 1)
+	assert.Error(t, err)
+}
+
+func TestUpdateBuilderNamed(t *testing.T) {
+	ts := time.Unix(1499995020, 0)
+	b := NewUpdateBuilder().WithNames("watts", "amps", "volts")
+
+	u, err := b.UpdateNamed(ts, map[string]interface{}{"volts": 240, "watts": 1200.5})
+	if assert.NoError(t, err) {
+		assert.Equal(t, Update("1499995020:1200.5:U:240"), u)
+	}
+
+	_, err = b.UpdateNamed(ts, map[string]interface{}{"bogus": 1})
+	assert.Error(t, err)
+
+	_, err = NewUpdateBuilder().UpdateNamed(ts, map[string]interface{}{"watts": 1})
+	assert.Error(t, err)
+}
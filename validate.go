@@ -0,0 +1,288 @@
+package rrd
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// maxFailuresWindow is the maximum window length of a FAILURES RRA.
+const maxFailuresWindow = 28
+
+// DSError represents a problem with a data source definition.
+type DSError struct {
+	// Index is the index of DS in the data sources.
+	Index int
+	DS    DS
+	Msg   string
+}
+
+func (e *DSError) Error() string {
+	return fmt.Sprintf("ds %v %q: %v", e.Index, e.DS, e.Msg)
+}
+
+// RRAError represents a problem with a round robin archive definition.
+type RRAError struct {
+	// Index is the index of RRA in the round robin archives.
+	Index int
+	RRA   RRA
+	Msg   string
+}
+
+func (e *RRAError) Error() string {
+	return fmt.Sprintf("rra %v %q: %v", e.Index, e.RRA, e.Msg)
+}
+
+// CreateOptionError represents a problem with a create option.
+type CreateOptionError struct {
+	Option CreateOption
+	Msg    string
+}
+
+func (e *CreateOptionError) Error() string {
+	return fmt.Sprintf("option %q: %v", e.Option, e.Msg)
+}
+
+// ValidationError is the error returned by Validate detailing all the problems
+// found, each of which is a *DSError, *RRAError, *CreateOptionError, ErrNoDS or ErrNoRRA.
+type ValidationError struct {
+	Errors []error
+}
+
+func (e *ValidationError) Error() string {
+	lines := make([]string, len(e.Errors))
+	for i, err := range e.Errors {
+		lines[i] = err.Error()
+	}
+	return fmt.Sprintf("invalid create: %v", strings.Join(lines, "; "))
+}
+
+// Validate checks the definition of an RRD as passed to Create, returning a
+// *ValidationError detailing all the problems found or nil if there are none.
+//
+// Data sources and RRAs are checked against the limits enforced by rrdtool,
+// including unique data source names and valid Holt-Winters RRA dependencies.
+// When a Template is used ds and rra may be empty.
+func Validate(ds []DS, rra []RRA, options ...CreateOption) error {
+	v := &validator{}
+	template := v.options(options)
+
+	if len(ds) == 0 && !template {
+		v.errs = append(v.errs, ErrNoDS)
+	}
+	if len(rra) == 0 && !template {
+		v.errs = append(v.errs, ErrNoRRA)
+	}
+
+	v.ds(ds)
+	v.rra(rra)
+
+	if len(v.errs) == 0 {
+		return nil
+	}
+	return &ValidationError{Errors: v.errs}
+}
+
+// validator collects the problems found by Validate.
+type validator struct {
+	errs []error
+}
+
+// options validates options, returning true if a template is used.
+func (v *validator) options(options []CreateOption) bool {
+	var template bool
+	for _, o := range options {
+		parts := strings.SplitN(string(o), " ", 2)
+		val := ""
+		if len(parts) == 2 {
+			val = strings.TrimSpace(parts[1])
+		}
+
+		var msg string
+		switch parts[0] {
+		case "-O", "--no-overwrite":
+			if val != "" {
+				msg = "unexpected value"
+			}
+		case "-s", "--step":
+			if s, err := strconv.ParseInt(val, 10, 64); err != nil || s < 1 {
+				msg = "step must be a positive number of seconds"
+			}
+		case "-b", "--start":
+			if _, err := strconv.ParseInt(val, 10, 64); err != nil {
+				msg = "start must be a number of seconds since the epoch"
+			}
+		case "-t", "--template":
+			template = true
+			if val == "" {
+				msg = "missing template file"
+			}
+		case "-r", "--source":
+			if val == "" {
+				msg = "missing source file"
+			}
+		default:
+			msg = "unsupported option"
+		}
+
+		if msg != "" {
+			v.errs = append(v.errs, &CreateOptionError{Option: o, Msg: msg})
+		}
+	}
+
+	return template
+}
+
+// ds validates the data sources ds.
+func (v *validator) ds(ds []DS) {
+	names := make(map[string]int)
+	for i, d := range ds {
+		add := func(format string, args ...interface{}) {
+			v.errs = append(v.errs, &DSError{Index: i, DS: d, Msg: fmt.Sprintf(format, args...)})
+		}
+
+		def, err := ParseDS(d)
+		if err != nil {
+			add("%v", err)
+			continue
+		}
+
+		if !dsNameRe.MatchString(def.Name) {
+			add("name must be 1 to 19 characters from [a-zA-Z0-9_]")
+		} else if j, ok := names[def.Name]; ok {
+			add("duplicate name, also used by ds %v", j)
+		} else {
+			names[def.Name] = i
+		}
+
+		if def.MappedName != "" && !dsNameRe.MatchString(def.MappedName) {
+			add("invalid mapped name %q", def.MappedName)
+		}
+
+		if def.Type == Compute {
+			if strings.TrimSpace(def.CDEF) == "" {
+				add("missing rpn expression")
+			}
+			continue
+		}
+
+		if def.Heartbeat < time.Second {
+			add("heartbeat must be at least 1s")
+		}
+
+		if def.Min >= def.Max {
+			add("min (%v) must be less than max (%v)", formatLimit(def.Min), formatLimit(def.Max))
+		}
+	}
+}
+
+// rraDependencies are the consolidation functions of the RRAs which each
+// Holt-Winters RRA may reference by index.
+var rraDependencies = map[string][]string{
+	HoltWintersPredict:          {Seasonal},
+	MultipliedHoltWinterPredict: {Seasonal},
+	Seasonal:                    {HoltWintersPredict, MultipliedHoltWinterPredict},
+	DevSeasonal:                 {HoltWintersPredict, MultipliedHoltWinterPredict},
+	DevPredict:                  {DevSeasonal},
+	Failures:                    {DevSeasonal},
+}
+
+// rra validates the round robin archives rra.
+func (v *validator) rra(rra []RRA) {
+	defs := make([]*RRADef, len(rra))
+	for i, r := range rra {
+		add := func(format string, args ...interface{}) {
+			v.errs = append(v.errs, &RRAError{Index: i, RRA: r, Msg: fmt.Sprintf(format, args...)})
+		}
+
+		def, err := ParseRRA(r)
+		if err != nil {
+			add("%v", err)
+			continue
+		}
+		defs[i] = def
+
+		if def.Rows < 1 {
+			add("rows must be at least 1")
+		}
+
+		switch def.CF {
+		case HoltWintersPredict, MultipliedHoltWinterPredict:
+			if !unitInterval(def.Alpha) {
+				add("alpha must be between 0 and 1")
+			}
+			if !unitInterval(def.Beta) {
+				add("beta must be between 0 and 1")
+			}
+			if def.SeasonalPeriod < 1 {
+				add("seasonal period must be at least 1")
+			}
+		case Seasonal, DevSeasonal:
+			if !unitInterval(def.Gamma) {
+				add("gamma must be between 0 and 1")
+			}
+			if !math.IsNaN(def.SmoothingWindow) && (def.SmoothingWindow < 0 || def.SmoothingWindow >= 1) {
+				add("smoothing window must be between 0 and 1")
+			}
+		case Failures:
+			if def.Window < 1 || def.Window > maxFailuresWindow {
+				add("window length must be between 1 and %v", maxFailuresWindow)
+			}
+			if def.Threshold < 1 || def.Threshold > def.Window {
+				add("threshold must be between 1 and the window length")
+			}
+		case DevPredict:
+		default:
+			if math.IsNaN(def.XFF) || def.XFF < 0 || def.XFF >= 1 {
+				add("xff must be at least 0 and less than 1")
+			}
+			if def.Steps < 1 {
+				add("steps must be at least 1")
+			}
+		}
+	}
+
+	// Dependencies are checked once all the RRAs are parsed.
+	for i, def := range defs {
+		if def == nil {
+			continue
+		}
+
+		deps, ok := rraDependencies[def.CF]
+		if !ok || (def.Index == 0 && (def.CF == HoltWintersPredict || def.CF == MultipliedHoltWinterPredict)) {
+			// rrdtool creates the dependent RRAs of HWPREDICT if no index is given.
+			continue
+		}
+
+		err := &RRAError{Index: i, RRA: rra[i]}
+		j := def.Index - 1
+		switch {
+		case j < 0 || j >= len(rra):
+			err.Msg = fmt.Sprintf("rra index %v doesn't exist", def.Index)
+		case j == i:
+			err.Msg = fmt.Sprintf("rra index %v references itself", def.Index)
+		case defs[j] != nil && !contains(deps, defs[j].CF):
+			err.Msg = fmt.Sprintf("rra index %v is %v not %v", def.Index, defs[j].CF, strings.Join(deps, " or "))
+		default:
+			continue
+		}
+		v.errs = append(v.errs, err)
+	}
+}
+
+// unitInterval returns true if v is between 0 and 1 exclusive.
+func unitInterval(v float64) bool {
+	return v > 0 && v < 1
+}
+
+// contains returns true if s contains v.
+func contains(s []string, v string) bool {
+	for _, s := range s {
+		if s == v {
+			return true
+		}
+	}
+	return false
+}
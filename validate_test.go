@@ -0,0 +1,117 @@
+package rrd
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestValidate(t *testing.T) {
+	gauge := NewGauge("watts", time.Minute*5, 0, 24000)
+	avg := NewAverage(0.5, 1, 100)
+
+	tests := []struct {
+		name    string
+		ds      []DS
+		rra     []RRA
+		options []CreateOption
+		errs    []error
+	}{
+		{name: "valid", ds: []DS{gauge}, rra: []RRA{avg}, options: []CreateOption{Step(time.Minute), Start(time.Unix(1, 0)), NoOverwrite()}},
+		{name: "compute", ds: []DS{gauge, NewCompute("kw", "watts,1000,/")}, rra: []RRA{avg}},
+		{name: "unbounded", ds: []DS{NewDS("DS:watts:GAUGE:300:U:U")}, rra: []RRA{avg}},
+		{name: "template", options: []CreateOption{Template("tmpl.rrd")}},
+		{
+			name: "holt-winters",
+			ds:   []DS{gauge},
+			rra: []RRA{
+				avg,
+				NewHWPredict(1440, 0.1, 0.0035, 288, 3),
+				NewSeasonal(288, 0.1, 2, 0.05),
+				NewDevSeasonal(288, 0.1, 2, 0.05),
+				NewDevPredict(1440, 4),
+				NewFailures(288, 7, 9, 4),
+			},
+		},
+		{name: "hwpredict-auto", ds: []DS{gauge}, rra: []RRA{NewRRA("RRA:HWPREDICT:1440:0.1:0.0035:288")}},
+		{name: "empty", errs: []error{ErrNoDS, ErrNoRRA}},
+		{
+			name: "ds",
+			ds: []DS{
+				NewGauge("a_very_long_data_source_name", time.Minute, 0, 1),
+				NewGauge("bad-name", time.Minute, 0, 1),
+				NewGauge("zero", 0, 0, 1),
+				NewGauge("minmax", time.Minute, 10, 1),
+				NewDS("DS:watts:BOGUS:300:0:1"),
+				gauge,
+				gauge,
+			},
+			rra: []RRA{avg},
+			errs: []error{
+				&DSError{Index: 0, DS: NewGauge("a_very_long_data_source_name", time.Minute, 0, 1), Msg: "name must be 1 to 19 characters from [a-zA-Z0-9_]"},
+				&DSError{Index: 1, DS: NewGauge("bad-name", time.Minute, 0, 1), Msg: "name must be 1 to 19 characters from [a-zA-Z0-9_]"},
+				&DSError{Index: 2, DS: NewGauge("zero", 0, 0, 1), Msg: "heartbeat must be at least 1s"},
+				&DSError{Index: 3, DS: NewGauge("minmax", time.Minute, 10, 1), Msg: "min (10) must be less than max (1)"},
+				&DSError{Index: 4, DS: NewDS("DS:watts:BOGUS:300:0:1"), Msg: "invalid DS type BOGUS: DS:watts:BOGUS:300:0:1"},
+				&DSError{Index: 6, DS: gauge, Msg: "duplicate name, also used by ds 5"},
+			},
+		},
+		{
+			name: "rra",
+			ds:   []DS{gauge},
+			rra: []RRA{
+				NewAverage(0.5, 1, 0),
+				NewMax(1, 0, 10),
+				NewHWPredict(1440, 0.1, 0.0035, 288, 9),
+				NewSeasonal(288, 0.1, 2, 0.05),
+				NewDevPredict(1440, 1),
+				NewFailures(288, 10, 30, 1),
+			},
+			errs: []error{
+				&RRAError{Index: 0, RRA: NewAverage(0.5, 1, 0), Msg: "rows must be at least 1"},
+				&RRAError{Index: 1, RRA: NewMax(1, 0, 10), Msg: "xff must be at least 0 and less than 1"},
+				&RRAError{Index: 1, RRA: NewMax(1, 0, 10), Msg: "steps must be at least 1"},
+				&RRAError{Index: 5, RRA: NewFailures(288, 10, 30, 1), Msg: "window length must be between 1 and 28"},
+				&RRAError{Index: 2, RRA: NewHWPredict(1440, 0.1, 0.0035, 288, 9), Msg: "rra index 9 doesn't exist"},
+				&RRAError{Index: 3, RRA: NewSeasonal(288, 0.1, 2, 0.05), Msg: "rra index 2 is MAX not HWPREDICT or MHWPREDICT"},
+				&RRAError{Index: 4, RRA: NewDevPredict(1440, 1), Msg: "rra index 1 is AVERAGE not DEVSEASONAL"},
+				&RRAError{Index: 5, RRA: NewFailures(288, 10, 30, 1), Msg: "rra index 1 is AVERAGE not DEVSEASONAL"},
+			},
+		},
+		{
+			name:    "options",
+			ds:      []DS{gauge},
+			rra:     []RRA{avg},
+			options: []CreateOption{Step(0), "-b now", Source(""), "--daemon x"},
+			errs: []error{
+				&CreateOptionError{Option: Step(0), Msg: "step must be a positive number of seconds"},
+				&CreateOptionError{Option: "-b now", Msg: "start must be a number of seconds since the epoch"},
+				&CreateOptionError{Option: Source(""), Msg: "missing source file"},
+				&CreateOptionError{Option: "--daemon x", Msg: "unsupported option"},
+			},
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			err := Validate(tc.ds, tc.rra, tc.options...)
+			if tc.errs == nil {
+				assert.NoError(t, err)
+				return
+			}
+
+			assert.Equal(t, &ValidationError{Errors: tc.errs}, err)
+		})
+	}
+}
+
+func TestValidationError(t *testing.T) {
+	err := &ValidationError{Errors: []error{
+		ErrNoRRA,
+		&DSError{Index: 1, DS: "DS:a", Msg: "bad"},
+		&RRAError{Index: 2, RRA: "RRA:b", Msg: "worse"},
+		&CreateOptionError{Option: "-x", Msg: "unsupported option"},
+	}}
+	assert.Equal(t, `invalid create: no round robin archives; ds 1 "DS:a": bad; rra 2 "RRA:b": worse; option "-x": unsupported option`, err.Error())
+}
@@ -0,0 +1,186 @@
+package rrd
+
+import (
+	"context"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// WalkFunc is the function called by Walk for each file and directory.
+//
+// The path is relative to the base directory of rrdcached, so can be passed
+// to other commands. If it returns filepath.SkipDir for a directory its
+// contents are skipped and for a file the remaining files in its directory
+// are skipped, any other error stops the walk and is returned by Walk.
+type WalkFunc func(path string, isDir bool) error
+
+// Walk walks the tree of files in the cache under root, which is / for the
+// base directory of rrdcached, calling fn for each file and directory in
+// lexical order, excluding root itself.
+//
+// If patterns are given only the files whose path relative to root matches
+// one of them, as reported by path.Match, and the directories containing them
+// are passed to fn. The listing is read before fn is first called, so fn may
+// use the client.
+func (c *Client) Walk(root string, fn WalkFunc, patterns ...string) error {
+	return c.WalkContext(context.Background(), root, fn, patterns...)
+}
+
+// WalkContext walks the tree of files in the cache under root, calling fn
+// for each file and directory. See Walk for details.
+func (c *Client) WalkContext(ctx context.Context, root string, fn WalkFunc, patterns ...string) error {
+	if err := checkPatterns(patterns); err != nil {
+		return err
+	}
+
+	files, err := c.ListContext(ctx, listPath(root), true)
+	if err != nil {
+		return err
+	}
+
+	return walk(root, files, fn, patterns)
+}
+
+// Stale returns the files in the cache under root matching patterns, as
+// for Walk, which haven't been updated for at least age.
+func (c *Client) Stale(root string, age time.Duration, patterns ...string) ([]string, error) {
+	return c.StaleContext(context.Background(), root, age, patterns...)
+}
+
+// StaleContext returns the files in the cache under root matching patterns,
+// as for Walk, which haven't been updated for at least age.
+func (c *Client) StaleContext(ctx context.Context, root string, age time.Duration, patterns ...string) ([]string, error) {
+	cutoff := time.Now().Add(-age)
+	var stale []string
+	err := c.WalkContext(ctx, root, func(path string, isDir bool) error {
+		if isDir {
+			return nil
+		}
+
+		last, err := c.LastContext(ctx, path)
+		if err != nil {
+			return err
+		}
+
+		if !last.After(cutoff) {
+			stale = append(stale, path)
+		}
+		return nil
+	}, patterns...)
+	if err != nil {
+		return nil, err
+	}
+
+	return stale, nil
+}
+
+// checkPatterns returns path.ErrBadPattern if any of patterns is malformed.
+func checkPatterns(patterns []string) error {
+	for _, p := range patterns {
+		if _, err := path.Match(p, ""); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// listPath returns the list command path for the walk root.
+func listPath(root string) string {
+	return path.Clean("/" + root)
+}
+
+// relPath returns p cleaned and relative to the base directory.
+func relPath(p string) string {
+	return strings.TrimPrefix(path.Clean("/"+p), "/")
+}
+
+// walkEntry is a file or directory found by walk.
+type walkEntry struct {
+	path  string
+	isDir bool
+}
+
+// walk calls fn for files listed under root, and the directories containing
+// them, as described by Walk. As returned by a recursive list of root, files
+// are relative to root.
+func walk(root string, files []string, fn WalkFunc, patterns []string) error {
+	base := relPath(root)
+	prefix := ""
+	if base != "" {
+		prefix = base + "/"
+	}
+
+	dirs := make(map[string]bool)
+	var entries []walkEntry
+	for _, f := range files {
+		rel := relPath(f)
+		if !matchAny(patterns, rel) {
+			continue
+		}
+
+		entries = append(entries, walkEntry{path: prefix + rel})
+		for d := path.Dir(rel); d != "."; d = path.Dir(d) {
+			if !dirs[d] {
+				dirs[d] = true
+				entries = append(entries, walkEntry{path: prefix + d, isDir: true})
+			}
+		}
+	}
+
+	sort.Slice(entries, func(i, j int) bool {
+		return pathLess(entries[i].path, entries[j].path)
+	})
+
+	var skip string
+	for _, e := range entries {
+		if skip != "" && strings.HasPrefix(e.path, skip) {
+			continue
+		}
+		skip = ""
+
+		err := fn(e.path, e.isDir)
+		switch {
+		case err == filepath.SkipDir && e.isDir:
+			skip = e.path + "/"
+		case err == filepath.SkipDir:
+			dir := path.Dir(e.path)
+			if dir+"/" == prefix || dir == "." {
+				return nil
+			}
+			skip = dir + "/"
+		case err != nil:
+			return err
+		}
+	}
+
+	return nil
+}
+
+// matchAny returns true if patterns is empty or p matches any of them.
+func matchAny(patterns []string, p string) bool {
+	if len(patterns) == 0 {
+		return true
+	}
+
+	for _, pattern := range patterns {
+		if ok, _ := path.Match(pattern, p); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// pathLess returns true if a sorts before b comparing their elements in turn,
+// so directories sort before their contents.
+func pathLess(a, b string) bool {
+	ae, be := strings.Split(a, "/"), strings.Split(b, "/")
+	for i := 0; i < len(ae) && i < len(be); i++ {
+		if ae[i] != be[i] {
+			return ae[i] < be[i]
+		}
+	}
+	return len(ae) < len(be)
+}
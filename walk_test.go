@@ -0,0 +1,193 @@
+package rrd
+
+import (
+	"errors"
+	"path"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// walked is an entry passed to a WalkFunc.
+type walked struct {
+	path  string
+	isDir bool
+}
+
+func TestWalk(t *testing.T) {
+	files := []string{
+		"/web2/cpu.rrd",
+		"web1/mem.rrd",
+		"/web1/cpu.rrd",
+		"load.rrd",
+		"web1/disk/sda.rrd",
+		"web1.old/cpu.rrd",
+	}
+
+	tests := []struct {
+		name     string
+		root     string
+		files    []string
+		patterns []string
+		skip     string
+		expect   []walked
+	}{
+		{
+			name:  "all",
+			root:  "/",
+			files: files,
+			expect: []walked{
+				{"load.rrd", false},
+				{"web1", true},
+				{"web1/cpu.rrd", false},
+				{"web1/disk", true},
+				{"web1/disk/sda.rrd", false},
+				{"web1/mem.rrd", false},
+				{"web1.old", true},
+				{"web1.old/cpu.rrd", false},
+				{"web2", true},
+				{"web2/cpu.rrd", false},
+			},
+		},
+		{
+			name:     "patterns",
+			root:     "",
+			files:    files,
+			patterns: []string{"*/cpu.rrd", "load.rrd"},
+			expect: []walked{
+				{"load.rrd", false},
+				{"web1", true},
+				{"web1/cpu.rrd", false},
+				{"web1.old", true},
+				{"web1.old/cpu.rrd", false},
+				{"web2", true},
+				{"web2/cpu.rrd", false},
+			},
+		},
+		{
+			name:  "skip-dir",
+			root:  "/",
+			files: files,
+			skip:  "web1",
+			expect: []walked{
+				{"load.rrd", false},
+				{"web1", true},
+				{"web1.old", true},
+				{"web1.old/cpu.rrd", false},
+				{"web2", true},
+				{"web2/cpu.rrd", false},
+			},
+		},
+		{
+			name:  "skip-file",
+			root:  "/",
+			files: files,
+			skip:  "web1/cpu.rrd",
+			expect: []walked{
+				{"load.rrd", false},
+				{"web1", true},
+				{"web1/cpu.rrd", false},
+				{"web1.old", true},
+				{"web1.old/cpu.rrd", false},
+				{"web2", true},
+				{"web2/cpu.rrd", false},
+			},
+		},
+		{
+			name:  "skip-top",
+			root:  "/",
+			files: files,
+			skip:  "load.rrd",
+			expect: []walked{
+				{"load.rrd", false},
+			},
+		},
+		{
+			name:     "root",
+			root:     "/web1/",
+			files:    []string{"mem.rrd", "disk/sda.rrd", "cpu.rrd"},
+			patterns: []string{"*.rrd"},
+			expect: []walked{
+				{"web1/cpu.rrd", false},
+				{"web1/mem.rrd", false},
+			},
+		},
+		{
+			name:  "root-repeated",
+			root:  "a",
+			files: []string{"a/x.rrd", "x.rrd"},
+			expect: []walked{
+				{"a/a", true},
+				{"a/a/x.rrd", false},
+				{"a/x.rrd", false},
+			},
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			var got []walked
+			err := walk(tc.root, tc.files, func(path string, isDir bool) error {
+				got = append(got, walked{path, isDir})
+				if path == tc.skip {
+					return filepath.SkipDir
+				}
+				return nil
+			}, tc.patterns)
+			if assert.NoError(t, err) {
+				assert.Equal(t, tc.expect, got)
+			}
+		})
+	}
+
+	errTest := errors.New("test")
+	var n int
+	err := walk("/", files, func(path string, isDir bool) error {
+		n++
+		return errTest
+	}, nil)
+	assert.Equal(t, errTest, err)
+	assert.Equal(t, 1, n)
+}
+
+func TestClientWalk(t *testing.T) {
+	s := newServer(t)
+	if s == nil {
+		return
+	}
+	defer func() {
+		assert.NoError(t, s.Close())
+	}()
+
+	c, err := NewClient(s.Addr)
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer func() {
+		assert.NoError(t, c.Close())
+	}()
+
+	var got []walked
+	err = c.Walk("/", func(path string, isDir bool) error {
+		got = append(got, walked{path, isDir})
+		return nil
+	})
+	if assert.NoError(t, err) {
+		assert.Equal(t, []walked{{"sub", true}, {"sub/other.rrd", false}, {"test.rrd", false}}, got)
+	}
+
+	assert.Equal(t, path.ErrBadPattern, c.Walk("/", func(string, bool) error { return nil }, "["))
+
+	// The mock server's last update is in 2017.
+	stale, err := c.Stale("/", time.Hour*24, "*.rrd")
+	if assert.NoError(t, err) {
+		assert.Equal(t, []string{"test.rrd"}, stale)
+	}
+
+	stale, err = c.Stale("/", time.Since(time.Unix(1499981700, 0))+time.Hour)
+	if assert.NoError(t, err) {
+		assert.Empty(t, stale)
+	}
+}
@@ -0,0 +1,291 @@
+package rrd
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+)
+
+var (
+	// DefaultFlushSize is the default number of buffered updates which triggers a Writer flush.
+	DefaultFlushSize = 1000
+
+	// DefaultFlushInterval is the default interval between Writer flushes.
+	DefaultFlushInterval = time.Second * 10
+)
+
+// maxCmdLen is the length, including the newline, which the commands sent by a
+// Writer are kept under, rrdcached rejects longer lines (RRD_CMD_MAX).
+const maxCmdLen = 4096
+
+// Batcher is the interface that wraps ExecBatchContext.
+// It's implemented by both Client and Pool.
+type Batcher interface {
+	ExecBatchContext(ctx context.Context, cmds ...*Cmd) (*BatchResult, error)
+}
+
+// WriteError represents the failure to write the updates for a file.
+//
+// Updates to the same file are merged into as few update commands as fit
+// within rrdcached's maximum command length, so failures are reported per
+// merged command: Updates contains all the updates which were merged, not just
+// the one rrdcached rejected. rrdcached processes the updates of a command in
+// order, so those before the rejected one may have been accepted.
+//
+// If rrdcached returned an error which couldn't be attributed to a command,
+// Filename and Updates are empty.
+type WriteError struct {
+	Filename string
+	Updates  []Update
+	Err      error
+}
+
+func (e *WriteError) Error() string {
+	if e.Filename == "" {
+		return fmt.Sprintf("update(s) failed: %v", e.Err)
+	}
+	return fmt.Sprintf("%v: %v update(s) failed: %v", e.Filename, len(e.Updates), e.Err)
+}
+
+// Writer buffers updates for many files in memory, writing them to
+// rrdcached asynchronously using batches. It's goroutine safe.
+//
+// Updates to the same file are coalesced into a single update command.
+// Failures are reported per file to the handler set by OnError.
+type Writer struct {
+	b        Batcher
+	size     int
+	interval time.Duration
+	onError  func(err *WriteError)
+
+	pending map[string][]Update
+	files   []string
+	count   int
+	closed  bool
+	mtx     sync.Mutex
+
+	// flushMtx ensures batches are written in order.
+	flushMtx sync.Mutex
+	flush    chan struct{}
+	done     chan struct{}
+	wg       sync.WaitGroup
+}
+
+// FlushSize sets the number of buffered updates which triggers a flush of a Writer.
+// If n <= 0 flushes are only triggered by the interval or explicit calls to Flush.
+func FlushSize(n int) func(*Writer) error {
+	return func(w *Writer) error {
+		w.size = n
+		return nil
+	}
+}
+
+// FlushInterval sets the interval at which a Writer flushes buffered updates.
+// If d <= 0 flushes are only triggered by size or explicit calls to Flush.
+func FlushInterval(d time.Duration) func(*Writer) error {
+	return func(w *Writer) error {
+		w.interval = d
+		return nil
+	}
+}
+
+// OnError sets the handler a Writer calls for each file whose updates failed,
+// see WriteError for details.
+// It's called from the flushing goroutine so should not block.
+func OnError(f func(err *WriteError)) func(*Writer) error {
+	return func(w *Writer) error {
+		w.onError = f
+		return nil
+	}
+}
+
+// NewWriter returns a new Writer which writes updates using b.
+// The caller must not use b for other commands concurrently unless it's goroutine safe e.g. a Pool.
+func NewWriter(b Batcher, options ...func(w *Writer) error) (*Writer, error) {
+	w := &Writer{
+		b:        b,
+		size:     DefaultFlushSize,
+		interval: DefaultFlushInterval,
+		pending:  make(map[string][]Update),
+		flush:    make(chan struct{}, 1),
+		done:     make(chan struct{}),
+	}
+	for _, f := range options {
+		if f == nil {
+			return nil, ErrNilOption
+		}
+		if err := f(w); err != nil {
+			return nil, err
+		}
+	}
+
+	w.wg.Add(1)
+	go w.run()
+
+	return w, nil
+}
+
+// run flushes the buffered updates when signaled to until closed.
+func (w *Writer) run() {
+	defer w.wg.Done()
+
+	var tick <-chan time.Time
+	if w.interval > 0 {
+		t := time.NewTicker(w.interval)
+		defer t.Stop()
+		tick = t.C
+	}
+
+	for {
+		select {
+		case <-tick:
+		case <-w.flush:
+		case <-w.done:
+			return
+		}
+		w.Flush() // nolint: errcheck
+	}
+}
+
+// Write buffers values to be written to filename.
+func (w *Writer) Write(filename string, value Update, values ...Update) error {
+	w.mtx.Lock()
+	defer w.mtx.Unlock()
+
+	if w.closed {
+		return ErrWriterClosed
+	}
+
+	u, ok := w.pending[filename]
+	if !ok {
+		w.files = append(w.files, filename)
+	}
+	w.pending[filename] = append(append(u, value), values...)
+	w.count += len(values) + 1
+
+	if w.size > 0 && w.count >= w.size {
+		select {
+		case w.flush <- struct{}{}:
+		default:
+			// Flush already requested.
+		}
+	}
+
+	return nil
+}
+
+// take returns the buffered updates, in the order files were first written, resetting the buffer.
+func (w *Writer) take() ([]string, map[string][]Update) {
+	w.mtx.Lock()
+	defer w.mtx.Unlock()
+
+	files, pending := w.files, w.pending
+	w.files = nil
+	w.pending = make(map[string][]Update)
+	w.count = 0
+
+	return files, pending
+}
+
+// Flush writes all buffered updates to rrdcached.
+func (w *Writer) Flush() error {
+	return w.FlushContext(context.Background())
+}
+
+// FlushContext writes all buffered updates to rrdcached.
+// Failed updates are dropped and reported to the OnError handler, in addition
+// if the batch as a whole failed, or rrdcached returned an error which couldn't
+// be attributed to a command, that error is returned.
+func (w *Writer) FlushContext(ctx context.Context) error {
+	w.flushMtx.Lock()
+	defer w.flushMtx.Unlock()
+
+	files, pending := w.take()
+	if len(files) == 0 {
+		return nil
+	}
+
+	var cmds []*Cmd
+	var writes []*WriteError
+	for _, f := range files {
+		for _, updates := range splitUpdates(f, pending[f]) {
+			args := make([]interface{}, 0, len(updates)+1)
+			args = append(args, f)
+			for _, u := range updates {
+				args = append(args, u)
+			}
+			cmds = append(cmds, NewCmd("update").WithArgs(args...))
+			writes = append(writes, &WriteError{Filename: f, Updates: updates})
+		}
+	}
+
+	r, err := w.b.ExecBatchContext(ctx, cmds...)
+	if err != nil {
+		for _, e := range writes {
+			e.Err = err
+			w.report(e)
+		}
+		return err
+	}
+
+	for _, e := range r.Errors {
+		writes[e.Index].Err = e
+		w.report(writes[e.Index])
+	}
+
+	for _, e := range r.Invalid {
+		w.report(&WriteError{Err: e})
+	}
+
+	if len(r.Invalid) > 0 {
+		return r.Invalid[0]
+	}
+
+	return nil
+}
+
+// splitUpdates splits the updates for filename into groups which each fit in
+// an update command shorter than maxCmdLen. An update which doesn't fit on its
+// own is still sent, for rrdcached to reject.
+func splitUpdates(filename string, updates []Update) [][]Update {
+	// "update <filename>\n"
+	base := len("update") + 1 + len(filename) + 1
+
+	var groups [][]Update
+	start, n := 0, base
+	for i, u := range updates {
+		l := 1 + len(u)
+		if i > start && n+l >= maxCmdLen {
+			groups = append(groups, updates[start:i])
+			start, n = i, base
+		}
+		n += l
+	}
+
+	return append(groups, updates[start:])
+}
+
+// report calls the OnError handler, if set, with err.
+func (w *Writer) report(err *WriteError) {
+	if w.onError != nil {
+		w.onError(err)
+	}
+}
+
+// Close flushes any buffered updates and stops the Writer.
+// It doesn't close the underlying Batcher.
+func (w *Writer) Close() error {
+	w.mtx.Lock()
+	if w.closed {
+		w.mtx.Unlock()
+		return ErrWriterClosed
+	}
+	w.closed = true
+	w.mtx.Unlock()
+
+	close(w.done)
+	w.wg.Wait()
+
+	return w.Flush()
+}
@@ -0,0 +1,225 @@
+package rrd
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// testBatcher is a Batcher which records the batches it receives.
+type testBatcher struct {
+	batches [][]*Cmd
+	err     error
+	fail    map[int]string
+	invalid []string
+	mtx     sync.Mutex
+}
+
+func (b *testBatcher) ExecBatchContext(ctx context.Context, cmds ...*Cmd) (*BatchResult, error) {
+	b.mtx.Lock()
+	defer b.mtx.Unlock()
+
+	b.batches = append(b.batches, cmds)
+	if b.err != nil {
+		return nil, b.err
+	}
+
+	r := &BatchResult{Cmds: cmds}
+	for i, msg := range b.fail {
+		r.Errors = append(r.Errors, &BatchError{Index: i, Cmd: cmds[i], Msg: msg})
+	}
+	for _, l := range b.invalid {
+		r.Invalid = append(r.Invalid, NewInvalidResponseError("batch: invalid error", l))
+	}
+	return r, nil
+}
+
+func (b *testBatcher) count() int {
+	b.mtx.Lock()
+	defer b.mtx.Unlock()
+	return len(b.batches)
+}
+
+func TestWriter(t *testing.T) {
+	b := &testBatcher{fail: map[int]string{1: "No such file: b.rrd"}}
+	var errs []*WriteError
+	w, err := NewWriter(b, FlushInterval(0), FlushSize(0), OnError(func(err *WriteError) {
+		errs = append(errs, err)
+	}))
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	assert.NoError(t, w.Write("a.rrd", "1499968801:1"))
+	assert.NoError(t, w.Write("b.rrd", "1499968801:2", "1499968802:3"))
+	assert.NoError(t, w.Write("a.rrd", "1499968802:4"))
+	assert.NoError(t, w.Flush())
+
+	if assert.Len(t, b.batches, 1) {
+		assert.Equal(t, []*Cmd{
+			NewCmd("update").WithArgs("a.rrd", Update("1499968801:1"), Update("1499968802:4")),
+			NewCmd("update").WithArgs("b.rrd", Update("1499968801:2"), Update("1499968802:3")),
+		}, b.batches[0])
+	}
+
+	if assert.Len(t, errs, 1) {
+		assert.Equal(t, "b.rrd", errs[0].Filename)
+		assert.Equal(t, []Update{"1499968801:2", "1499968802:3"}, errs[0].Updates)
+	}
+
+	// Nothing buffered.
+	assert.NoError(t, w.Flush())
+	assert.Len(t, b.batches, 1)
+
+	assert.NoError(t, w.Close())
+	assert.Equal(t, ErrWriterClosed, w.Write("a.rrd", "1499968803:5"))
+	assert.Equal(t, ErrWriterClosed, w.Close())
+}
+
+func TestWriterBatchError(t *testing.T) {
+	errBatch := errors.New("batch failed")
+	b := &testBatcher{err: errBatch}
+	var errs []*WriteError
+	w, err := NewWriter(b, FlushInterval(0), OnError(func(err *WriteError) {
+		errs = append(errs, err)
+	}))
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	assert.NoError(t, w.Write("a.rrd", "1499968801:1"))
+	assert.NoError(t, w.Write("b.rrd", "1499968801:2"))
+	assert.Equal(t, errBatch, w.Flush())
+	if assert.Len(t, errs, 2) {
+		assert.Equal(t, errBatch, errs[0].Err)
+		assert.Equal(t, errBatch, errs[1].Err)
+	}
+	assert.NoError(t, w.Close())
+}
+
+func TestWriterInvalid(t *testing.T) {
+	b := &testBatcher{invalid: []string{"bad line"}}
+	var errs []*WriteError
+	w, err := NewWriter(b, FlushInterval(0), OnError(func(err *WriteError) {
+		errs = append(errs, err)
+	}))
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	assert.NoError(t, w.Write("a.rrd", "1499968801:1"))
+	err = w.Flush()
+	if assert.IsType(t, &InvalidResponseError{}, err) && assert.Len(t, errs, 1) {
+		assert.Equal(t, err, errs[0].Err)
+		assert.Empty(t, errs[0].Filename)
+	}
+	assert.NoError(t, w.Close())
+}
+
+func TestWriterSplit(t *testing.T) {
+	b := &testBatcher{}
+	w, err := NewWriter(b, FlushInterval(0), FlushSize(0))
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	var updates []Update
+	for i := 0; i < 500; i++ {
+		updates = append(updates, NewUpdate(time.Unix(1499968801+int64(i), 0), i))
+	}
+	assert.NoError(t, w.Write("a.rrd", updates[0], updates[1:]...))
+	assert.NoError(t, w.Flush())
+
+	if assert.Len(t, b.batches, 1) {
+		cmds := b.batches[0]
+		assert.True(t, len(cmds) > 1)
+
+		var sent []Update
+		for _, c := range cmds {
+			assert.True(t, len(c.String()) < maxCmdLen, "%v bytes", len(c.String()))
+			if assert.Equal(t, "a.rrd", c.args[0]) {
+				for _, a := range c.args[1:] {
+					sent = append(sent, a.(Update))
+				}
+			}
+		}
+		assert.Equal(t, updates, sent)
+	}
+	assert.NoError(t, w.Close())
+}
+
+func TestWriterFlushSize(t *testing.T) {
+	b := &testBatcher{}
+	w, err := NewWriter(b, FlushInterval(0), FlushSize(2))
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	assert.NoError(t, w.Write("a.rrd", "1499968801:1", "1499968802:2"))
+	for i := 0; i < 100 && b.count() == 0; i++ {
+		time.Sleep(time.Millisecond * 10)
+	}
+	assert.Equal(t, 1, b.count())
+	assert.NoError(t, w.Close())
+}
+
+func TestWriterFlushInterval(t *testing.T) {
+	b := &testBatcher{}
+	w, err := NewWriter(b, FlushInterval(time.Millisecond*10))
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	assert.NoError(t, w.Write("a.rrd", "1499968801:1"))
+	for i := 0; i < 100 && b.count() == 0; i++ {
+		time.Sleep(time.Millisecond * 10)
+	}
+	assert.Equal(t, 1, b.count())
+	assert.NoError(t, w.Close())
+}
+
+func TestWriterClient(t *testing.T) {
+	s := newServer(t)
+	if s == nil {
+		return
+	}
+	defer func() {
+		assert.NoError(t, s.Close())
+	}()
+
+	c, err := NewClient(s.Addr, Timeout(time.Second*2))
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	defer func() {
+		assert.NoError(t, c.Close())
+	}()
+
+	var errs []*WriteError
+	w, err := NewWriter(c, FlushInterval(0), OnError(func(err *WriteError) {
+		errs = append(errs, err)
+	}))
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	assert.NoError(t, w.Write("a.rrd", "1499968801:1"))
+	assert.NoError(t, w.Write("b.rrd", "1499968801:2"))
+	assert.NoError(t, w.Close())
+
+	// The mock server reports errors for the first two commands.
+	if assert.Len(t, errs, 2) {
+		assert.Equal(t, "a.rrd", errs[0].Filename)
+		assert.Equal(t, "b.rrd", errs[1].Filename)
+	}
+}
+
+func TestWriterNilOption(t *testing.T) {
+	_, err := NewWriter(&testBatcher{}, nil)
+	assert.Equal(t, ErrNilOption, err)
+}